@@ -0,0 +1,229 @@
+package gizmo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/jmataya/gizmo/models"
+	log "github.com/sirupsen/logrus"
+)
+
+const blobShadowType = "blob"
+
+var (
+	// ErrBlobNotFound is returned when the content of a Blob isn't stored.
+	ErrBlobNotFound = errors.New("Blob not found")
+
+	// ErrNoBlobStore is returned when Blobs are used with an EntityManager
+	// that doesn't have a BlobStore.
+	ErrNoBlobStore = errors.New("No BlobStore is configured")
+)
+
+// Blob refers to binary content, such as an image or a PDF, that is too large
+// to be stored in an ObjectForm. The content is stored out of line in a
+// BlobStore, and only the Blob is saved as an attribute, so it is versioned
+// with the Entity like any other attribute:
+//
+//	type Product struct {
+//	  gizmo.EntityObject
+//
+//	  Title  string
+//	  Manual gizmo.Blob
+//	}
+//
+// Blobs are created by EntityManager.PutBlob and read with OpenBlob or
+// WriteBlob. The Digest has the form sha256:<hex digest>, and is the SHA-256
+// of the content, so identical content is only stored once.
+type Blob struct {
+	Digest    string
+	Size      int64
+	MediaType string
+}
+
+// BlobStore stores the content of Blobs by their digests. Content is never
+// modified or deleted once it is stored.
+type BlobStore interface {
+	// Put stores the content read from r, unless content with the same digest
+	// is already stored, and returns its digest and size.
+	Put(r io.Reader) (digest string, size int64, err error)
+
+	// Open opens the content with a digest for reading. If the content isn't
+	// stored, ErrBlobNotFound is returned.
+	Open(digest string) (io.ReadCloser, error)
+
+	// Size gets the size of the content with a digest. If the content isn't
+	// stored, ErrBlobNotFound is returned.
+	Size(digest string) (int64, error)
+}
+
+// newBlobHash creates the hash that digests of Blobs are computed with.
+func newBlobHash() hash.Hash {
+	return sha256.New()
+}
+
+// blobDigest formats the sum of a hash created by newBlobHash as a digest.
+func blobDigest(h hash.Hash) string {
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// isBlobDigest determines whether a digest is well formed. Digests of Blobs
+// have the same format as the refs of attributes.
+func isBlobDigest(digest string) bool {
+	return models.IsAttributeRef(digest)
+}
+
+// copyVerifiedBlob copies the content of a Blob while checking that it has
+// the size and digest of the Blob.
+func copyVerifiedBlob(w io.Writer, r io.Reader, blob Blob) (int64, error) {
+	h := newBlobHash()
+	written, err := io.Copy(io.MultiWriter(w, h), r)
+	if err != nil {
+		return written, err
+	}
+
+	if written != blob.Size {
+		return written, fmt.Errorf("Blob %s has %d bytes, not %d", blob.Digest, written, blob.Size)
+	} else if digest := blobDigest(h); digest != blob.Digest {
+		return written, fmt.Errorf("Blob %s has digest %s", blob.Digest, digest)
+	}
+
+	return written, nil
+}
+
+// blobCodec stores a Blob as an object with its digest, size, and media type.
+type blobCodec struct{}
+
+func (blobCodec) ShadowType() string {
+	return blobShadowType
+}
+
+func (blobCodec) Encode(value interface{}) (interface{}, error) {
+	blob, ok := value.(Blob)
+	if !ok {
+		return nil, fmt.Errorf("expected a Blob, not %T", value)
+	} else if blob == (Blob{}) {
+		return nil, nil
+	} else if !isBlobDigest(blob.Digest) {
+		return nil, fmt.Errorf("digest %q is invalid", blob.Digest)
+	}
+
+	return map[string]interface{}{
+		"digest":     blob.Digest,
+		"size":       blob.Size,
+		"media_type": blob.MediaType,
+	}, nil
+}
+
+func (blobCodec) Decode(value interface{}) (interface{}, error) {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected an object, not %T", value)
+	}
+
+	digest, ok := obj["digest"].(string)
+	if !ok || !isBlobDigest(digest) {
+		return nil, fmt.Errorf("expected a digest, not %v", obj["digest"])
+	}
+
+	size, err := integerValue(obj["size"])
+	if err != nil {
+		return nil, err
+	}
+
+	mediaType, _ := obj["media_type"].(string)
+	return Blob{Digest: digest, Size: size, MediaType: mediaType}, nil
+}
+
+// blobsInContent finds every Blob that is saved as an attribute of a
+// FullObject, including Blobs in lists, maps, and nested structs.
+func blobsInContent(logger log.FieldLogger, full models.FullObject) ([]Blob, error) {
+	attributes, err := illuminatedAttributes(logger, full)
+	if err != nil {
+		return nil, err
+	}
+
+	blobs := []Blob{}
+	for name, attribute := range attributes {
+		if err := collectBlobs(attribute.Type, attribute.Value, &blobs); err != nil {
+			return nil, fmt.Errorf("Unable to decode blob in attribute %s: %s", name, err.Error())
+		}
+	}
+
+	return blobs, nil
+}
+
+func collectBlobs(attrType string, value interface{}, blobs *[]Blob) error {
+	if value == nil {
+		return nil
+	}
+
+	if attrType == blobShadowType {
+		blob, err := blobCodec{}.Decode(value)
+		if err != nil {
+			return err
+		}
+
+		*blobs = append(*blobs, blob.(Blob))
+	} else if elem, ok := parameterizedShadowType(attrType, "list"); ok {
+		list, _ := value.([]interface{})
+		for _, item := range list {
+			if err := collectBlobs(elem, item, blobs); err != nil {
+				return err
+			}
+		}
+	} else if elem, ok := parameterizedShadowType(attrType, "map"); ok {
+		obj, _ := value.(map[string]interface{})
+		for _, item := range obj {
+			if err := collectBlobs(elem, item, blobs); err != nil {
+				return err
+			}
+		}
+	} else if attrType == "object" {
+		collectObjectBlobs(value, blobs)
+	}
+
+	return nil
+}
+
+// collectObjectBlobs finds the Blobs in the fields of a nested struct. The
+// fields of an object aren't typed, so Blobs are recognized by the shape
+// that blobCodec encodes them in.
+func collectObjectBlobs(value interface{}, blobs *[]Blob) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if isEncodedBlob(v) {
+			if blob, err := (blobCodec{}).Decode(v); err == nil {
+				*blobs = append(*blobs, blob.(Blob))
+				return
+			}
+		}
+
+		for _, field := range v {
+			collectObjectBlobs(field, blobs)
+		}
+	case []interface{}:
+		for _, item := range v {
+			collectObjectBlobs(item, blobs)
+		}
+	}
+}
+
+// isEncodedBlob determines whether an object has exactly the fields that
+// blobCodec encodes a Blob with.
+func isEncodedBlob(obj map[string]interface{}) bool {
+	if len(obj) != 3 {
+		return false
+	}
+
+	for _, key := range []string{"digest", "size", "media_type"} {
+		if _, ok := obj[key]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,246 @@
+package gizmo
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jmataya/gizmo/models"
+	"github.com/jmataya/gizmo/store"
+	"github.com/jmataya/gizmo/testutils"
+	log "github.com/sirupsen/logrus"
+)
+
+const manualDigest = "sha256:7d4aaff4d80d3a89a6bcb4a8bb8e2fb8f25f41cd2dde8aa1a4e5b57b1b0b8bd1"
+
+func TestBlobCodec(t *testing.T) {
+	manual := Blob{Digest: manualDigest, Size: 12, MediaType: "application/pdf"}
+
+	var tests = []struct {
+		value   interface{}
+		want    interface{}
+		wantErr string
+	}{
+		{manual, map[string]interface{}{"digest": manualDigest, "size": int64(12), "media_type": "application/pdf"}, ""},
+		{Blob{}, nil, ""},
+		{Blob{Digest: "manual.pdf", Size: 12}, nil, "Unable to encode attribute manual of type gizmo.Blob: digest \"manual.pdf\" is invalid"},
+	}
+
+	for _, test := range tests {
+		got, err := encodeAttribute("manual", reflect.ValueOf(test.value))
+		if errorMsg(err) != test.wantErr {
+			t.Errorf("encodeAttribute(%v) = %s, want %s", test.value, errorMsg(err), test.wantErr)
+		} else if test.wantErr == "" && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("encodeAttribute(%v) = %#v, want %#v", test.value, got, test.want)
+		}
+	}
+
+	encoded := map[string]interface{}{"digest": manualDigest, "size": float64(12), "media_type": "application/pdf"}
+
+	var decoded Blob
+	if err := decodeAttribute("manual", "blob", encoded, reflect.ValueOf(&decoded).Elem()); err != nil {
+		t.Fatal(err)
+	} else if decoded != manual {
+		t.Errorf("decodeAttribute() = %v, want %v", decoded, manual)
+	}
+}
+
+func TestBlobsInContent(t *testing.T) {
+	assert := testutils.NewAssert(t)
+
+	manual := Blob{Digest: manualDigest, Size: 12, MediaType: "application/pdf"}
+	encoded, err := encodeAttribute("attachments", reflect.ValueOf([]Blob{manual, manual}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	full := fullObjectOf(t, map[string]interface{}{"title": "Fox Socks"})
+	ref, err := full.Form.AddAttribute(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := full.Shadow.AddAttribute("attachments", "list<blob>", ref); err != nil {
+		t.Fatal(err)
+	}
+
+	blobs, err := blobsInContent(log.StandardLogger(), full)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(2, len(blobs))
+	assert.Equal(manual, blobs[1])
+}
+
+type manualPage struct {
+	Title      string
+	Manual     Blob
+	Appendices []Blob
+	Cover      *Blob
+}
+
+func TestBlobsInContent_Object(t *testing.T) {
+	assert := testutils.NewAssert(t)
+
+	manual := Blob{Digest: manualDigest, Size: 12, MediaType: "application/pdf"}
+	page := manualPage{Title: "Fox Socks", Manual: manual, Appendices: []Blob{manual}}
+	encoded, err := encodeAttribute("page", reflect.ValueOf(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The content is read back from the database as JSON.
+	data, err := json.Marshal(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stored interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&stored); err != nil {
+		t.Fatal(err)
+	}
+
+	full := fullObjectOf(t, map[string]interface{}{"title": "Fox Socks"})
+	ref, err := full.Form.AddAttribute(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := full.Shadow.AddAttribute("page", "object", ref); err != nil {
+		t.Fatal(err)
+	}
+
+	blobs, err := blobsInContent(log.StandardLogger(), full)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Equal(2, len(blobs)) {
+		assert.Equal(manual, blobs[0])
+		assert.Equal(manual, blobs[1])
+	}
+}
+
+type Handbook struct {
+	EntityObject
+	Page manualPage
+}
+
+func TestCreate_BlobInObject(t *testing.T) {
+	s := store.NewMemoryStore()
+	view, err := s.InsertView(models.View{Name: "Default"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blobs, err := NewFileBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mgr := NewEntityManagerWithStore(s, WithBlobStore(blobs))
+
+	missing := Handbook{Page: manualPage{Title: "Fox Socks", Manual: Blob{Digest: manualDigest, Size: 12}}}
+	_, err = mgr.Create(&missing, view.ID)
+	if got, want := errorMsg(err), "Content of Blob "+manualDigest+" is not stored"; got != want {
+		t.Errorf("Create with a missing Blob = %s, want %s", got, want)
+	}
+
+	stored, err := mgr.PutBlob(strings.NewReader("Fox Socks manual"), "text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handbook := Handbook{Page: manualPage{Title: "Fox Socks", Manual: stored}}
+	if _, err := mgr.Create(&handbook, view.ID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileBlobStore(t *testing.T) {
+	assert := testutils.NewAssert(t)
+
+	store, err := NewFileBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := strings.Repeat("%PDF-1.4 ", 1000)
+	digest, size, err := store.Put(strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(int64(len(content)), size)
+	assert.Equal(true, isBlobDigest(digest))
+
+	again, _, err := store.Put(strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(digest, again)
+
+	stored, err := store.Size(digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(size, stored)
+
+	reader, err := store.Open(digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	var out bytes.Buffer
+	written, err := copyVerifiedBlob(&out, reader, Blob{Digest: digest, Size: size})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(size, written)
+	assert.Equal(content, out.String())
+
+	if _, err := store.Open(manualDigest); err != ErrBlobNotFound {
+		t.Errorf("Open(%s) = %v, want %v", manualDigest, err, ErrBlobNotFound)
+	}
+	if _, err := store.Size("manual.pdf"); err != ErrBlobNotFound {
+		t.Errorf("Size(manual.pdf) = %v, want %v", err, ErrBlobNotFound)
+	}
+}
+
+func TestCopyVerifiedBlob(t *testing.T) {
+	var tests = []struct {
+		content string
+		blob    Blob
+		wantErr string
+	}{
+		{"tampered", Blob{Digest: manualDigest, Size: 8}, "Blob " + manualDigest + " has digest sha256:"},
+		{"truncated", Blob{Digest: manualDigest, Size: 12}, "Blob " + manualDigest + " has 9 bytes, not 12"},
+	}
+
+	for _, test := range tests {
+		var out bytes.Buffer
+		_, err := copyVerifiedBlob(&out, strings.NewReader(test.content), test.blob)
+		if !strings.HasPrefix(errorMsg(err), test.wantErr) || err == nil {
+			t.Errorf("copyVerifiedBlob(%s) = %s, want %s", test.content, errorMsg(err), test.wantErr)
+		}
+	}
+}
+
+func TestBlobs_WithoutBlobStore(t *testing.T) {
+	mgr := NewEntityManagerWithStore(nil)
+
+	if _, err := mgr.PutBlob(strings.NewReader("content"), "text/plain"); err != ErrNoBlobStore {
+		t.Errorf("PutBlob: expected ErrNoBlobStore, got %v", err)
+	}
+
+	blob := Blob{Digest: manualDigest, Size: 12}
+	if _, err := mgr.OpenBlob(blob); err != ErrNoBlobStore {
+		t.Errorf("OpenBlob: expected ErrNoBlobStore, got %v", err)
+	}
+	if _, err := mgr.WriteBlob(new(bytes.Buffer), blob); err != ErrNoBlobStore {
+		t.Errorf("WriteBlob: expected ErrNoBlobStore, got %v", err)
+	}
+}
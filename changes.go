@@ -0,0 +1,73 @@
+package gizmo
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/jmataya/gizmo/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// sameContent determines whether the content that an Entity is about to be
+// saved with is identical to the content of its previous version, in which
+// case the previous form, shadow, and commit can be reused. Values are
+// compared by their JSON encodings, since values that were read back from the
+// database have different Go types than the ones that are about to be written.
+func sameContent(logger log.FieldLogger, current models.FullObject, previous models.FullObject) (bool, error) {
+	if current.Form.Kind != previous.Form.Kind || current.Shadow.Revision != previous.Shadow.Revision {
+		return false, nil
+	}
+
+	currentAttributes, err := illuminatedAttributes(logger, current)
+	if err != nil {
+		return false, err
+	}
+
+	previousAttributes, err := illuminatedAttributes(logger, previous)
+	if err != nil {
+		return false, err
+	}
+
+	return sameJSON(currentAttributes, previousAttributes)
+}
+
+// sameRelations determines whether two sets of relations link to the same
+// versions in the same positions with the same metadata. Relations without
+// edges are ignored, as is the kind of each edge, which is determined by the
+// version it links to.
+func sameRelations(current models.EntityRelations, previous models.EntityRelations) (bool, error) {
+	return sameJSON(comparableRelations(current), comparableRelations(previous))
+}
+
+func comparableRelations(relations models.EntityRelations) models.EntityRelations {
+	comparable := models.EntityRelations{}
+	for entityType, edges := range relations {
+		if len(edges) == 0 {
+			continue
+		}
+
+		comparableEdges := make([]models.RelationEdge, len(edges))
+		for index, edge := range edges {
+			edge.Kind = ""
+			comparableEdges[index] = edge
+		}
+
+		comparable[entityType] = comparableEdges
+	}
+
+	return comparable
+}
+
+func sameJSON(a interface{}, b interface{}) (bool, error) {
+	encodedA, err := json.Marshal(a)
+	if err != nil {
+		return false, err
+	}
+
+	encodedB, err := json.Marshal(b)
+	if err != nil {
+		return false, err
+	}
+
+	return bytes.Equal(encodedA, encodedB), nil
+}
@@ -0,0 +1,84 @@
+package gizmo
+
+import (
+	"testing"
+
+	"github.com/jmataya/gizmo/models"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestSameContent(t *testing.T) {
+	stored := storedObjectOf(t, fullObjectOf(t, map[string]interface{}{
+		"title": "Wool Socks",
+		"stock": 12,
+		"price": map[string]interface{}{"currency": "USD", "amount": int64(1299)},
+	}))
+
+	var tests = []struct {
+		name       string
+		attributes map[string]interface{}
+		revision   int
+		want       bool
+	}{
+		{"identical", map[string]interface{}{"title": "Wool Socks", "stock": 12, "price": map[string]interface{}{"amount": int64(1299), "currency": "USD"}}, 0, true},
+		{"changed value", map[string]interface{}{"title": "Wool Socks", "stock": 11, "price": map[string]interface{}{"amount": int64(1299), "currency": "USD"}}, 0, false},
+		{"removed attribute", map[string]interface{}{"title": "Wool Socks", "stock": 12}, 0, false},
+		{"new revision", map[string]interface{}{"title": "Wool Socks", "stock": 12, "price": map[string]interface{}{"amount": int64(1299), "currency": "USD"}}, 1, false},
+	}
+
+	for _, test := range tests {
+		current := fullObjectOf(t, test.attributes)
+		current.Shadow.Revision = test.revision
+
+		got, err := sameContent(log.StandardLogger(), current, stored)
+		if err != nil {
+			t.Fatal(err)
+		} else if got != test.want {
+			t.Errorf("sameContent(%s) = %t, want %t", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSameRelations(t *testing.T) {
+	stored := models.EntityRelations{
+		"sku":   {{ID: 3, Position: 0, Metadata: map[string]interface{}{"quantity": 2.0}}},
+		"image": {},
+	}
+
+	var tests = []struct {
+		name      string
+		relations models.EntityRelations
+		want      bool
+	}{
+		{"identical", models.EntityRelations{"sku": {{ID: 3, Kind: "sku", Position: 0, Metadata: map[string]interface{}{"quantity": 2}}}}, true},
+		{"new version", models.EntityRelations{"sku": {{ID: 4, Kind: "sku", Position: 0, Metadata: map[string]interface{}{"quantity": 2}}}}, false},
+		{"changed metadata", models.EntityRelations{"sku": {{ID: 3, Kind: "sku", Position: 0, Metadata: map[string]interface{}{"quantity": 3}}}}, false},
+		{"added relation", models.EntityRelations{"sku": {{ID: 3, Position: 0, Metadata: map[string]interface{}{"quantity": 2}}}, "image": {{ID: 5}}}, false},
+	}
+
+	for _, test := range tests {
+		got, err := sameRelations(test.relations, stored)
+		if err != nil {
+			t.Fatal(err)
+		} else if got != test.want {
+			t.Errorf("sameRelations(%s) = %t, want %t", test.name, got, test.want)
+		}
+	}
+}
+
+// storedObjectOf round trips the attributes of a FullObject through the
+// database encoding, as if it had been saved and read back.
+func storedObjectOf(t *testing.T, full models.FullObject) models.FullObject {
+	encoded, err := full.Form.Attributes.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var attributes models.ObjectFormAttributes
+	if err := attributes.Scan(encoded); err != nil {
+		t.Fatal(err)
+	}
+
+	full.Form.Attributes = attributes
+	return full
+}
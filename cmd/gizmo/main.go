@@ -0,0 +1,123 @@
+// Command gizmo administers the database of a gizmo installation.
+//
+// Usage:
+//
+//	gizmo <command> [flags]
+//
+// The commands are:
+//
+//	migrate-refs  rewrite attribute refs written by older versions of gizmo
+//	report        describe the attributes that are stored for each kind
+//	setup         create or upgrade the database schema
+//	verify-refs   check that every attribute ref resolves to its value
+//
+// Every command connects to PostgreSQL with the flags -host, -dbname, -user,
+// -password, and -sslmode, which default to the environment variables DB_HOST,
+// DB_NAME, DB_USER, DB_PASSWORD, and DB_SSLMODE. SSL is disabled unless
+// -sslmode is set, for example to require or verify-full.
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	_ "github.com/lib/pq" // Needed to allow database/sql to use Postgres.
+)
+
+type command struct {
+	description string
+	run         func(args []string) error
+}
+
+var commands = map[string]command{
+	"migrate-refs": {"rewrite attribute refs written by older versions of gizmo", runMigrateRefs},
+	"report":       {"describe the attributes that are stored for each kind", runReport},
+	"setup":        {"create or upgrade the database schema", runSetup},
+	"verify-refs":  {"check that every attribute ref resolves to its value", runVerifyRefs},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "gizmo: unknown command %s\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+
+	if err := cmd.run(os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "gizmo %s: %s\n", os.Args[1], err.Error())
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "Usage: gizmo <command> [flags]")
+	fmt.Fprintln(os.Stderr, "\nThe commands are:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-14s%s\n", name, commands[name].description)
+	}
+}
+
+// connection holds the flags that every command uses to connect to the
+// database.
+type connection struct {
+	host     string
+	dbName   string
+	user     string
+	password string
+	sslMode  string
+}
+
+func connectionFlags(flags *flag.FlagSet) *connection {
+	conn := &connection{}
+	flags.StringVar(&conn.host, "host", os.Getenv("DB_HOST"), "database host")
+	flags.StringVar(&conn.dbName, "dbname", envOrDefault("DB_NAME", "gizmo"), "database name")
+	flags.StringVar(&conn.user, "user", envOrDefault("DB_USER", "gizmo"), "database user")
+	flags.StringVar(&conn.password, "password", os.Getenv("DB_PASSWORD"), "database password")
+	flags.StringVar(&conn.sslMode, "sslmode", envOrDefault("DB_SSLMODE", "disable"), "database sslmode, such as disable, require, or verify-full")
+	return conn
+}
+
+func (c connection) open() (*sql.DB, error) {
+	params := []string{
+		fmt.Sprintf("dbname=%s", c.dbName),
+		fmt.Sprintf("user=%s", c.user),
+		fmt.Sprintf("sslmode=%s", c.sslMode),
+	}
+	if c.host != "" {
+		params = append(params, fmt.Sprintf("host=%s", c.host))
+	}
+	if c.password != "" {
+		params = append(params, fmt.Sprintf("password=%s", c.password))
+	}
+
+	db, err := sql.Open("postgres", strings.Join(params, " "))
+	if err != nil {
+		return nil, err
+	}
+
+	return db, db.Ping()
+}
+
+func envOrDefault(key string, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+
+	return defaultValue
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/jmataya/gizmo"
+)
+
+func runMigrateRefs(args []string) error {
+	flags := flag.NewFlagSet("migrate-refs", flag.ContinueOnError)
+	conn := connectionFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	db, err := conn.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migration, err := gizmo.MigrateAttributeRefs(db)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stdout, "Rewrote %d refs in %d forms and %d shadows\n", migration.Refs, migration.Forms, migration.Shadows)
+	return nil
+}
+
+func runVerifyRefs(args []string) error {
+	flags := flag.NewFlagSet("verify-refs", flag.ContinueOnError)
+	conn := connectionFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	db, err := conn.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	problems, err := gizmo.VerifyAttributeRefs(db)
+	if err != nil {
+		return err
+	}
+
+	for _, problem := range problems {
+		fmt.Fprintln(os.Stdout, problem.String())
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("found %d invalid refs", len(problems))
+	}
+
+	fmt.Fprintln(os.Stdout, "Every ref is valid")
+	return nil
+}
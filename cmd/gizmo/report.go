@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jmataya/gizmo"
+)
+
+func runReport(args []string) error {
+	flags := flag.NewFlagSet("report", flag.ContinueOnError)
+	conn := connectionFlags(flags)
+	kind := flags.String("kind", "", "report only this kind")
+	format := flags.String("format", "text", "output format: text, json, or schema")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	db, err := conn.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	kinds := []string{}
+	if *kind != "" {
+		kinds = append(kinds, *kind)
+	}
+
+	reports, err := gizmo.Report(db, kinds...)
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case "text":
+		return writeTextReport(os.Stdout, reports)
+	case "json":
+		return writeJSON(os.Stdout, reports)
+	case "schema":
+		schemas := map[string]gizmo.Schema{}
+		for _, report := range reports {
+			schemas[report.Kind] = report.InferSchema()
+		}
+
+		return writeJSON(os.Stdout, schemas)
+	default:
+		return errors.New("format must be text, json, or schema")
+	}
+}
+
+func writeTextReport(out io.Writer, reports []gizmo.KindReport) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	for _, report := range reports {
+		fmt.Fprintf(w, "%s (%d commits)\n", report.Kind, report.Commits)
+		fmt.Fprintln(w, "  ATTRIBUTE\tTYPES\tCOMMITS\tFREQUENCY\tFIRST\tLAST\t")
+
+		for _, attribute := range report.Attributes {
+			types := make([]string, len(attribute.Types))
+			for index, typeReport := range attribute.Types {
+				types[index] = fmt.Sprintf("%s (%d)", typeReport.Type, typeReport.Commits)
+			}
+
+			changed := ""
+			if attribute.TypeChanged {
+				changed = "TYPE CHANGED"
+			}
+
+			fmt.Fprintf(w, "  %s\t%s\t%d\t%.1f%%\t%d\t%d\t%s\n",
+				attribute.Name,
+				strings.Join(types, ", "),
+				attribute.Commits,
+				attribute.Frequency*100,
+				attribute.FirstCommitID,
+				attribute.LastCommitID,
+				changed)
+		}
+
+		fmt.Fprintln(w)
+	}
+
+	return w.Flush()
+}
+
+func writeJSON(out io.Writer, value interface{}) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
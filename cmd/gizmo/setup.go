@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/jmataya/gizmo"
+)
+
+func runSetup(args []string) error {
+	flags := flag.NewFlagSet("setup", flag.ContinueOnError)
+	conn := connectionFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	db, err := conn.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	applied, err := gizmo.Migrate(db)
+	if err != nil {
+		return err
+	}
+
+	if len(applied) == 0 {
+		fmt.Fprintln(os.Stdout, "Database is up to date")
+		return nil
+	}
+
+	for _, migration := range applied {
+		fmt.Fprintf(os.Stdout, "Applied %s (%s)\n", migration.Version, migration.Description)
+	}
+
+	fmt.Fprintf(os.Stdout, "Applied %d migrations\n", len(applied))
+	return nil
+}
@@ -0,0 +1,170 @@
+package gizmo
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// AttributeCodec converts the values of a Go type to and from the values that
+// are stored as attributes in an ObjectForm.
+type AttributeCodec interface {
+	// ShadowType is the type recorded for the attribute in the ObjectShadow.
+	ShadowType() string
+
+	// Encode converts a value of the Go type into a value that can be encoded
+	// as JSON.
+	Encode(value interface{}) (interface{}, error)
+
+	// Decode converts a value decoded from JSON into a value of the Go type.
+	// Numbers are passed as either json.Number or float64.
+	Decode(value interface{}) (interface{}, error)
+}
+
+type registeredCodec struct {
+	goType reflect.Type
+	codec  AttributeCodec
+}
+
+// codecs maps Go types and shadow types to the AttributeCodec that handles
+// them.
+var codecs = &codecRegistry{
+	byType:   map[reflect.Type]registeredCodec{},
+	byShadow: map[string]registeredCodec{},
+}
+
+type codecRegistry struct {
+	sync.RWMutex
+	byType   map[reflect.Type]registeredCodec
+	byShadow map[string]registeredCodec
+}
+
+func init() {
+	RegisterAttributeCodec(time.Time{}, timeCodec{})
+	RegisterAttributeCodec([]byte{}, bytesCodec{})
+	RegisterAttributeCodec(Blob{}, blobCodec{})
+}
+
+// RegisterAttributeCodec registers the codec that is used to save and load
+// attributes with the Go type of the prototype. Attributes that don't map to
+// a field are decoded with the codec registered for their shadow type.
+func RegisterAttributeCodec(prototype interface{}, codec AttributeCodec) error {
+	if prototype == nil {
+		return errors.New("Prototype must be non-nil")
+	} else if codec == nil {
+		return errors.New("Codec must be non-nil")
+	}
+
+	shadowType := codec.ShadowType()
+	if shadowType == "" {
+		return errors.New("Shadow type of codec must be non-empty")
+	}
+
+	goType := reflect.TypeOf(prototype)
+
+	codecs.Lock()
+	defer codecs.Unlock()
+
+	if _, ok := codecs.byType[goType]; ok {
+		return fmt.Errorf("A codec is already registered for %v", goType)
+	} else if existing, ok := codecs.byShadow[shadowType]; ok && existing.goType != goType {
+		return fmt.Errorf("Shadow type %s is already registered to %v", shadowType, existing.goType)
+	}
+
+	registered := registeredCodec{goType: goType, codec: codec}
+	codecs.byType[goType] = registered
+	codecs.byShadow[shadowType] = registered
+	return nil
+}
+
+// codecForType gets the codec registered for a Go type.
+func codecForType(goType reflect.Type) (AttributeCodec, bool) {
+	codecs.RLock()
+	defer codecs.RUnlock()
+
+	registered, ok := codecs.byType[goType]
+	return registered.codec, ok
+}
+
+// typeForShadow gets the Go type of the codec registered for a shadow type.
+func typeForShadow(shadowType string) (reflect.Type, bool) {
+	codecs.RLock()
+	defer codecs.RUnlock()
+
+	registered, ok := codecs.byShadow[shadowType]
+	return registered.goType, ok
+}
+
+// decodeWithCodec decodes a value with a codec and sets it on dest.
+func decodeWithCodec(codec AttributeCodec, value interface{}, dest reflect.Value) error {
+	decoded, err := codec.Decode(value)
+	if err != nil {
+		return err
+	}
+
+	val := reflect.ValueOf(decoded)
+	if !val.IsValid() {
+		dest.Set(reflect.Zero(dest.Type()))
+	} else if val.Type().AssignableTo(dest.Type()) {
+		dest.Set(val)
+	} else if val.Type().ConvertibleTo(dest.Type()) {
+		dest.Set(val.Convert(dest.Type()))
+	} else {
+		return fmt.Errorf("codec %s decoded %v", codec.ShadowType(), val.Type())
+	}
+
+	return nil
+}
+
+// timeCodec stores a time.Time as an RFC 3339 string.
+type timeCodec struct{}
+
+func (timeCodec) ShadowType() string {
+	return "time"
+}
+
+func (timeCodec) Encode(value interface{}) (interface{}, error) {
+	t, ok := value.(time.Time)
+	if !ok {
+		return nil, fmt.Errorf("expected a time.Time, not %T", value)
+	}
+
+	return t.Format(time.RFC3339Nano), nil
+}
+
+func (timeCodec) Decode(value interface{}) (interface{}, error) {
+	str, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("expected a string, not %T", value)
+	}
+
+	return time.Parse(time.RFC3339Nano, str)
+}
+
+// bytesCodec stores a []byte as a base64 string.
+type bytesCodec struct{}
+
+func (bytesCodec) ShadowType() string {
+	return "bytes"
+}
+
+func (bytesCodec) Encode(value interface{}) (interface{}, error) {
+	b, ok := value.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("expected a []byte, not %T", value)
+	}
+
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+func (bytesCodec) Decode(value interface{}) (interface{}, error) {
+	str, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("expected a base64 string, not %T", value)
+	}
+
+	return base64.StdEncoding.DecodeString(str)
+}
@@ -0,0 +1,170 @@
+package gizmo
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jmataya/gizmo/testutils"
+)
+
+type Money struct {
+	Currency string
+	Amount   int64
+}
+
+type moneyCodec struct{}
+
+func (moneyCodec) ShadowType() string {
+	return "money"
+}
+
+func (moneyCodec) Encode(value interface{}) (interface{}, error) {
+	money, ok := value.(Money)
+	if !ok {
+		return nil, fmt.Errorf("expected Money, not %T", value)
+	}
+
+	return map[string]interface{}{
+		"currency": money.Currency,
+		"amount":   money.Amount,
+	}, nil
+}
+
+func (moneyCodec) Decode(value interface{}) (interface{}, error) {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected an object, not %T", value)
+	}
+
+	currency, ok := obj["currency"].(string)
+	if !ok {
+		return nil, errors.New("expected a currency")
+	}
+
+	amount, err := integerValue(obj["amount"])
+	if err != nil {
+		return nil, err
+	}
+
+	return Money{Currency: currency, Amount: amount}, nil
+}
+
+func init() {
+	if err := RegisterAttributeCodec(Money{}, moneyCodec{}); err != nil {
+		panic(err)
+	}
+}
+
+type otherMoneyCodec struct {
+	moneyCodec
+}
+
+func (otherMoneyCodec) ShadowType() string {
+	return "other_money"
+}
+
+type Price Money
+
+func TestRegisterAttributeCodec(t *testing.T) {
+	var tests = []struct {
+		prototype interface{}
+		codec     AttributeCodec
+		wantErr   string
+	}{
+		{Money{}, otherMoneyCodec{}, "A codec is already registered for gizmo.Money"},
+		{Price{}, moneyCodec{}, "Shadow type money is already registered to gizmo.Money"},
+		{time.Time{}, timeCodec{}, "A codec is already registered for time.Time"},
+		{nil, moneyCodec{}, "Prototype must be non-nil"},
+		{Price{}, nil, "Codec must be non-nil"},
+	}
+
+	for _, test := range tests {
+		err := RegisterAttributeCodec(test.prototype, test.codec)
+		if errorMsg(err) != test.wantErr {
+			t.Errorf("RegisterAttributeCodec(%T) = %s, want %s", test.prototype, errorMsg(err), test.wantErr)
+		}
+	}
+}
+
+func TestEncodeAttribute(t *testing.T) {
+	price := Money{Currency: "USD", Amount: 1299}
+	stamp := time.Date(2017, 4, 9, 22, 17, 3, 0, time.UTC)
+
+	var tests = []struct {
+		value interface{}
+		want  interface{}
+	}{
+		{price, map[string]interface{}{"currency": "USD", "amount": int64(1299)}},
+		{&price, map[string]interface{}{"currency": "USD", "amount": int64(1299)}},
+		{(*Money)(nil), nil},
+		{stamp, "2017-04-09T22:17:03Z"},
+		{[]byte("fragile"), "ZnJhZ2lsZQ=="},
+		{"plain", "plain"},
+	}
+
+	for _, test := range tests {
+		got, err := encodeAttribute("test", reflect.ValueOf(test.value))
+		if err != nil {
+			t.Errorf("encodeAttribute(%v) returned error %s", test.value, err.Error())
+		} else if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("encodeAttribute(%v) = %v, want %v", test.value, got, test.want)
+		}
+	}
+}
+
+func TestDecodeAttribute_Codec(t *testing.T) {
+	assert := testutils.NewAssert(t)
+
+	encoded := map[string]interface{}{"currency": "USD", "amount": float64(1299)}
+
+	var price Money
+	if err := decodeAttribute("price", "money", encoded, reflect.ValueOf(&price).Elem()); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(Money{Currency: "USD", Amount: 1299}, price)
+
+	var salePrice *Money
+	if err := decodeAttribute("salePrice", "money", encoded, reflect.ValueOf(&salePrice).Elem()); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(Money{Currency: "USD", Amount: 1299}, *salePrice)
+
+	custom, err := decodeCustomAttribute("price", "money", encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(Money{Currency: "USD", Amount: 1299}, custom)
+
+	err = decodeAttribute("price", "money", "12.99", reflect.ValueOf(&price).Elem())
+	assert.Equal("Unable to decode attribute price of type money into gizmo.Money: expected an object, not string", errorMsg(err))
+}
+
+func TestEncodeAttribute_Structured(t *testing.T) {
+	stamp := time.Date(2017, 4, 9, 22, 17, 3, 0, time.UTC)
+
+	var tests = []struct {
+		value   interface{}
+		want    interface{}
+		wantErr string
+	}{
+		{[]string{"red", "wool"}, []interface{}{"red", "wool"}, ""},
+		{[]string(nil), nil, ""},
+		{[2]int{1, 2}, []interface{}{1, 2}, ""},
+		{map[string]time.Time{"shipped": stamp}, map[string]interface{}{"shipped": "2017-04-09T22:17:03Z"}, ""},
+		{dimensions{Width: 2, Height: 3.5}, map[string]interface{}{"width": 2.0, "h": 3.5}, ""},
+		{[]*dimensions{nil}, []interface{}{nil}, ""},
+		{map[int]string{1: "one"}, nil, "Unable to encode attribute test of type map[int]string: map keys must be strings, not int"},
+	}
+
+	for _, test := range tests {
+		got, err := encodeAttribute("test", reflect.ValueOf(test.value))
+		if errorMsg(err) != test.wantErr {
+			t.Errorf("encodeAttribute(%v) = %s, want %s", test.value, errorMsg(err), test.wantErr)
+		} else if test.wantErr == "" && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("encodeAttribute(%v) = %#v, want %#v", test.value, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package common
+
+import (
+	"database/sql"
+	"sync"
+)
+
+// StmtCache is a DB that prepares each query once and reuses the statement
+// every time the same query is prepared again. The statements are prepared on
+// each connection of the pool the first time they run on it, so a worker
+// prepares as many statements as it has distinct queries and connections,
+// however many queries it runs.
+//
+// The statements belong to the cache, and are closed when the cache is
+// closed. Callers must release them with CloseStmt rather than closing them.
+type StmtCache struct {
+	db *sql.DB
+
+	mu    sync.Mutex
+	stmts map[string]*sql.Stmt
+}
+
+// NewStmtCache creates a StmtCache that prepares statements on db.
+func NewStmtCache(db *sql.DB) *StmtCache {
+	return &StmtCache{db: db, stmts: map[string]*sql.Stmt{}}
+}
+
+// Prepare returns the statement for query, preparing it if it isn't cached.
+// The lock isn't held while the statement is prepared, because that waits
+// for a connection, which may be held by a transaction that is looking up a
+// statement.
+func (c *StmtCache) Prepare(query string) (*sql.Stmt, error) {
+	if stmt, ok := c.lookup(query); ok {
+		return stmt, nil
+	}
+
+	stmt, err := c.db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cached, ok := c.stmts[query]; ok {
+		stmt.Close()
+		return cached, nil
+	}
+
+	c.stmts[query] = stmt
+	return stmt, nil
+}
+
+func (c *StmtCache) lookup(query string) (*sql.Stmt, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stmt, ok := c.stmts[query]
+	return stmt, ok
+}
+
+// Tx creates a cache of the statements that run in tx. They are derived from
+// the statements of the StmtCache, so they reuse the statements that are
+// already prepared on the connection of the transaction.
+func (c *StmtCache) Tx(tx *sql.Tx) *TxStmtCache {
+	return &TxStmtCache{cache: c, tx: tx, stmts: map[string]*sql.Stmt{}}
+}
+
+// Close closes every statement in the cache.
+func (c *StmtCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var firstErr error
+	for query, stmt := range c.stmts {
+		if err := stmt.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+
+		delete(c.stmts, query)
+	}
+
+	return firstErr
+}
+
+func (c *StmtCache) ownsStatements() {}
+
+// TxStmtCache is a DB that caches the statements of a transaction. The
+// statements are closed when the transaction is committed or rolled back, so
+// a TxStmtCache can't be used afterwards, except to call Done.
+type TxStmtCache struct {
+	cache  *StmtCache
+	tx     *sql.Tx
+	stmts  map[string]*sql.Stmt
+	missed []string
+}
+
+// Prepare returns the statement for query within the transaction, preparing
+// it if it isn't cached. Statements that the StmtCache doesn't have yet are
+// prepared on the connection of the transaction, since preparing them on the
+// pool needs another connection, which never comes if the transaction holds
+// the last one.
+func (c *TxStmtCache) Prepare(query string) (*sql.Stmt, error) {
+	if stmt, ok := c.stmts[query]; ok {
+		return stmt, nil
+	}
+
+	var stmt *sql.Stmt
+	if cached, ok := c.cache.lookup(query); ok {
+		stmt = c.tx.Stmt(cached)
+	} else {
+		prepared, err := c.tx.Prepare(query)
+		if err != nil {
+			return nil, err
+		}
+
+		stmt = prepared
+		c.missed = append(c.missed, query)
+	}
+
+	c.stmts[query] = stmt
+	return stmt, nil
+}
+
+// Done adds the statements that the transaction had to prepare itself to the
+// StmtCache, so that later transactions reuse them. It must be called after
+// the transaction is committed or rolled back, when its connection is back in
+// the pool. Statements that can't be prepared are left out of the cache. Done
+// does nothing on a nil TxStmtCache, so transactions without a cache can call
+// it too.
+func (c *TxStmtCache) Done() {
+	if c == nil {
+		return
+	}
+
+	for _, query := range c.missed {
+		c.cache.Prepare(query)
+	}
+
+	c.missed = nil
+}
+
+func (c *TxStmtCache) ownsStatements() {}
+
+// stmtOwner is implemented by the DBs that keep the statements that they
+// prepare open for reuse.
+type stmtOwner interface {
+	ownsStatements()
+}
+
+// CloseStmt releases a statement that was prepared with db. The statement is
+// closed, unless it belongs to a cache that reuses it.
+func CloseStmt(db DB, stmt *sql.Stmt) error {
+	if _, ok := db.(stmtOwner); ok {
+		return nil
+	}
+
+	return stmt.Close()
+}
@@ -0,0 +1,169 @@
+package common
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "common.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Exec("CREATE TABLE items (id integer primary key, name text)"); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestStmtCache(t *testing.T) {
+	db := openTestDB(t)
+	cache := NewStmtCache(db)
+
+	insert, err := cache.Prepare("INSERT INTO items (name) VALUES (?)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if again, err := cache.Prepare("INSERT INTO items (name) VALUES (?)"); err != nil {
+		t.Fatal(err)
+	} else if again != insert {
+		t.Error("Expected the statement to be reused")
+	}
+
+	if other, err := cache.Prepare("SELECT name FROM items WHERE id = ?"); err != nil {
+		t.Fatal(err)
+	} else if other == insert {
+		t.Error("Expected a different query to get its own statement")
+	}
+
+	// Statements of the cache are only closed when the cache is closed.
+	if err := CloseStmt(cache, insert); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := insert.Exec("Fox Socks"); err != nil {
+		t.Errorf("Expected the cached statement to stay open, got %v", err)
+	}
+
+	if err := cache.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := insert.Exec("Fox Socks"); err == nil {
+		t.Error("Expected closing the cache to close its statements")
+	}
+
+	if again, err := cache.Prepare("INSERT INTO items (name) VALUES (?)"); err != nil {
+		t.Fatal(err)
+	} else if again == insert {
+		t.Error("Expected a closed cache to prepare the statement again")
+	}
+}
+
+func TestTxStmtCache(t *testing.T) {
+	db := openTestDB(t)
+	cache := NewStmtCache(db)
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txCache := cache.Tx(tx)
+	insert, err := txCache.Prepare("INSERT INTO items (name) VALUES (?)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if again, err := txCache.Prepare("INSERT INTO items (name) VALUES (?)"); err != nil {
+		t.Fatal(err)
+	} else if again != insert {
+		t.Error("Expected the statement to be reused within the transaction")
+	}
+
+	if _, err := insert.Exec("Fox Socks"); err != nil {
+		t.Fatal(err)
+	}
+	if err := CloseStmt(txCache, insert); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The statement of the cache outlives the transaction.
+	stmt, err := cache.Prepare("INSERT INTO items (name) VALUES (?)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stmt.Exec("Bear Socks"); err != nil {
+		t.Fatal(err)
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM items").Scan(&count); err != nil {
+		t.Fatal(err)
+	} else if count != 2 {
+		t.Errorf("Expected 2 items, got %d", count)
+	}
+}
+
+func TestCloseStmt(t *testing.T) {
+	db := openTestDB(t)
+
+	stmt, err := db.Prepare("SELECT name FROM items WHERE id = ?")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CloseStmt(db, stmt); err != nil {
+		t.Fatal(err)
+	}
+
+	var name string
+	if err := stmt.QueryRow(1).Scan(&name); err == nil || err == sql.ErrNoRows {
+		t.Errorf("Expected a statement that wasn't cached to be closed, got %v", err)
+	}
+}
+
+func TestTxStmtCache_SingleConnection(t *testing.T) {
+	db := openTestDB(t)
+	db.SetMaxOpenConns(1)
+	cache := NewStmtCache(db)
+
+	for round := 0; round < 2; round++ {
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		txCache := cache.Tx(tx)
+		insert, err := txCache.Prepare("INSERT INTO items (name) VALUES (?)")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := insert.Exec("Fox Socks"); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		txCache.Done()
+
+		if _, ok := cache.lookup("INSERT INTO items (name) VALUES (?)"); !ok {
+			t.Error("Expected the statement of the transaction to be cached once it's done")
+		}
+	}
+}
+
+func TestTxStmtCache_DoneWithoutCache(t *testing.T) {
+	var txCache *TxStmtCache
+	txCache.Done()
+}
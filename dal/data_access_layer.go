@@ -1,46 +1,116 @@
+// Package dal is the data access layer of gizmo. It runs the SQL of the
+// models against a common.DB, which is either a connection pool, a
+// transaction, or a cache of prepared statements.
+//
+// A DataAccessLayer accumulates the first error that occurs, and every
+// operation after it is skipped, so that a sequence of queries only has to be
+// checked once, with Result:
+//
+//	d := dal.NewDataAccessLayer(db)
+//	d.ValidateInsert(head)
+//	d.Scan(d.QueryRow(sqlInsertEntityHead, head.RootID, head.ViewID, head.VersionID), newHead.columns()...)
+//	return newHead, d.Result()
 package dal
 
 import (
 	"database/sql"
 	"fmt"
+	"reflect"
 
 	"github.com/jmataya/gizmo/common"
 )
 
+const (
+	// General error messages.
+	errNoInsertHasPrimaryKey = "%s has a primary key and cannot be inserted"
+
+	// Query error messages.
+	errFieldMustBeGreaterThanZero = "%s must be greater than zero"
+	errUnableToPrepare            = "Unable to prepare statement %s with error %s"
+)
+
+// Scanner is a row of the result of a query. It is implemented by *sql.Row
+// and *sql.Rows.
+type Scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// DataAccessLayer runs queries against a database until one of them fails.
+// The statements that it prepares are reused for the same query, and are
+// released by Result, so a DataAccessLayer is meant for a single operation.
 type DataAccessLayer struct {
-	db  common.DB
-	err error
+	db    common.DB
+	err   error
+	stmts map[string]*sql.Stmt
+	rows  []*sql.Rows
 }
 
+// NewDataAccessLayer creates a DataAccessLayer that runs queries against db.
 func NewDataAccessLayer(db common.DB) *DataAccessLayer {
-	return &DataAccessLayer{db: db}
+	return &DataAccessLayer{db: db, stmts: map[string]*sql.Stmt{}}
 }
 
+// Fail records err as the error of the DataAccessLayer, unless an error
+// occurred already.
+func (d *DataAccessLayer) Fail(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+}
+
+// ValidateInsert checks that model is valid and doesn't have a primary key.
 func (d *DataAccessLayer) ValidateInsert(model Model) {
-	if err := model.Validate(); err != n
-	d.err = model.Validate()
+	if d.err != nil {
+		return
+	}
+
+	if err := model.Validate(); err != nil {
+		d.err = err
+	} else if model.Identifier() != 0 {
+		d.err = fmt.Errorf(errNoInsertHasPrimaryKey, modelName(model))
+	}
 }
 
-func (d *DataAccessLayer) Query(query string, args ...interface{}) *sql.Row {
-	stmt := d.prepare(query)
-	return d.stmtQueryRow(stmt, args...)
+// ValidateUpdate checks that model is valid and has a primary key.
+func (d *DataAccessLayer) ValidateUpdate(model Model) {
+	if d.err != nil {
+		return
+	}
+
+	if err := model.Validate(); err != nil {
+		d.err = err
+	} else {
+		d.ValidateIdentifier(model)
+	}
 }
 
-func (d *DataAccessLayer) prepare(query string) *sql.Stmt {
+// ValidateIdentifier checks that model has a primary key.
+func (d *DataAccessLayer) ValidateIdentifier(model Model) {
+	if d.err == nil && model.Identifier() == 0 {
+		d.err = fmt.Errorf(errFieldMustBeGreaterThanZero, "ID")
+	}
+}
+
+// Exec runs a query that doesn't return rows.
+func (d *DataAccessLayer) Exec(query string, args ...interface{}) sql.Result {
+	stmt := d.prepare(query)
 	if d.err != nil {
 		return nil
 	}
 
-	stmt, err := d.db.Prepare(query)
+	result, err := stmt.Exec(args...)
 	if err != nil {
-		d.err = fmt.Errorf("Unable to prepare statement %s with error %s", query, err.Error())
+		d.err = err
 		return nil
 	}
 
-	return stmt
+	return result
 }
 
-func (d *DataAccessLayer) stmtQueryRow(stmt *sql.Stmt, args ...interface{}) *sql.Row {
+// QueryRow runs a query that returns at most one row, which is read with
+// Scan.
+func (d *DataAccessLayer) QueryRow(query string, args ...interface{}) *sql.Row {
+	stmt := d.prepare(query)
 	if d.err != nil {
 		return nil
 	}
@@ -48,6 +118,26 @@ func (d *DataAccessLayer) stmtQueryRow(stmt *sql.Stmt, args ...interface{}) *sql
 	return stmt.QueryRow(args...)
 }
 
+// Query runs a query that returns rows, which are read with ScanRows. The
+// rows are closed by ScanRows or, at the latest, by Result.
+func (d *DataAccessLayer) Query(query string, args ...interface{}) *sql.Rows {
+	stmt := d.prepare(query)
+	if d.err != nil {
+		return nil
+	}
+
+	rows, err := stmt.Query(args...)
+	if err != nil {
+		d.err = err
+		return nil
+	}
+
+	d.rows = append(d.rows, rows)
+	return rows
+}
+
+// Scan copies the columns of a row that was returned by QueryRow into dest.
+// If there is no row, the error is sql.ErrNoRows.
 func (d *DataAccessLayer) Scan(row *sql.Row, dest ...interface{}) {
 	if d.err != nil {
 		return
@@ -56,6 +146,65 @@ func (d *DataAccessLayer) Scan(row *sql.Row, dest ...interface{}) {
 	d.err = row.Scan(dest...)
 }
 
+// ScanRows calls scan for every row that was returned by Query, until scan
+// returns an error, and closes the rows.
+func (d *DataAccessLayer) ScanRows(rows *sql.Rows, scan func(row Scanner) error) {
+	if d.err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			d.err = err
+			return
+		}
+	}
+
+	d.err = rows.Err()
+}
+
+// Result releases the statements and rows of the DataAccessLayer and returns
+// the first error that occurred.
 func (d *DataAccessLayer) Result() error {
+	for _, rows := range d.rows {
+		rows.Close()
+	}
+	d.rows = nil
+
+	for query, stmt := range d.stmts {
+		common.CloseStmt(d.db, stmt)
+		delete(d.stmts, query)
+	}
+
 	return d.err
 }
+
+func (d *DataAccessLayer) prepare(query string) *sql.Stmt {
+	if d.err != nil {
+		return nil
+	}
+
+	if stmt, ok := d.stmts[query]; ok {
+		return stmt
+	}
+
+	stmt, err := d.db.Prepare(query)
+	if err != nil {
+		d.err = fmt.Errorf(errUnableToPrepare, query, err.Error())
+		return nil
+	}
+
+	d.stmts[query] = stmt
+	return stmt
+}
+
+// modelName is the name of the type of a Model, for error messages.
+func modelName(model Model) string {
+	modelType := reflect.TypeOf(model)
+	if modelType.Kind() == reflect.Ptr {
+		modelType = modelType.Elem()
+	}
+
+	return modelType.Name()
+}
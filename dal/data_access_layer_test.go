@@ -0,0 +1,183 @@
+package dal
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmataya/gizmo/common"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type item struct {
+	ID   int64
+	Name string
+}
+
+func (i item) Identifier() int64 {
+	return i.ID
+}
+
+func (i item) Validate() error {
+	if i.Name == "" {
+		return errors.New("Name must be non-empty")
+	}
+
+	return nil
+}
+
+func openTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "dal.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Exec("CREATE TABLE items (id integer primary key, name text not null unique)"); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestDataAccessLayer_Validate(t *testing.T) {
+	var tests = []struct {
+		name     string
+		validate func(d *DataAccessLayer)
+		want     string
+	}{
+		{"Insert", func(d *DataAccessLayer) { d.ValidateInsert(item{Name: "Fox Socks"}) }, ""},
+		{"Insert invalid", func(d *DataAccessLayer) { d.ValidateInsert(item{}) }, "Name must be non-empty"},
+		{"Insert with key", func(d *DataAccessLayer) { d.ValidateInsert(item{ID: 1, Name: "Fox Socks"}) }, "item has a primary key and cannot be inserted"},
+		{"Insert pointer with key", func(d *DataAccessLayer) { d.ValidateInsert(&item{ID: 1, Name: "Fox Socks"}) }, "item has a primary key and cannot be inserted"},
+		{"Update", func(d *DataAccessLayer) { d.ValidateUpdate(item{ID: 1, Name: "Fox Socks"}) }, ""},
+		{"Update invalid", func(d *DataAccessLayer) { d.ValidateUpdate(item{ID: 1}) }, "Name must be non-empty"},
+		{"Update without key", func(d *DataAccessLayer) { d.ValidateUpdate(item{Name: "Fox Socks"}) }, "ID must be greater than zero"},
+		{"Identifier", func(d *DataAccessLayer) { d.ValidateIdentifier(item{}) }, "ID must be greater than zero"},
+	}
+
+	for _, test := range tests {
+		d := NewDataAccessLayer(openTestDB(t))
+		test.validate(d)
+
+		got := ""
+		if err := d.Result(); err != nil {
+			got = err.Error()
+		}
+
+		if got != test.want {
+			t.Errorf("%s: Result() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestDataAccessLayer_Queries(t *testing.T) {
+	db := openTestDB(t)
+
+	d := NewDataAccessLayer(db)
+	for _, name := range []string{"Fox Socks", "Bear Socks", "Wolf Socks"} {
+		d.Exec("INSERT INTO items (name) VALUES (?)", name)
+	}
+
+	var found item
+	d.Scan(d.QueryRow("SELECT id, name FROM items WHERE name = ?", "Bear Socks"), &found.ID, &found.Name)
+
+	names := []string{}
+	d.ScanRows(d.Query("SELECT name FROM items ORDER BY id"), func(row Scanner) error {
+		var name string
+		if err := row.Scan(&name); err != nil {
+			return err
+		}
+
+		names = append(names, name)
+		return nil
+	})
+
+	if err := d.Result(); err != nil {
+		t.Fatal(err)
+	}
+
+	if found.ID != 2 || found.Name != "Bear Socks" {
+		t.Errorf("Expected item 2 named Bear Socks, got %+v", found)
+	}
+	if len(names) != 3 || names[0] != "Fox Socks" || names[2] != "Wolf Socks" {
+		t.Errorf("Expected the names of every item, got %v", names)
+	}
+}
+
+func TestDataAccessLayer_AccumulatesErrors(t *testing.T) {
+	db := openTestDB(t)
+
+	d := NewDataAccessLayer(db)
+	d.Exec("INSERT INTO items (name) VALUES (?)", "Fox Socks")
+	d.Exec("INSERT INTO items (name) VALUES (?)", "Fox Socks")
+	d.Exec("INSERT INTO items (name) VALUES (?)", "Bear Socks")
+
+	var name string
+	d.Scan(d.QueryRow("SELECT name FROM items WHERE id = ?", 1), &name)
+
+	scanned := false
+	d.ScanRows(d.Query("SELECT name FROM items"), func(row Scanner) error {
+		scanned = true
+		return nil
+	})
+
+	if err := d.Result(); err == nil {
+		t.Fatal("Expected inserting a duplicate name to fail")
+	}
+
+	if name != "" || scanned {
+		t.Error("Expected the queries after the error to be skipped")
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM items").Scan(&count); err != nil {
+		t.Fatal(err)
+	} else if count != 1 {
+		t.Errorf("Expected 1 item, got %d", count)
+	}
+}
+
+func TestDataAccessLayer_NoRows(t *testing.T) {
+	d := NewDataAccessLayer(openTestDB(t))
+
+	var name string
+	d.Scan(d.QueryRow("SELECT name FROM items WHERE id = ?", 1), &name)
+
+	if err := d.Result(); err != sql.ErrNoRows {
+		t.Errorf("Result() = %v, want %v", err, sql.ErrNoRows)
+	}
+}
+
+func TestDataAccessLayer_ReleasesStatements(t *testing.T) {
+	db := openTestDB(t)
+	cache := common.NewStmtCache(db)
+
+	cached, err := cache.Prepare("INSERT INTO items (name) VALUES (?)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDataAccessLayer(cache)
+	d.Exec("INSERT INTO items (name) VALUES (?)", "Fox Socks")
+	if err := d.Result(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Statements that belong to a cache stay open for reuse.
+	if _, err := cached.Exec("Bear Socks"); err != nil {
+		t.Errorf("Expected the cached statement to stay open, got %v", err)
+	}
+
+	d = NewDataAccessLayer(db)
+	d.Exec("INSERT INTO items (name) VALUES (?)", "Wolf Socks")
+	stmt := d.stmts["INSERT INTO items (name) VALUES (?)"]
+	if err := d.Result(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := stmt.Exec("Lynx Socks"); err == nil {
+		t.Error("Expected the statement to be closed by Result")
+	}
+}
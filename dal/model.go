@@ -1,5 +1,7 @@
 package dal
 
+// Model is a record that is stored in its own row and identified by a
+// primary key, which is zero until the Model is inserted.
 type Model interface {
 	Identifier() int64
 	Validate() error
@@ -0,0 +1,376 @@
+package gizmo
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// decodeAttribute converts a value read from an ObjectForm into the Go type of
+// dest and sets it. The shadow type of the attribute is used to interpret the
+// value when dest does not determine its type, such as an interface{} field.
+func decodeAttribute(name string, attrType string, value interface{}, dest reflect.Value) error {
+	if err := decodeValue(attrType, value, dest); err != nil {
+		return fmt.Errorf("Unable to decode attribute %s of type %s into %v: %s", name, attrType, dest.Type(), err.Error())
+	}
+
+	return nil
+}
+
+// decodeCustomAttribute converts a value read from an ObjectForm into the Go
+// value that best represents its shadow type, for attributes that don't map
+// to a field.
+func decodeCustomAttribute(name string, attrType string, value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	goType := shadowGoType(attrType)
+	if goType.Kind() == reflect.Interface {
+		return normalizeNumbers(value), nil
+	}
+
+	// Unsigned values are saved as int, but the ones above math.MaxInt64
+	// don't fit in an int64, so they are decoded as uint64 instead.
+	if v, ok := value.(json.Number); ok && attrType == "int" {
+		if u, err := strconv.ParseUint(v.String(), 10, 64); err == nil && u > math.MaxInt64 {
+			return u, nil
+		}
+	}
+
+	dest := reflect.New(goType).Elem()
+	if err := decodeAttribute(name, attrType, value, dest); err != nil {
+		return nil, err
+	}
+
+	return dest.Interface(), nil
+}
+
+func decodeValue(attrType string, value interface{}, dest reflect.Value) error {
+	if dest.Kind() == reflect.Ptr {
+		if value == nil {
+			dest.Set(reflect.Zero(dest.Type()))
+			return nil
+		}
+
+		elem := reflect.New(dest.Type().Elem())
+		if err := decodeValue(attrType, value, elem.Elem()); err != nil {
+			return err
+		}
+
+		dest.Set(elem)
+		return nil
+	}
+
+	if value == nil {
+		dest.Set(reflect.Zero(dest.Type()))
+		return nil
+	}
+
+	if codec, ok := codecForType(dest.Type()); ok {
+		return decodeWithCodec(codec, value, dest)
+	}
+
+	switch dest.Kind() {
+	case reflect.Interface:
+		if dest.NumMethod() == 0 {
+			custom, err := decodeCustomAttribute("", attrType, value)
+			if err != nil {
+				return err
+			}
+
+			if custom != nil {
+				dest.Set(reflect.ValueOf(custom))
+			}
+
+			return nil
+		}
+	case reflect.Bool:
+		b, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("expected a bool, not %T", value)
+		}
+
+		dest.SetBool(b)
+		return nil
+	case reflect.String:
+		str, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("expected a string, not %T", value)
+		}
+
+		dest.SetString(str)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := integerValue(value)
+		if err != nil {
+			return err
+		} else if dest.OverflowInt(i) {
+			return fmt.Errorf("%d overflows %v", i, dest.Type())
+		}
+
+		dest.SetInt(i)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := unsignedValue(value, dest.Type())
+		if err != nil {
+			return err
+		} else if dest.OverflowUint(u) {
+			return fmt.Errorf("%d overflows %v", u, dest.Type())
+		}
+
+		dest.SetUint(u)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, err := floatValue(value)
+		if err != nil {
+			return err
+		} else if dest.OverflowFloat(f) {
+			return fmt.Errorf("%v overflows %v", f, dest.Type())
+		}
+
+		dest.SetFloat(f)
+		return nil
+	case reflect.Slice:
+		list, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("expected a list, not %T", value)
+		}
+
+		slice := reflect.MakeSlice(dest.Type(), len(list), len(list))
+		if err := decodeList(attrType, list, slice); err != nil {
+			return err
+		}
+
+		dest.Set(slice)
+		return nil
+	case reflect.Array:
+		list, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("expected a list, not %T", value)
+		} else if len(list) > dest.Len() {
+			return fmt.Errorf("list of length %d overflows %v", len(list), dest.Type())
+		}
+
+		dest.Set(reflect.Zero(dest.Type()))
+		return decodeList(attrType, list, dest)
+	case reflect.Map:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("expected an object, not %T", value)
+		} else if dest.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("map keys must be strings, not %v", dest.Type().Key())
+		}
+
+		elemType := dest.Type().Elem()
+		elemShadow := elementShadowType(attrType, "map", elemType)
+		decoded := reflect.MakeMapWithSize(dest.Type(), len(obj))
+		for key, elemValue := range obj {
+			elem := reflect.New(elemType).Elem()
+			if err := decodeValue(elemShadow, elemValue, elem); err != nil {
+				return fmt.Errorf("key %s: %s", key, err.Error())
+			}
+
+			decoded.SetMapIndex(reflect.ValueOf(key).Convert(dest.Type().Key()), elem)
+		}
+
+		dest.Set(decoded)
+		return nil
+	case reflect.Struct:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("expected an object, not %T", value)
+		}
+
+		dest.Set(reflect.Zero(dest.Type()))
+		for i := 0; i < dest.NumField(); i++ {
+			field := dest.Type().Field(i)
+			if !fieldIsPublic(field) || field.Anonymous {
+				continue
+			}
+
+			tag, err := parseFieldTag(field)
+			if err != nil {
+				return err
+			} else if tag.skip {
+				continue
+			}
+
+			fieldValue, ok := obj[tag.name]
+			if !ok {
+				continue
+			}
+
+			if err := decodeValue(typeName(field.Type), fieldValue, dest.Field(i)); err != nil {
+				return fmt.Errorf("field %s: %s", tag.name, err.Error())
+			}
+		}
+
+		return nil
+	}
+
+	val := reflect.ValueOf(normalizeNumbers(value))
+	if !val.Type().AssignableTo(dest.Type()) {
+		return fmt.Errorf("can't assign %v", val.Type())
+	}
+
+	dest.Set(val)
+	return nil
+}
+
+// decodeList decodes the elements of a list into a slice or array that is
+// at least as long as the list.
+func decodeList(attrType string, list []interface{}, dest reflect.Value) error {
+	elemShadow := elementShadowType(attrType, "list", dest.Type().Elem())
+	for index, elemValue := range list {
+		if err := decodeValue(elemShadow, elemValue, dest.Index(index)); err != nil {
+			return fmt.Errorf("index %d: %s", index, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// elementShadowType gets the shadow type of the elements of a list or map
+// type, such as string for list<string>. If the shadow type isn't of the
+// container, the type is derived from the Go type of the elements instead.
+func elementShadowType(attrType string, container string, elemType reflect.Type) string {
+	if elem, ok := parameterizedShadowType(attrType, container); ok {
+		return elem
+	}
+
+	return typeName(elemType)
+}
+
+// parameterizedShadowType extracts the parameter from a shadow type such as
+// list<string> or map<list<int>>.
+func parameterizedShadowType(attrType string, container string) (string, bool) {
+	prefix := container + "<"
+	if !strings.HasPrefix(attrType, prefix) || !strings.HasSuffix(attrType, ">") {
+		return "", false
+	}
+
+	return attrType[len(prefix) : len(attrType)-1], true
+}
+
+// shadowGoType gets the Go type that best represents a shadow type. Shadow
+// types without a more specific Go type, such as object, are represented by
+// interface{}.
+func shadowGoType(attrType string) reflect.Type {
+	if goType, ok := typeForShadow(attrType); ok {
+		return goType
+	} else if elem, ok := parameterizedShadowType(attrType, "list"); ok {
+		return reflect.SliceOf(shadowGoType(elem))
+	} else if elem, ok := parameterizedShadowType(attrType, "map"); ok {
+		return reflect.MapOf(reflect.TypeOf(""), shadowGoType(elem))
+	}
+
+	switch attrType {
+	case "int":
+		return reflect.TypeOf(int64(0))
+	case "float":
+		return reflect.TypeOf(float64(0))
+	case "bool":
+		return reflect.TypeOf(false)
+	case "string":
+		return reflect.TypeOf("")
+	default:
+		return reflect.TypeOf((*interface{})(nil)).Elem()
+	}
+}
+
+// integerValue converts a JSON number into an integer, rejecting numbers with
+// a fractional part and numbers that overflow int64.
+func integerValue(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case json.Number:
+		i, err := v.Int64()
+		if err == nil {
+			return i, nil
+		} else if numErr, ok := err.(*strconv.NumError); ok && numErr.Err == strconv.ErrRange {
+			return 0, fmt.Errorf("%s overflows int64", v)
+		}
+
+		// Integers may also be written with an exponent or a zero fraction,
+		// such as 1e3 or 12.0.
+		f, err := v.Float64()
+		if err != nil {
+			return 0, err
+		}
+
+		return integerValue(f)
+	case float64:
+		// math.MaxInt64 rounds up to 2^63 as a float64, so the upper bound is
+		// exclusive.
+		if v != math.Trunc(v) || v >= 1<<63 || v < math.MinInt64 {
+			return 0, fmt.Errorf("%v is not an integer", v)
+		}
+
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case int:
+		return int64(v), nil
+	default:
+		return 0, fmt.Errorf("expected a number, not %T", value)
+	}
+}
+
+// unsignedValue converts a JSON number into an unsigned integer. JSON numbers
+// are parsed as unsigned first, since values above math.MaxInt64 don't fit in
+// the integer that integerValue returns. Negative numbers overflow destType.
+func unsignedValue(value interface{}, destType reflect.Type) (uint64, error) {
+	if v, ok := value.(json.Number); ok {
+		if u, err := strconv.ParseUint(v.String(), 10, 64); err == nil {
+			return u, nil
+		}
+	}
+
+	i, err := integerValue(value)
+	if err != nil {
+		return 0, err
+	} else if i < 0 {
+		return 0, fmt.Errorf("%d overflows %v", i, destType)
+	}
+
+	return uint64(i), nil
+}
+
+// floatValue converts a JSON number into a float.
+func floatValue(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case json.Number:
+		return v.Float64()
+	case float64:
+		return v, nil
+	case int64:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	default:
+		return 0, fmt.Errorf("expected a number, not %T", value)
+	}
+}
+
+// normalizeNumbers converts the JSON numbers in a decoded value to float64,
+// which is how encoding/json represents numbers without a known type.
+func normalizeNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for index, elem := range v {
+			v[index] = normalizeNumbers(elem)
+		}
+	case map[string]interface{}:
+		for key, elem := range v {
+			v[key] = normalizeNumbers(elem)
+		}
+	}
+
+	return value
+}
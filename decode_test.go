@@ -0,0 +1,165 @@
+package gizmo
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type decodeTarget struct {
+	Int     int
+	Int8    int8
+	Int64   int64
+	Uint    uint32
+	Uint64  uint64
+	Float32 float32
+	Bool    bool
+	String  string
+	Time    time.Time
+	Bytes   []byte
+	Pointer *int64
+	Any     interface{}
+	Tags    []string
+	Stock   map[string]int
+	Corners [2]int
+	Size    dimensions
+	Sizes   []*dimensions
+}
+
+type dimensions struct {
+	Width  float64
+	Height float64 `json:"h"`
+}
+
+func TestDecodeAttribute(t *testing.T) {
+	created := time.Date(2017, 4, 9, 22, 17, 3, 0, time.UTC)
+	pointer := int64(42)
+
+	var tests = []struct {
+		field    string
+		attrType string
+		value    interface{}
+		want     interface{}
+		wantErr  string
+	}{
+		{"Int", "int", json.Number("12"), 12, ""},
+		{"Int", "int", 12.0, 12, ""},
+		{"Int", "int", json.Number("12.5"), nil, "Unable to decode attribute Int of type int into int: 12.5 is not an integer"},
+		{"Int", "int", "12", nil, "Unable to decode attribute Int of type int into int: expected a number, not string"},
+		{"Int64", "int", json.Number("9223372036854775807"), int64(math.MaxInt64), ""},
+		{"Int64", "int", json.Number("9223372036854775808"), nil, "Unable to decode attribute Int64 of type int into int64: 9223372036854775808 overflows int64"},
+		{"Int64", "int", json.Number("-9223372036854775809"), nil, "Unable to decode attribute Int64 of type int into int64: -9223372036854775809 overflows int64"},
+		{"Int64", "int", 9223372036854775808.0, nil, "Unable to decode attribute Int64 of type int into int64: 9.223372036854776e+18 is not an integer"},
+		{"Int64", "int", json.Number("1e3"), int64(1000), ""},
+		{"Int8", "int", json.Number("300"), nil, "Unable to decode attribute Int8 of type int into int8: 300 overflows int8"},
+		{"Uint", "int", json.Number("7"), uint32(7), ""},
+		{"Uint", "int", json.Number("-7"), nil, "Unable to decode attribute Uint of type int into uint32: -7 overflows uint32"},
+		{"Uint", "int", json.Number("4294967296"), nil, "Unable to decode attribute Uint of type int into uint32: 4294967296 overflows uint32"},
+		{"Uint64", "int", json.Number("18446744073709551615"), uint64(math.MaxUint64), ""},
+		{"Uint64", "int", 12.0, uint64(12), ""},
+		{"Float32", "float", json.Number("1.5"), float32(1.5), ""},
+		{"Bool", "bool", true, true, ""},
+		{"String", "string", "socks", "socks", ""},
+		{"String", "string", true, nil, "Unable to decode attribute String of type string into string: expected a string, not bool"},
+		{"Time", "time", "2017-04-09T22:17:03Z", created, ""},
+		{"Bytes", "bytes", "c29ja3M=", []byte("socks"), ""},
+		{"Pointer", "int", json.Number("42"), &pointer, ""},
+		{"Pointer", "int", nil, (*int64)(nil), ""},
+		{"Any", "int", json.Number("42"), int64(42), ""},
+		{"Any", "time", "2017-04-09T22:17:03Z", created, ""},
+		{"Any", "string", "socks", "socks", ""},
+		{"Any", "list<int>", []interface{}{json.Number("1"), json.Number("2")}, []int64{1, 2}, ""},
+		{"Any", "map<list<string>>", map[string]interface{}{"colors": []interface{}{"red"}}, map[string][]string{"colors": {"red"}}, ""},
+		{"Any", "object", map[string]interface{}{"width": json.Number("2")}, map[string]interface{}{"width": 2.0}, ""},
+		{"Tags", "list<string>", []interface{}{"red", "wool"}, []string{"red", "wool"}, ""},
+		{"Tags", "list<string>", nil, []string(nil), ""},
+		{"Tags", "list<string>", []interface{}{"red", 1.0}, nil, "Unable to decode attribute Tags of type list<string> into []string: index 1: expected a string, not float64"},
+		{"Tags", "list<string>", "red", nil, "Unable to decode attribute Tags of type list<string> into []string: expected a list, not string"},
+		{"Stock", "map<int>", map[string]interface{}{"small": json.Number("3")}, map[string]int{"small": 3}, ""},
+		{"Corners", "list<int>", []interface{}{1.0, 2.0}, [2]int{1, 2}, ""},
+		{"Corners", "list<int>", []interface{}{1.0, 2.0, 3.0}, nil, "Unable to decode attribute Corners of type list<int> into [2]int: list of length 3 overflows [2]int"},
+		{"Size", "object", map[string]interface{}{"width": 2.0, "h": json.Number("3.5")}, dimensions{Width: 2, Height: 3.5}, ""},
+		{"Size", "object", map[string]interface{}{"width": "wide"}, nil, "Unable to decode attribute Size of type object into gizmo.dimensions: field width: expected a number, not string"},
+		{"Sizes", "list<object>", []interface{}{map[string]interface{}{"width": 1.0}, nil}, []*dimensions{{Width: 1}, nil}, ""},
+	}
+
+	for _, test := range tests {
+		var target decodeTarget
+		field := reflect.ValueOf(&target).Elem().FieldByName(test.field)
+
+		err := decodeAttribute(test.field, test.attrType, test.value, field)
+		if errorMsg(err) != test.wantErr {
+			t.Errorf("decodeAttribute(%s, %v) = %s, want %s", test.field, test.value, errorMsg(err), test.wantErr)
+			continue
+		}
+
+		if test.wantErr != "" {
+			continue
+		}
+
+		if got := field.Interface(); !reflect.DeepEqual(got, reflect.ValueOf(test.want).Convert(field.Type()).Interface()) {
+			t.Errorf("decodeAttribute(%s, %v) = %#v, want %#v", test.field, test.value, got, test.want)
+		}
+	}
+}
+
+func TestDecodeCustomAttribute(t *testing.T) {
+	var tests = []struct {
+		attrType string
+		value    interface{}
+		want     interface{}
+		wantErr  string
+	}{
+		{"int", json.Number("12"), int64(12), ""},
+		{"int", json.Number("-12"), int64(-12), ""},
+		{"int", json.Number("9223372036854775808"), uint64(1 << 63), ""},
+		{"int", json.Number("18446744073709551615"), uint64(math.MaxUint64), ""},
+		{"int", json.Number("18446744073709551616"), nil, "Unable to decode attribute custom of type int into int64: 18446744073709551616 overflows int64"},
+		{"float", json.Number("1.5"), 1.5, ""},
+		{"any", json.Number("18446744073709551615"), 18446744073709551615.0, ""},
+	}
+
+	for _, test := range tests {
+		got, err := decodeCustomAttribute("custom", test.attrType, test.value)
+		if errorMsg(err) != test.wantErr {
+			t.Errorf("decodeCustomAttribute(%s, %v) = %s, want %s", test.attrType, test.value, errorMsg(err), test.wantErr)
+		} else if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("decodeCustomAttribute(%s, %v) = %#v, want %#v", test.attrType, test.value, got, test.want)
+		}
+	}
+}
+
+func TestTypeName(t *testing.T) {
+	var pointer *float32
+
+	var tests = []struct {
+		value interface{}
+		want  string
+	}{
+		{int8(1), "int"},
+		{uint64(1), "int"},
+		{float32(1), "float"},
+		{true, "bool"},
+		{"socks", "string"},
+		{time.Now(), "time"},
+		{[]byte("socks"), "bytes"},
+		{pointer, "float"},
+		{Money{}, "money"},
+		{&Money{}, "money"},
+		{Blob{}, "blob"},
+		{[]Blob{}, "list<blob>"},
+		{[]string{}, "list<string>"},
+		{[2]int{}, "list<int>"},
+		{map[string][]time.Time{}, "map<list<time>>"},
+		{dimensions{}, "object"},
+		{[]interface{}{}, "list<any>"},
+	}
+
+	for _, test := range tests {
+		if got := typeName(reflect.TypeOf(test.value)); got != test.want {
+			t.Errorf("typeName(%T) = %s, want %s", test.value, got, test.want)
+		}
+	}
+}
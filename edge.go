@@ -0,0 +1,256 @@
+package gizmo
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/jmataya/gizmo/models"
+)
+
+// EdgeObject is embedded in a struct to map a relation with metadata, such as
+// the quantity of a SKU within a bundle. The struct must have exactly one
+// public field that holds the related Entity; all other public fields are
+// stored as metadata on the relation.
+//
+//	type BundleItem struct {
+//		gizmo.EdgeObject
+//
+//		SKU      SKU
+//		Quantity int
+//	}
+type EdgeObject struct {
+	position int
+	metadata map[string]interface{}
+}
+
+// Position is the index of the relation within relations of the same type. It
+// is set when the relation is loaded; on save the index of the edge within its
+// field is used.
+func (e EdgeObject) Position() int {
+	return e.position
+}
+
+// Metadata gets the custom metadata of the relation, which are values that are
+// not mapped to a field of the edge struct.
+func (e EdgeObject) Metadata() map[string]interface{} {
+	return e.metadata
+}
+
+// SetMetadata sets the value of a custom piece of metadata on the relation.
+func (e *EdgeObject) SetMetadata(key string, value interface{}) error {
+	if key == "" {
+		return errors.New("Metadata key must be non-empty")
+	}
+
+	if e.metadata == nil {
+		e.metadata = map[string]interface{}{}
+	}
+
+	e.metadata[key] = value
+	return nil
+}
+
+func (e *EdgeObject) setEdge(position int, metadata map[string]interface{}) {
+	e.position = position
+	e.metadata = metadata
+}
+
+// edgeSetter is implemented by structs that embed EdgeObject.
+type edgeSetter interface {
+	Position() int
+	Metadata() map[string]interface{}
+	setEdge(position int, metadata map[string]interface{})
+}
+
+// isEdge determines whether a type is a struct, or pointer to a struct, that
+// embeds EdgeObject.
+func isEdge(fieldType reflect.Type) bool {
+	if fieldType.Kind() == reflect.Ptr {
+		fieldType = fieldType.Elem()
+	}
+
+	if fieldType.Kind() != reflect.Struct {
+		return false
+	}
+
+	edgeInterface := reflect.TypeOf((*edgeSetter)(nil)).Elem()
+	return reflect.PtrTo(fieldType).Implements(edgeInterface) && !isEntity(fieldType)
+}
+
+// edgeTargetField finds the index of the field in an edge struct that holds
+// the related Entity.
+func edgeTargetField(edgeType reflect.Type) (int, error) {
+	target := -1
+	for i := 0; i < edgeType.NumField(); i++ {
+		field := edgeType.Field(i)
+		if !fieldIsPublic(field) || field.Anonymous || !isEntity(field.Type) {
+			continue
+		}
+
+		if field.Type.Kind() == reflect.Slice {
+			return -1, fmt.Errorf("Edge %v must relate to a single Entity, not %v", edgeType, field.Type)
+		} else if target != -1 {
+			return -1, fmt.Errorf("Edge %v must have exactly one Entity field", edgeType)
+		}
+
+		target = i
+	}
+
+	if target == -1 {
+		return -1, fmt.Errorf("Edge %v must have exactly one Entity field", edgeType)
+	}
+
+	return target, nil
+}
+
+// edgeFromValue converts an Entity or an edge struct into an edge at the
+// specified position.
+func edgeFromValue(value reflect.Value, position int) (models.RelationEdge, error) {
+	if value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return models.RelationEdge{}, errors.New("Unable to relate a nil Entity")
+		}
+
+		value = value.Elem()
+	}
+
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return models.RelationEdge{}, errors.New("Unable to relate a nil Entity")
+		}
+
+		value = value.Elem()
+	}
+
+	if !isEdge(value.Type()) {
+		entity, ok := value.Interface().(Entity)
+		if !ok {
+			return models.RelationEdge{}, errors.New("Cannot convert value to Entity")
+		} else if entity.CommitID() == 0 {
+			return models.RelationEdge{}, fmt.Errorf("Related %v must be saved before it can be related", value.Type())
+		}
+
+		return models.RelationEdge{
+			ID:       entity.CommitID(),
+			Kind:     entityKind(entity),
+			Position: position,
+		}, nil
+	}
+
+	targetIndex, err := edgeTargetField(value.Type())
+	if err != nil {
+		return models.RelationEdge{}, err
+	}
+
+	edge, err := edgeFromValue(value.Field(targetIndex), position)
+	if err != nil {
+		return edge, err
+	}
+
+	metadata := map[string]interface{}{}
+	if value.CanAddr() {
+		if holder, ok := value.Addr().Interface().(edgeSetter); ok {
+			for key, val := range holder.Metadata() {
+				metadata[key] = val
+			}
+		}
+	}
+
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if i == targetIndex || !fieldIsPublic(field) || field.Anonymous {
+			continue
+		}
+
+		tag, err := parseFieldTag(field)
+		if err != nil {
+			return edge, err
+		} else if tag.skip {
+			continue
+		}
+
+		if isEmptyValue(value.Field(i)) {
+			if tag.required {
+				return edge, fmt.Errorf("Metadata %s of %v is required", tag.name, value.Type())
+			} else if tag.omitEmpty {
+				continue
+			}
+		}
+
+		val, err := encodeAttribute(tag.name, value.Field(i))
+		if err != nil {
+			return edge, err
+		}
+
+		metadata[tag.name] = val
+	}
+
+	if len(metadata) > 0 {
+		edge.Metadata = metadata
+	}
+
+	return edge, nil
+}
+
+// setEdgeMetadata sets the position and metadata of an edge on a pointer to an
+// edge struct. Metadata without a matching field is kept as custom metadata.
+func setEdgeMetadata(edgeValue reflect.Value, edge models.RelationEdge) error {
+	elem := edgeValue.Elem()
+	custom := map[string]interface{}{}
+	for key, val := range edge.Metadata {
+		custom[key] = val
+	}
+
+	for i := 0; i < elem.NumField(); i++ {
+		field := elem.Type().Field(i)
+		if !fieldIsPublic(field) || field.Anonymous || isEntity(field.Type) {
+			continue
+		}
+
+		tag, err := parseFieldTag(field)
+		if err != nil {
+			return err
+		} else if tag.skip {
+			continue
+		}
+
+		val, ok := custom[tag.name]
+		if !ok {
+			continue
+		}
+
+		if err := decodeAttribute(tag.name, typeName(field.Type), val, elem.Field(i)); err != nil {
+			return err
+		}
+
+		delete(custom, tag.name)
+	}
+
+	if len(custom) == 0 {
+		custom = nil
+	}
+
+	edgeValue.Interface().(edgeSetter).setEdge(edge.Position, custom)
+	return nil
+}
+
+// isZeroRelation determines whether a single relation field has been left
+// unset, in which case it maps no relation.
+func isZeroRelation(value reflect.Value) bool {
+	if value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		return value.IsNil()
+	}
+
+	if isEdge(value.Type()) {
+		targetIndex, err := edgeTargetField(value.Type())
+		if err != nil {
+			return false
+		}
+
+		return isZeroRelation(value.Field(targetIndex))
+	}
+
+	entity, ok := value.Interface().(Entity)
+	return ok && entity.CommitID() == 0
+}
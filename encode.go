@@ -0,0 +1,110 @@
+package gizmo
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// encodeAttribute converts a value into the value that is stored in an
+// ObjectForm. Values with a registered codec are encoded by it, while nested
+// structs, slices and maps are encoded as JSON objects and arrays.
+func encodeAttribute(name string, value reflect.Value) (interface{}, error) {
+	encoded, err := encodeValue(value)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to encode attribute %s of type %v: %s", name, value.Type(), err.Error())
+	}
+
+	return encoded, nil
+}
+
+func encodeValue(value reflect.Value) (interface{}, error) {
+	if value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return nil, nil
+		}
+
+		return encodeValue(value.Elem())
+	}
+
+	if codec, ok := codecForType(value.Type()); ok {
+		return codec.Encode(value.Interface())
+	}
+
+	switch value.Kind() {
+	case reflect.Slice:
+		if value.IsNil() {
+			return nil, nil
+		}
+
+		return encodeList(value)
+	case reflect.Array:
+		return encodeList(value)
+	case reflect.Map:
+		if value.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("map keys must be strings, not %v", value.Type().Key())
+		} else if value.IsNil() {
+			return nil, nil
+		}
+
+		encoded := make(map[string]interface{}, value.Len())
+		iter := value.MapRange()
+		for iter.Next() {
+			elem, err := encodeValue(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+
+			encoded[iter.Key().String()] = elem
+		}
+
+		return encoded, nil
+	case reflect.Struct:
+		encoded := map[string]interface{}{}
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			if !fieldIsPublic(field) || field.Anonymous {
+				continue
+			}
+
+			tag, err := parseFieldTag(field)
+			if err != nil {
+				return nil, err
+			} else if tag.skip {
+				continue
+			}
+
+			if isEmptyValue(value.Field(i)) {
+				if tag.required {
+					return nil, fmt.Errorf("field %s is required", tag.name)
+				} else if tag.omitEmpty {
+					continue
+				}
+			}
+
+			elem, err := encodeValue(value.Field(i))
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %s", tag.name, err.Error())
+			}
+
+			encoded[tag.name] = elem
+		}
+
+		return encoded, nil
+	default:
+		return value.Interface(), nil
+	}
+}
+
+func encodeList(value reflect.Value) (interface{}, error) {
+	encoded := make([]interface{}, value.Len())
+	for i := 0; i < value.Len(); i++ {
+		elem, err := encodeValue(value.Index(i))
+		if err != nil {
+			return nil, err
+		}
+
+		encoded[i] = elem
+	}
+
+	return encoded, nil
+}
@@ -3,6 +3,7 @@ package gizmo
 import (
 	"errors"
 	"fmt"
+	"sort"
 )
 
 // Entity is the most basic structure in the library. It represents an
@@ -34,6 +35,14 @@ type Entity interface {
 	// RelationsByEntity gets all of the associations between this Entity and an
 	// Entity of a specified type.
 	RelationsByEntity(entityType string) ([]int64, error)
+
+	// Edges gets all of the relations to other Entities, along with the
+	// position and metadata of each relation.
+	Edges() map[string][]Edge
+
+	// EdgesByEntity gets all of the relations between this Entity and an Entity
+	// of a specified type, along with the position and metadata of each.
+	EdgesByEntity(entityType string) ([]Edge, error)
 }
 
 // EntityUpdater is the interface for modifying the contents of an Entity.
@@ -72,6 +81,30 @@ type EntityUpdater interface {
 	// RemoveRelation deletes a mapping between this Entity and another Entity.
 	// If the mapping did not previously exist, an error is thrown.
 	RemoveRelation(entityType string, entityID int64) error
+
+	// SetEdge creates or updates a mapping between this Entity and another
+	// existing Entity, including its position and metadata. It replaces every
+	// edge to the same Entity; use SetEdges to keep several edges to it.
+	SetEdge(entityType string, edge Edge) error
+
+	// SetEdges overwrites an Entity's relations, including their metadata.
+	SetEdges(edges map[string][]Edge)
+}
+
+// Edge is a single relation from an Entity to a version of another Entity.
+type Edge struct {
+	// ID is the commit ID of the related Entity.
+	ID int64
+
+	// Kind is the kind of the related Entity.
+	Kind string
+
+	// Position is the index of the relation within relations of the same type.
+	Position int
+
+	// Metadata is arbitrary data that describes the relation, such as the
+	// quantity of an item in a bundle.
+	Metadata map[string]interface{}
 }
 
 // EntityObject is the default implementation of the Entity interface.
@@ -83,6 +116,16 @@ type EntityObject struct {
 	kind       string
 	attributes map[string]interface{}
 	relations  map[string][]int64
+	edgeData   map[string][]edgeData
+}
+
+// edgeData holds the parts of an Edge that aren't tracked by the relations.
+// It is kept by the position of the relation rather than by ID, since an
+// Entity may have several edges to the same version. Relations past the end
+// of the edgeData of their type have no kind or metadata.
+type edgeData struct {
+	kind     string
+	metadata map[string]interface{}
 }
 
 // Identifier is the unique ID of the Entity object across all Views.
@@ -257,9 +300,11 @@ func (c *EntityObject) SetRelation(entityType string, entityID int64) error {
 	return nil
 }
 
-// SetRelations overwrites an Entity's relations.
+// SetRelations overwrites an Entity's relations. Any metadata previously set
+// on the relations is discarded.
 func (c *EntityObject) SetRelations(relations map[string][]int64) {
 	c.relations = relations
+	c.edgeData = nil
 }
 
 // UpdateRelation updates the ID of a mapping between this Entity and another
@@ -322,9 +367,141 @@ func (c *EntityObject) RemoveRelation(entityType string, entityID int64) error {
 			ids = ids[:len(ids)-1]
 
 			c.relations[entityType] = ids
+			if data := c.edgeData[entityType]; index < len(data) {
+				c.edgeData[entityType] = append(data[:index:index], data[index+1:]...)
+			}
 			return nil
 		}
 	}
 
 	return fmt.Errorf("Mapping to %d of type %s is not found", entityID, entityType)
 }
+
+// Edges gets all of the relations to other Entities, along with the position
+// and metadata of each relation.
+func (c EntityObject) Edges() map[string][]Edge {
+	edges := map[string][]Edge{}
+	for entityType := range c.relations {
+		edges[entityType], _ = c.EdgesByEntity(entityType)
+	}
+
+	return edges
+}
+
+// EdgesByEntity gets all of the relations between this Entity and an Entity of
+// a specified type, along with the position and metadata of each.
+func (c EntityObject) EdgesByEntity(entityType string) ([]Edge, error) {
+	ids, err := c.RelationsByEntity(entityType)
+	if err != nil {
+		return nil, err
+	}
+
+	edges := make([]Edge, len(ids))
+	for index, id := range ids {
+		data := c.edgeDataAt(entityType, index)
+		edges[index] = Edge{
+			ID:       id,
+			Kind:     data.kind,
+			Position: index,
+			Metadata: data.metadata,
+		}
+	}
+
+	return edges, nil
+}
+
+// SetEdge creates or updates a mapping between this Entity and another existing
+// Entity. Edges are replaced by ID: every existing edge to edge.ID, along with
+// its metadata, is removed, so SetEdge collapses duplicate edges to the same
+// version into one. Use SetEdges to keep several edges to the same version.
+//
+// The edge is moved to its Position within the relations of the same type; a
+// negative or out of range Position places it at the end.
+func (c *EntityObject) SetEdge(entityType string, edge Edge) error {
+	if entityType == "" {
+		return errors.New("Entity type must be non-empty")
+	} else if edge.ID < 1 {
+		return errors.New("Entity ID must be greater than 0")
+	}
+
+	if c.relations == nil {
+		c.relations = map[string][]int64{}
+	}
+
+	ids := []int64{}
+	data := []edgeData{}
+	for index, id := range c.relations[entityType] {
+		if id != edge.ID {
+			ids = append(ids, id)
+			data = append(data, c.edgeDataAt(entityType, index))
+		}
+	}
+
+	position := edge.Position
+	if position < 0 || position > len(ids) {
+		position = len(ids)
+	}
+
+	ids = append(ids, 0)
+	copy(ids[position+1:], ids[position:])
+	ids[position] = edge.ID
+	c.relations[entityType] = ids
+
+	data = append(data, edgeData{})
+	copy(data[position+1:], data[position:])
+	data[position] = edgeData{kind: edge.Kind, metadata: edge.Metadata}
+	c.setEdgeData(entityType, data)
+	return nil
+}
+
+// SetEdges overwrites an Entity's relations, including their metadata. Edges
+// are ordered by their Position.
+func (c *EntityObject) SetEdges(edges map[string][]Edge) {
+	c.relations = map[string][]int64{}
+	c.edgeData = nil
+
+	for entityType, typeEdges := range edges {
+		sorted := make([]Edge, len(typeEdges))
+		copy(sorted, typeEdges)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return sorted[i].Position < sorted[j].Position
+		})
+
+		ids := make([]int64, len(sorted))
+		data := make([]edgeData, len(sorted))
+		for index, edge := range sorted {
+			ids[index] = edge.ID
+			data[index] = edgeData{kind: edge.Kind, metadata: edge.Metadata}
+		}
+
+		c.relations[entityType] = ids
+		c.setEdgeData(entityType, data)
+	}
+}
+
+// edgeDataAt gets the kind and metadata of the relation at index within the
+// relations of entityType.
+func (c EntityObject) edgeDataAt(entityType string, index int) edgeData {
+	if data := c.edgeData[entityType]; index < len(data) {
+		return data[index]
+	}
+
+	return edgeData{}
+}
+
+// setEdgeData sets the kind and metadata of the relations of entityType. It
+// is left out when none of the relations have any.
+func (c *EntityObject) setEdgeData(entityType string, data []edgeData) {
+	for _, d := range data {
+		if d.kind != "" || len(d.metadata) > 0 {
+			if c.edgeData == nil {
+				c.edgeData = map[string][]edgeData{}
+			}
+
+			c.edgeData[entityType] = data
+			return
+		}
+	}
+
+	delete(c.edgeData, entityType)
+}
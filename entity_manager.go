@@ -2,171 +2,1033 @@ package gizmo
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"reflect"
 	"strings"
 	"unicode"
 	"unicode/utf8"
 
-	"github.com/jmataya/gizmo/dal"
 	"github.com/jmataya/gizmo/models"
-	"github.com/gedex/inflector"
+	"github.com/jmataya/gizmo/store"
 	_ "github.com/lib/pq" // Needed to allow database/sql to use Postgres.
 	log "github.com/sirupsen/logrus"
 )
 
-const (
-	gizmoTag = "gizmo"
-	jsonTag  = "json"
-)
-
 // EntityManager is the interface for creating, managing, and deleting Entity.
 type EntityManager interface {
 	// Find retrieves the most recent version of a Entity object within a View.
 	Find(id int64, viewID int64, out Entity) error
 
-	// FindByCommit retrieves a Entity object at a specific commit. This will
-	// retrieve the entire object, including all associated objects, as of that
-	// commit. None of the parameters are modified, including the type hint.
-	FindByCommit(commitID int64, typeHint Entity) (Entity, error)
+	// Load retrieves the most recent version of a Entity object within a View
+	// into a new value of the type registered for the Entity's kind. Kinds
+	// that aren't registered are loaded as a GenericEntity.
+	Load(id int64, viewID int64) (Entity, error)
+
+	// FindByCommit retrieves a Entity object at a specific commit. This will
+	// retrieve the entire object, including all associated objects, as of that
+	// commit. None of the parameters are modified, including the type hint.
+	// If the type hint is nil, the type registered for the Entity's kind is
+	// used, or GenericEntity if the kind isn't registered.
+	FindByCommit(commitID int64, typeHint Entity) (Entity, error)
+
+	// Create saves a new Entity object as a new entity and returns the created
+	// version of the object back. If the ID, Entity ID, or Commit ID of the
+	// Entity object have previously been set, they will be ignored.
+	Create(toCreate Entity, viewID int64) (Entity, error)
+
+	// Update modifies a previously saved Entity object. The new version will be
+	// branched from the Entity's Commit ID, and will use the ID and View ID to
+	// save in the appropriate format. If the object has not previously been saved
+	// the method will error. If nothing changed since the Entity was loaded,
+	// nothing is written and the current version is returned. If only its
+	// relations changed, the new version reuses the existing content.
+	Update(toUpdate Entity) (Entity, error)
+
+	// Patch applies a partial edit to the most recent version of an Entity
+	// within a View and saves the result as a new version. The patch is either
+	// a JSON Merge Patch (RFC 7386) object or a JSON Patch (RFC 6902) array,
+	// and applies to the illuminated JSON encoding of the Entity, as produced
+	// by GenericEntity. The result is saved like an Update, so it is validated
+	// against the type registered for the Entity's kind and its schema.
+	//
+	// The patch can't change the ID, View ID, or kind of the Entity. If it
+	// changes the commit_id to anything other than the most recent version,
+	// ErrVersionConflict is returned, which allows a JSON Patch to test that
+	// the Entity wasn't modified since it was loaded.
+	Patch(id int64, viewID int64, patch []byte) (Entity, error)
+
+	// Delete performs a soft-delete on a Entity object. This must occur at the
+	// most recent commit, so the Entity is identified by the ID and View ID.
+	Delete(id int64, viewID int64) error
+
+	// DefineSchema saves a new version of the schema of a kind and returns it
+	// with its version set. Entities of the kind that are created or updated
+	// afterwards are validated against it, and a ValidationError listing every
+	// violation is returned when they don't conform.
+	DefineSchema(schema Schema) (Schema, error)
+
+	// FindSchema retrieves the most recent version of the schema of a kind. If
+	// the kind has no schema, ErrSchemaNotFound is returned.
+	FindSchema(kind string) (Schema, error)
+
+	// PutBlob stores the content read from r in the BlobStore and returns a
+	// Blob that refers to it, which can then be saved as an attribute of an
+	// Entity. Entities can only be saved with Blobs whose content is stored.
+	PutBlob(r io.Reader, mediaType string) (Blob, error)
+
+	// OpenBlob opens the content of a Blob for reading. If the content isn't
+	// stored, ErrBlobNotFound is returned.
+	OpenBlob(blob Blob) (io.ReadCloser, error)
+
+	// WriteBlob writes the content of a Blob to w and returns the number of
+	// bytes that were written. An error is returned if the content doesn't
+	// match the size and digest of the Blob.
+	WriteBlob(w io.Writer, blob Blob) (int64, error)
+}
+
+var (
+	// ErrEntityNotFound is returned when an Entity does not exist in a View.
+	ErrEntityNotFound = errors.New("Entity not found")
+
+	// ErrVersionConflict is returned when an Entity is updated from a commit
+	// that is no longer the most recent commit in its View.
+	ErrVersionConflict = errors.New("Entity has been modified since it was loaded")
+)
+
+// Option configures optional behavior of an EntityManager.
+type Option func(*defaultEntityManager)
+
+// WithPropagation enables propagation of updates to parent Entities. When an
+// Entity is updated, every live Entity in the same View that relates to the
+// previous version gets a new version pointing at the updated one. Parents
+// are updated transitively in the same transaction as the original update.
+func WithPropagation() Option {
+	return func(d *defaultEntityManager) {
+		d.propagate = true
+	}
+}
+
+// WithBlobStore sets the BlobStore that the content of Blobs is kept in. By
+// default, content is kept in the database.
+func WithBlobStore(store BlobStore) Option {
+	return func(d *defaultEntityManager) {
+		d.blobs = store
+	}
+}
+
+// WithLogger sets the logger that the EntityManager logs its operations to. By
+// default, they are logged to the standard logrus logger. It is also accepted
+// by RegisterKind, Migrate, and MigrateAttributeRefs.
+func WithLogger(logger log.FieldLogger) Option {
+	return func(d *defaultEntityManager) {
+		d.logger = logger
+	}
+}
+
+// loggerOf gets the logger that is set by opts with WithLogger, for the
+// functions that accept Options without creating an EntityManager.
+func loggerOf(opts []Option) log.FieldLogger {
+	d := &defaultEntityManager{logger: log.StandardLogger()}
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	return d.logger
+}
+
+// NewEntityManager connects a PostgreSQL database with the supplied connection
+// parameters and returns the created EntityManager. The EntityManager reuses
+// the statements that it prepares until db is closed, so create a single
+// EntityManager for a database rather than one per request.
+func NewEntityManager(db *sql.DB, opts ...Option) EntityManager {
+	return newPostgresEntityManager(db, store.NewPostgresStore(db), opts)
+}
+
+// newPostgresEntityManager creates an EntityManager that keeps Entities in s
+// and the content of Blobs in db, unless another BlobStore is set.
+func newPostgresEntityManager(db *sql.DB, s store.Store, opts []Option) *defaultEntityManager {
+	blobs := &postgresBlobStore{db: db}
+	opts = append([]Option{WithBlobStore(blobs)}, opts...)
+	mgr := NewEntityManagerWithStore(s, opts...).(*defaultEntityManager)
+
+	// The logger is only known once every option is applied.
+	blobs.logger = mgr.logger
+	return mgr
+}
+
+// NewEntityManagerWithStore creates an EntityManager that keeps Entities in
+// the supplied Store. Blobs can only be used if a BlobStore is set with
+// WithBlobStore.
+func NewEntityManagerWithStore(s store.Store, opts ...Option) EntityManager {
+	mgr := &defaultEntityManager{store: s, logger: log.StandardLogger()}
+	for _, opt := range opts {
+		opt(mgr)
+	}
+
+	return mgr
+}
+
+type defaultEntityManager struct {
+	store     store.Store
+	propagate bool
+	blobs     BlobStore
+	logger    log.FieldLogger
+}
+
+func (d *defaultEntityManager) Find(id int64, viewID int64, out Entity) error {
+	d.logger.Debugf("Finding Entity with ID=%d in View=%d", id, viewID)
+	head, err := d.store.FindHead(id, viewID)
+	if err == store.ErrNotFound {
+		return ErrEntityNotFound
+	} else if err != nil {
+		return err
+	}
+
+	version, err := d.store.FindVersion(head.VersionID)
+	if err != nil {
+		return err
+	}
+
+	if err := d.loadVersion(d.store, version, out); err != nil {
+		return err
+	}
+
+	// FIX ME: Wrap this in an object, don't do a crappy typecast.
+	entityUpdater := out.(EntityUpdater)
+	if err := entityUpdater.SetIdentifier(head.RootID); err != nil {
+		return err
+	}
+
+	return entityUpdater.SetViewID(head.ViewID)
+}
+
+func (d *defaultEntityManager) Load(id int64, viewID int64) (Entity, error) {
+	root, err := d.store.FindRoot(id)
+	if err == store.ErrNotFound {
+		return nil, ErrEntityNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	d.logger.Debugf("Loading Entity with ID=%d of kind %s", id, root.Kind)
+	entity := newEntityOfKind(d.logger, root.Kind)
+	if err := d.Find(id, viewID, entity); err != nil {
+		return nil, err
+	}
+
+	return entity, nil
+}
+
+func (d *defaultEntityManager) FindByCommit(commitID int64, typeHint Entity) (Entity, error) {
+	d.logger.Debugf("Finding Entity at commit %d", commitID)
+	version, err := d.store.FindVersion(commitID)
+	if err == store.ErrNotFound {
+		return nil, ErrEntityNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var entity Entity
+	if typeHint == nil {
+		entity = newEntityOfKind(d.logger, version.Kind)
+	} else if entity, err = newEntityOfType(typeHint); err != nil {
+		return nil, err
+	}
+
+	if err := d.loadVersion(d.store, version, entity); err != nil {
+		return nil, err
+	}
+
+	return entity, nil
+}
+
+func (d *defaultEntityManager) Create(toCreate Entity, viewID int64) (Entity, error) {
+	d.logger.Debugln("Starting a transaction for creation")
+	tx, err := d.store.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	d.logger.Debugln("Converting Entity properties to FullObject")
+	fullObject, err := entityToFull(d.logger, toCreate, nil)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	d.logger.Debugln("Getting relations from Entity")
+	relations, err := relationsFromEntity(d.logger, toCreate)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	d.logger.Debugln("Validating the Entity against its schema")
+	if err := validateAgainstSchema(tx, *fullObject, relations); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := d.checkBlobs(*fullObject); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	d.logger.Debugln("Insert the FullObject")
+	newFullObject, err := store.InsertFullObject(d.logger, tx, *fullObject)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	d.logger.Debugln("Insert the EntityRoot")
+	root := models.EntityRoot{Kind: fullObject.Form.Kind}
+	newRoot, err := tx.InsertRoot(root)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	d.logger.Debugf("Inserted EntityRoot with ID=%d", newRoot.ID)
+
+	d.logger.Debugln("Insert the EntityVersion")
+	version := models.EntityVersion{
+		RootID:          newRoot.ID,
+		ContentCommitID: newFullObject.Commit.ID,
+		Kind:            newFullObject.Form.Kind,
+		Relations:       relations,
+	}
+	newVersion, err := tx.InsertVersion(version)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	d.logger.Debugf("Inserted EntityVersion with ID=%d", newVersion.ID)
+
+	d.logger.Debugln("Insert the EntityHead")
+	head := models.EntityHead{
+		RootID:    newRoot.ID,
+		ViewID:    viewID,
+		VersionID: newVersion.ID,
+	}
+
+	newHead, err := tx.InsertHead(head)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	d.logger.Debugf("Inserted EntityHead with ID=%d", newHead.ID)
+
+	createdEntity, err := d.savedEntity(tx, toCreate, newFullObject, newVersion, newHead)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return createdEntity, tx.Commit()
+}
+
+func (d *defaultEntityManager) Update(toUpdate Entity) (Entity, error) {
+	if toUpdate.Identifier() == 0 || toUpdate.CommitID() == 0 || toUpdate.ViewID() == 0 {
+		return nil, errors.New("Entity must be saved before it can be updated")
+	}
+
+	d.logger.Debugln("Starting a transaction for update")
+	tx, err := d.store.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := d.update(tx, toUpdate)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return updated, tx.Commit()
+}
+
+func (d *defaultEntityManager) update(tx store.Tx, toUpdate Entity) (Entity, error) {
+	d.logger.Debugf("Locking EntityHead for ID=%d in View=%d", toUpdate.Identifier(), toUpdate.ViewID())
+	head, err := tx.FindHeadForUpdate(toUpdate.Identifier(), toUpdate.ViewID())
+	if err == store.ErrNotFound {
+		return nil, ErrEntityNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	if head.VersionID != toUpdate.CommitID() {
+		return nil, ErrVersionConflict
+	}
+
+	previous, err := tx.FindVersion(head.VersionID)
+	if err != nil {
+		return nil, err
+	}
+
+	previousFull, err := tx.FindFullObject(previous.ContentCommitID)
+	if err != nil {
+		return nil, err
+	}
+
+	d.logger.Debugln("Converting Entity properties to FullObject")
+	fullObject, err := entityToFull(d.logger, toUpdate, &previousFull)
+	if err != nil {
+		return nil, err
+	}
+
+	if fullObject.Form.Kind != previous.Kind {
+		return nil, fmt.Errorf("Unable to change kind of Entity from %s to %s", previous.Kind, fullObject.Form.Kind)
+	}
+
+	d.logger.Debugln("Getting relations from Entity")
+	relations, err := relationsFromEntity(d.logger, toUpdate)
+	if err != nil {
+		return nil, err
+	}
+
+	// An Entity can only be updated from the most recent version, so that
+	// version is the state the Entity was loaded in. Only what changed since
+	// then is written.
+	unchangedContent, err := sameContent(d.logger, *fullObject, previousFull)
+	if err != nil {
+		return nil, err
+	}
+
+	unchangedRelations, err := sameRelations(relations, previous.Relations)
+	if err != nil {
+		return nil, err
+	}
+
+	if unchangedContent && unchangedRelations {
+		d.logger.Debugf("EntityVersion with ID=%d is unchanged, skipping the update", previous.ID)
+		return d.savedEntity(tx, toUpdate, previousFull, previous, head)
+	}
+
+	d.logger.Debugln("Validating the Entity against its schema")
+	if err := validateAgainstSchema(tx, *fullObject, relations); err != nil {
+		return nil, err
+	}
+
+	newFullObject := previousFull
+	if !unchangedContent {
+		if err := d.checkBlobs(*fullObject); err != nil {
+			return nil, err
+		}
+
+		d.logger.Debugln("Insert the FullObject")
+		fullObject.Commit.PreviousID = sql.NullInt64{Int64: previous.ContentCommitID, Valid: true}
+		newFullObject, err = store.InsertFullObject(d.logger, tx, *fullObject)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		d.logger.Debugf("Content is unchanged, reusing ObjectCommit with ID=%d", previousFull.Commit.ID)
+	}
+
+	d.logger.Debugln("Insert the EntityVersion")
+	version := models.EntityVersion{
+		ParentID:        sql.NullInt64{Int64: previous.ID, Valid: true},
+		RootID:          head.RootID,
+		ContentCommitID: newFullObject.Commit.ID,
+		Kind:            newFullObject.Form.Kind,
+		Relations:       relations,
+	}
+	newVersion, err := tx.InsertVersion(version)
+	if err != nil {
+		return nil, err
+	}
+	d.logger.Debugf("Inserted EntityVersion with ID=%d", newVersion.ID)
+
+	d.logger.Debugln("Move the EntityHead")
+	head.VersionID = newVersion.ID
+	newHead, err := tx.UpdateHead(head)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.propagate {
+		d.logger.Debugln("Propagating update to parent Entities")
+		visited := map[int64]bool{}
+		if err := d.propagateToParents(tx, head.ViewID, previous.ID, newVersion.ID, visited); err != nil {
+			return nil, err
+		}
+	}
+
+	return d.savedEntity(tx, toUpdate, newFullObject, newVersion, newHead)
+}
+
+func (d *defaultEntityManager) Patch(id int64, viewID int64, patch []byte) (Entity, error) {
+	d.logger.Debugln("Starting a transaction for patch")
+	tx, err := d.store.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	patched, err := d.patch(tx, id, viewID, patch)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return patched, tx.Commit()
+}
+
+func (d *defaultEntityManager) patch(tx store.Tx, id int64, viewID int64, patch []byte) (Entity, error) {
+	d.logger.Debugf("Locking EntityHead for ID=%d in View=%d", id, viewID)
+	head, err := tx.FindHeadForUpdate(id, viewID)
+	if err == store.ErrNotFound {
+		return nil, ErrEntityNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	version, err := tx.FindVersion(head.VersionID)
+	if err != nil {
+		return nil, err
+	}
+
+	d.logger.Debugln("Loading the illuminated Entity")
+	current := &GenericEntity{}
+	if err := d.loadVersion(tx, version, current); err != nil {
+		return nil, err
+	}
+	if err := current.SetViewID(viewID); err != nil {
+		return nil, err
+	}
+
+	document, err := json.Marshal(current)
+	if err != nil {
+		return nil, err
+	}
+
+	d.logger.Debugln("Applying the patch")
+	patchedDocument, err := applyPatch(document, patch)
+	if err != nil {
+		return nil, err
+	}
+
+	var patched GenericEntity
+	if err := json.Unmarshal(patchedDocument, &patched); err != nil {
+		return nil, &PatchError{Message: err.Error()}
+	}
+
+	if patched.Identifier() != id {
+		return nil, &PatchError{Message: "the id of an Entity can't be changed"}
+	} else if patched.ViewID() != viewID {
+		return nil, &PatchError{Message: "the view_id of an Entity can't be changed"}
+	} else if patched.Kind() != version.Kind {
+		return nil, &PatchError{Message: "the kind of an Entity can't be changed"}
+	} else if patched.CommitID() != version.ID {
+		return nil, ErrVersionConflict
+	}
+
+	// Convert the patched Entity into the type registered for its kind, so
+	// that it's saved exactly as that type would be.
+	d.logger.Debugf("Converting the patched Entity into kind %s", version.Kind)
+	patchedFull, err := entityToFull(d.logger, &patched, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	relations, err := relationsFromEntity(d.logger, &patched)
+	if err != nil {
+		return nil, err
+	}
+
+	toUpdate := newEntityOfKind(d.logger, version.Kind)
+	if err := fullToEntity(d.logger, *patchedFull, toUpdate); err != nil {
+		return nil, err
+	}
+
+	// FIX ME: Wrap this in an object, don't do a crappy typecast.
+	entityUpdater := toUpdate.(EntityUpdater)
+	if err := entityUpdater.SetIdentifier(id); err != nil {
+		return nil, err
+	}
+	if err := entityUpdater.SetCommitID(version.ID); err != nil {
+		return nil, err
+	}
+	if err := entityUpdater.SetViewID(viewID); err != nil {
+		return nil, err
+	}
+
+	entityUpdater.SetEdges(edgesFromRelations(relations))
+	if err := d.loadRelations(tx, relations, toUpdate); err != nil {
+		return nil, err
+	}
+
+	return d.update(tx, toUpdate)
+}
+
+func (d *defaultEntityManager) Delete(id int64, viewID int64) error {
+	d.logger.Debugln("Starting a transaction for deletion")
+	tx, err := d.store.Begin()
+	if err != nil {
+		return err
+	}
+
+	head, err := tx.FindHeadForUpdate(id, viewID)
+	if err == store.ErrNotFound {
+		tx.Rollback()
+		return ErrEntityNotFound
+	} else if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.ArchiveHead(head); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (d *defaultEntityManager) DefineSchema(schema Schema) (Schema, error) {
+	if err := schema.Validate(); err != nil {
+		return Schema{}, err
+	}
+
+	definition, err := json.Marshal(schema)
+	if err != nil {
+		return Schema{}, err
+	}
+
+	model := models.EntitySchema{Kind: schema.Kind, Definition: definition}
+	newModel, err := d.store.InsertSchema(model)
+	if err != nil {
+		return Schema{}, err
+	}
+	d.logger.Debugf("Inserted version %d of the schema of %s", newModel.Version, newModel.Kind)
+
+	return schemaFromModel(newModel)
+}
+
+func (d *defaultEntityManager) FindSchema(kind string) (Schema, error) {
+	return findSchema(d.store, kind)
+}
+
+func (d *defaultEntityManager) PutBlob(r io.Reader, mediaType string) (Blob, error) {
+	blobs, err := d.blobStore()
+	if err != nil {
+		return Blob{}, err
+	}
+
+	digest, size, err := blobs.Put(r)
+	if err != nil {
+		return Blob{}, err
+	}
+
+	d.logger.Debugf("Stored Blob %s with %d bytes", digest, size)
+	return Blob{Digest: digest, Size: size, MediaType: mediaType}, nil
+}
+
+func (d *defaultEntityManager) OpenBlob(blob Blob) (io.ReadCloser, error) {
+	blobs, err := d.blobStore()
+	if err != nil {
+		return nil, err
+	}
+
+	return blobs.Open(blob.Digest)
+}
+
+func (d *defaultEntityManager) WriteBlob(w io.Writer, blob Blob) (int64, error) {
+	content, err := d.OpenBlob(blob)
+	if err != nil {
+		return 0, err
+	}
+	defer content.Close()
+
+	return copyVerifiedBlob(w, content, blob)
+}
+
+// checkBlobs makes sure that the content of every Blob that is about to be
+// saved is stored, so that versions never refer to missing content.
+func (d *defaultEntityManager) checkBlobs(full models.FullObject) error {
+	blobs, err := blobsInContent(d.logger, full)
+	if err != nil {
+		return err
+	}
+
+	if len(blobs) == 0 {
+		return nil
+	}
+
+	blobStore, err := d.blobStore()
+	if err != nil {
+		return err
+	}
+
+	for _, blob := range blobs {
+		size, err := blobStore.Size(blob.Digest)
+		if err == ErrBlobNotFound {
+			return fmt.Errorf("Content of Blob %s is not stored", blob.Digest)
+		} else if err != nil {
+			return err
+		} else if size != blob.Size {
+			return fmt.Errorf("Blob %s has %d bytes, not %d", blob.Digest, size, blob.Size)
+		}
+	}
+
+	return nil
+}
+
+// blobStore gets the BlobStore of the EntityManager, which is only missing
+// when it was created from a Store without WithBlobStore.
+func (d *defaultEntityManager) blobStore() (BlobStore, error) {
+	if d.blobs == nil {
+		return nil, ErrNoBlobStore
+	}
+
+	return d.blobs, nil
+}
+
+func findSchema(db store.Queries, kind string) (Schema, error) {
+	model, err := db.FindLatestSchema(kind)
+	if err == store.ErrNotFound {
+		return Schema{}, ErrSchemaNotFound
+	} else if err != nil {
+		return Schema{}, err
+	}
+
+	return schemaFromModel(model)
+}
+
+// validateAgainstSchema checks the content and relations of an Entity against
+// the most recent schema of its kind. Kinds without a schema aren't validated.
+func validateAgainstSchema(db store.Queries, full models.FullObject, relations models.EntityRelations) error {
+	schema, err := findSchema(db, full.Form.Kind)
+	if err == ErrSchemaNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	relations, err = resolveRelationKinds(db, relations)
+	if err != nil {
+		return err
+	}
+
+	if violations := schema.validate(full, relations); len(violations) > 0 {
+		return &ValidationError{Kind: schema.Kind, Version: schema.Version, Violations: violations}
+	}
+
+	return nil
+}
+
+// resolveRelationKinds returns a copy of the relations in which every edge
+// knows the kind of the version it links to. Edges set by ID alone don't.
+func resolveRelationKinds(db store.Queries, relations models.EntityRelations) (models.EntityRelations, error) {
+	resolved := models.EntityRelations{}
+	for entityType, edges := range relations {
+		resolvedEdges := make([]models.RelationEdge, len(edges))
+		for index, edge := range edges {
+			if edge.Kind == "" {
+				version, err := db.FindVersion(edge.ID)
+				if err != nil {
+					return nil, err
+				}
+
+				edge.Kind = version.Kind
+			}
+
+			resolvedEdges[index] = edge
+		}
+
+		resolved[entityType] = resolvedEdges
+	}
+
+	return resolved, nil
+}
+
+// propagateToParents creates new versions of the live Entities in a View that
+// relate to the version oldID so that they relate to newID instead. Every
+// replaced parent version is propagated in turn.
+func (d *defaultEntityManager) propagateToParents(db store.Queries, viewID int64, oldID int64, newID int64, visited map[int64]bool) error {
+	if visited[oldID] {
+		return nil
+	}
+	visited[oldID] = true
+
+	parents, err := db.FindHeadsByRelation(viewID, oldID)
+	if err != nil {
+		return err
+	}
+
+	for _, parentHead := range parents {
+		parent, err := db.FindVersion(parentHead.VersionID)
+		if err != nil {
+			return err
+		}
+
+		relations, replaced := parent.Relations.ReplaceVersion(oldID, newID)
+		if !replaced {
+			continue
+		}
+
+		version := models.EntityVersion{
+			ParentID:        sql.NullInt64{Int64: parent.ID, Valid: true},
+			RootID:          parentHead.RootID,
+			ContentCommitID: parent.ContentCommitID,
+			Kind:            parent.Kind,
+			Relations:       relations,
+		}
+		newParent, err := db.InsertVersion(version)
+		if err != nil {
+			return err
+		}
+		d.logger.Debugf("Propagated EntityVersion %d to parent EntityVersion %d", newID, newParent.ID)
 
-	// Create saves a new Entity object as a new entity and returns the created
-	// version of the object back. If the ID, Entity ID, or Commit ID of the
-	// Entity object have previously been set, they will be ignored.
-	Create(toCreate Entity, viewID int64) (Entity, error)
+		parentHead.VersionID = newParent.ID
+		if _, err := db.UpdateHead(parentHead); err != nil {
+			return err
+		}
 
-	// Update modifies a previously saved Entity object. The new version will be
-	// branched from the Entity's Commit ID, and will use the ID and View ID to
-	// save in the appropriate format. If the object has not previously been saved
-	// the method will error.
-	Update(toUpdate Entity) (Entity, error)
+		if err := d.propagateToParents(db, viewID, parent.ID, newParent.ID, visited); err != nil {
+			return err
+		}
+	}
 
-	// Delete performs a soft-delete on a Entity object. This must occur at the
-	// most recent commit, so the Entity is identified by the ID and View ID.
-	Delete(id int64, viewID int64) error
+	return nil
 }
 
-// NewEntityManager connects a PostgreSQL database with the supplied connection
-// parameters and returns the created EntityManager.
-func NewEntityManager(db *sql.DB) EntityManager {
-	return &defaultEntityManager{db: db}
-}
+// loadVersion populates an Entity with the content and relations of an
+// EntityVersion. Related Entities that are mapped to fields are loaded as
+// of the commit they are pinned to.
+func (d *defaultEntityManager) loadVersion(db store.Queries, version models.EntityVersion, out Entity) error {
+	full, err := db.FindFullObject(version.ContentCommitID)
+	if err != nil {
+		return err
+	}
 
-type defaultEntityManager struct {
-	db *sql.DB
-}
+	if err := fullToEntity(d.logger, full, out); err != nil {
+		return err
+	}
 
-func (d *defaultEntityManager) Find(id int64, viewID int64, out Entity) error {
-	return errors.New("Not implemented")
-}
+	// FIX ME: Wrap this in an object, don't do a crappy typecast.
+	entityUpdater := out.(EntityUpdater)
+	if err := entityUpdater.SetCommitID(version.ID); err != nil {
+		return err
+	}
 
-func (d *defaultEntityManager) FindByCommit(commitID int64, typeHint Entity) (Entity, error) {
-	return nil, errors.New("Not implemented")
+	if version.RootID != 0 {
+		if err := entityUpdater.SetIdentifier(version.RootID); err != nil {
+			return err
+		}
+	}
+
+	entityUpdater.SetEdges(edgesFromRelations(version.Relations))
+	return d.loadRelations(db, version.Relations, out)
 }
 
-func (d *defaultEntityManager) Create(toCreate Entity, viewID int64) (Entity, error) {
-	log.Debugln("Starting a transaction for creation")
-	tx, err := d.db.Begin()
+func (d *defaultEntityManager) loadRelations(db store.Queries, relations models.EntityRelations, out Entity) error {
+	_, fields, err := extractEntity(d.logger, out)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	log.Debugln("Converting Entity properties to FullObject")
-	fullObject, err := entityToFull(toCreate)
-	if err != nil {
-		return nil, err
+	for _, field := range fields {
+		if !fieldIsPublic(field.Info) || field.Info.Anonymous || !isRelation(field.Info.Type) {
+			continue
+		}
+
+		tag, err := parseFieldTag(field.Info)
+		if err != nil {
+			return err
+		} else if tag.skip {
+			continue
+		}
+
+		relationName := relationKey(field.Info, tag)
+		edges := relations[relationName]
+		d.logger.Debugf("Loading relation %s with edges %v", relationName, edges)
+
+		switch field.Info.Type.Kind() {
+		case reflect.Slice:
+			elems := reflect.MakeSlice(field.Info.Type, 0, len(edges))
+			for _, edge := range edges {
+				elem, err := d.loadRelated(db, edge, field.Info.Type.Elem())
+				if err != nil {
+					return err
+				}
+
+				elems = reflect.Append(elems, elem)
+			}
+
+			field.Value.Set(elems)
+		case reflect.Struct, reflect.Ptr:
+			if len(edges) == 0 {
+				continue
+			} else if len(edges) > 1 {
+				return fmt.Errorf("Unable to load %d relations of type %s into a single field", len(edges), relationName)
+			}
+
+			elem, err := d.loadRelated(db, edges[0], field.Info.Type)
+			if err != nil {
+				return err
+			}
+
+			field.Value.Set(elem)
+		default:
+			return fmt.Errorf("Unexpected relation type %v", field.Info.Type.Kind())
+		}
 	}
 
-	log.Debugln("Insert the FullObject")
-	newFullObject, err := fullObject.Insert(tx)
-	if err != nil {
-		tx.Rollback()
-		return nil, err
+	return nil
+}
+
+// loadRelated loads the target of an edge into a new value of the type
+// fieldType, which is either a struct or a pointer to a struct. When the
+// struct is an edge struct, the target is loaded into its Entity field and
+// the metadata of the edge is set on the other fields.
+func (d *defaultEntityManager) loadRelated(db store.Queries, edge models.RelationEdge, fieldType reflect.Type) (reflect.Value, error) {
+	if fieldType.Kind() == reflect.Interface {
+		return d.loadPolymorphic(db, edge, fieldType)
 	}
 
-	log.Debugln("Getting relations from Entity")
-	relations, err := relationsFromEntity(toCreate)
-	if err != nil {
-		return nil, err
+	elemType := fieldType
+	if fieldType.Kind() == reflect.Ptr {
+		elemType = fieldType.Elem()
 	}
 
-	log.Debugln("Insert the EntityVersion")
-	version := models.EntityVersion{
-		ContentCommitID: newFullObject.Commit.ID,
-		Kind:            newFullObject.Form.Kind,
-		Relations:       relations,
+	related := reflect.New(elemType)
+
+	if isEdge(elemType) {
+		targetIndex, err := edgeTargetField(elemType)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+
+		target, err := d.loadRelated(db, edge, elemType.Field(targetIndex).Type)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+
+		related.Elem().Field(targetIndex).Set(target)
+		if err := setEdgeMetadata(related, edge); err != nil {
+			return reflect.Value{}, err
+		}
+	} else {
+		entity, ok := related.Interface().(Entity)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("Unable to convert %v to Entity", elemType)
+		}
+
+		version, err := db.FindVersion(edge.ID)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+
+		if err := d.loadVersion(db, version, entity); err != nil {
+			return reflect.Value{}, err
+		}
 	}
-	newVersion, err := version.Insert(tx)
-	if err != nil {
-		tx.Rollback()
-		return nil, err
+
+	if fieldType.Kind() == reflect.Ptr {
+		return related, nil
 	}
-	log.Debugf("Inserted EntityVersion with ID=%d", newVersion.ID)
 
-	log.Debugln("Insert the EntityRoot")
-	root := models.EntityRoot{Kind: fullObject.Form.Kind}
-	newRoot, err := dal.InsertEntityRoot(tx, root)
+	return related.Elem(), nil
+}
+
+// loadPolymorphic loads the target of an edge into a field whose type is an
+// interface. The Go type of the target is looked up by its kind, which is
+// stored on the edge, and falls back to GenericEntity.
+func (d *defaultEntityManager) loadPolymorphic(db store.Queries, edge models.RelationEdge, fieldType reflect.Type) (reflect.Value, error) {
+	version, err := db.FindVersion(edge.ID)
 	if err != nil {
-		tx.Rollback()
-		return nil, err
+		return reflect.Value{}, err
 	}
-	log.Debugf("Inserted EntityRoot with ID=%d", newRoot.ID)
 
-	log.Debugln("Insert the EntityHead")
-	head := models.EntityHead{
-		RootID:    newRoot.ID,
-		ViewID:    viewID,
-		VersionID: newVersion.ID,
+	kind := edge.Kind
+	if kind == "" {
+		kind = version.Kind
+	}
+
+	entity := newEntityOfKind(d.logger, kind)
+	if err := d.loadVersion(db, version, entity); err != nil {
+		return reflect.Value{}, err
 	}
 
-	newHead, err := head.Insert(tx)
+	related := reflect.ValueOf(entity)
+	if related.Type().AssignableTo(fieldType) {
+		return related, nil
+	} else if related.Elem().Type().AssignableTo(fieldType) {
+		return related.Elem(), nil
+	}
+
+	return reflect.Value{}, fmt.Errorf("Kind %s of type %v can't be assigned to %v", kind, related.Type(), fieldType)
+}
+
+// savedEntity builds a new Entity of the same type as the template from the
+// saved content and version. Its relation fields are loaded like in Find, so
+// that the Entity can be passed to Update without losing its relations.
+func (d *defaultEntityManager) savedEntity(db store.Queries, template Entity, full models.FullObject, version models.EntityVersion, head models.EntityHead) (Entity, error) {
+	d.logger.Debugln("Convert content back to Entity")
+	entity, err := newEntityOfType(template)
 	if err != nil {
-		tx.Rollback()
 		return nil, err
 	}
-	log.Debugf("Inserted EntityHead with ID=%d", newHead.ID)
 
-	log.Debugln("Convert content back to Entity")
-	entityType := reflect.ValueOf(toCreate).Type().Elem()
-	createdEntity := reflect.New(entityType).Interface().(Entity)
-	if err = fullToEntity(newFullObject, createdEntity); err != nil {
-		tx.Rollback()
+	if err := fullToEntity(d.logger, full, entity); err != nil {
 		return nil, err
 	}
 
 	// FIX ME: Updater should be an object that wraps the entity, not a typecast.
-	entityUpdater := createdEntity.(EntityUpdater)
+	entityUpdater := entity.(EntityUpdater)
 
-	log.Debugln("Setting relations")
+	d.logger.Debugln("Setting relations")
 
-	entityUpdater.SetIdentifier(newRoot.ID)
-	entityUpdater.SetCommitID(newVersion.ID)
-	entityUpdater.SetViewID(viewID)
-	entityUpdater.SetRelations(relations)
+	if err := entityUpdater.SetIdentifier(head.RootID); err != nil {
+		return nil, err
+	}
+	if err := entityUpdater.SetCommitID(version.ID); err != nil {
+		return nil, err
+	}
+	if err := entityUpdater.SetViewID(head.ViewID); err != nil {
+		return nil, err
+	}
+	entityUpdater.SetEdges(edgesFromRelations(version.Relations))
 
-	return createdEntity, tx.Commit()
-}
+	if err := d.loadRelations(db, version.Relations, entity); err != nil {
+		return nil, err
+	}
 
-func (d *defaultEntityManager) Update(toUpdate Entity) (Entity, error) {
-	return nil, errors.New("Not implemented")
+	return entity, nil
 }
 
-func (d *defaultEntityManager) Delete(id int64, viewID int64) error {
-	return errors.New("Not implemented")
+func newEntityOfType(template Entity) (Entity, error) {
+	entityType := reflect.TypeOf(template)
+	if entityType.Kind() == reflect.Ptr {
+		entityType = entityType.Elem()
+	}
+
+	entity, ok := reflect.New(entityType).Interface().(Entity)
+	if !ok {
+		return nil, fmt.Errorf("Unable to create Entity of type %v", entityType)
+	}
+
+	if _, ok := entity.(EntityUpdater); !ok {
+		return nil, fmt.Errorf("Type %v does not implement EntityUpdater", entityType)
+	}
+
+	return entity, nil
 }
 
-func fullToEntity(full models.FullObject, entity Entity) error {
-	log.Debugln("Converting FullObject to Entity")
+func fullToEntity(logger log.FieldLogger, full models.FullObject, entity Entity) error {
+	logger.Debugln("Converting FullObject to Entity")
 
-	log.Debugln("Cataloging available fields on the Entity")
+	logger.Debugln("Cataloging available fields on the Entity")
 	entityFields := make(map[string]string)
 	refEntity := reflect.TypeOf(entity).Elem()
 
 	for i := 0; i < refEntity.NumField(); i++ {
 		field := refEntity.Field(i)
-		log.Debugf(
-			"Field name=%s, type=%s, path=%s",
+		logger.Debugf(
+			"Field name=%s, type=%s, tag=%s, path=%s",
 			field.Name,
 			field.Type,
 			field.Tag,
@@ -175,32 +1037,49 @@ func fullToEntity(full models.FullObject, entity Entity) error {
 		// If PkgPath is not empty, it indicates that the field is private and
 		// therefore one that we can't set. Ignore it. Also ignore embedded fields.
 		// In the future, stop ignoring nested Entity objects.
-		if field.PkgPath != "" || field.Anonymous || isEntity(field.Type) {
-			log.Debugf("Ignoring %s", field.Name)
+		if field.PkgPath != "" || field.Anonymous || isRelation(field.Type) {
+			logger.Debugf("Ignoring %s", field.Name)
 			continue
 		}
 
-		fieldName, err := illuminatedFieldName(field)
+		tag, err := parseFieldTag(field)
 		if err != nil {
 			return err
+		} else if tag.skip {
+			logger.Debugf("Skipping %s", field.Name)
+			continue
 		}
 
-		entityFields[fieldName] = field.Name
+		entityFields[tag.name] = field.Name
 	}
 
-	elem := reflect.ValueOf(entity).Elem()
-	log.Debugln("Decoding attributes on FullObject")
-	for name, attribute := range full.Shadow.Attributes {
-		log.Debugf("Decoding %s", name)
+	attributes, err := illuminatedAttributes(logger, full)
+	if err != nil {
+		return err
+	}
 
-		attrValue, ok := full.Form.Attributes[attribute.Ref]
-		if !ok {
-			return fmt.Errorf("Unable to find Form attribute for %s", name)
-		}
+	elem := reflect.ValueOf(entity).Elem()
+	logger.Debugln("Decoding attributes on FullObject")
+	for name, attribute := range attributes {
+		logger.Debugf("Decoding %s", name)
 
+		attrValue := attribute.Value
 		realName, ok := entityFields[name]
 		if !ok {
-			log.Debugf("Setting custom attribute %s", name)
+			logger.Debugf("Setting custom attribute %s", name)
+			attrValue, err := decodeCustomAttribute(name, attribute.Type, attrValue)
+			if err != nil {
+				return err
+			}
+
+			if typer, ok := entity.(attributeTyper); ok {
+				if err := typer.SetTypedAttribute(name, attribute.Type, attrValue); err != nil {
+					return err
+				}
+
+				continue
+			}
+
 			// FIX ME: Wrap this in an object, don't do a crappy typecast.
 			if err := entity.(EntityUpdater).SetAttribute(name, attrValue); err != nil {
 				return err
@@ -216,7 +1095,9 @@ func fullToEntity(full models.FullObject, entity Entity) error {
 			return fmt.Errorf("Can't set field %s to Entity", name)
 		}
 
-		entityField.Set(reflect.ValueOf(attrValue))
+		if err := decodeAttribute(name, attribute.Type, attrValue, entityField); err != nil {
+			return err
+		}
 	}
 
 	// FIX ME: Wrap this in an object, don't do a crappy typecast.
@@ -236,12 +1117,22 @@ func isEntity(fieldType reflect.Type) bool {
 	}
 }
 
+// isRelation determines whether a field maps relations, either directly to
+// Entities or through edge structs.
+func isRelation(fieldType reflect.Type) bool {
+	if fieldType.Kind() == reflect.Slice {
+		return isRelation(fieldType.Elem())
+	}
+
+	return isEntity(fieldType) || isEdge(fieldType)
+}
+
 type reflectedFields struct {
 	Info  reflect.StructField
 	Value reflect.Value
 }
 
-func extractEntity(entity Entity) (name string, fields []reflectedFields, err error) {
+func extractEntity(logger log.FieldLogger, entity Entity) (name string, fields []reflectedFields, err error) {
 	name = ""
 	fields = []reflectedFields{}
 	err = nil
@@ -250,7 +1141,7 @@ func extractEntity(entity Entity) (name string, fields []reflectedFields, err er
 	entityVal := reflect.ValueOf(entity)
 
 	if entityType.Kind() == reflect.Ptr {
-		log.Debugln("Pointer type detected for entity, getting underlying element")
+		logger.Debugln("Pointer type detected for entity, getting underlying element")
 		entityType = entityType.Elem()
 		entityVal = entityVal.Elem()
 	} else if entityType.Kind() != reflect.Ptr {
@@ -259,7 +1150,7 @@ func extractEntity(entity Entity) (name string, fields []reflectedFields, err er
 	}
 
 	name = entityType.Name()
-	log.Debugf("Name of the type whose fields are being extracted is %s", name)
+	logger.Debugf("Name of the type whose fields are being extracted is %s", name)
 
 	for i := 0; i < entityVal.NumField(); i++ {
 		field := reflectedFields{
@@ -273,111 +1164,205 @@ func extractEntity(entity Entity) (name string, fields []reflectedFields, err er
 	return
 }
 
-func relationsFromEntity(entity Entity) (models.EntityRelations, error) {
-	_, fields, err := extractEntity(entity)
+func relationsFromEntity(logger log.FieldLogger, entity Entity) (models.EntityRelations, error) {
+	_, fields, err := extractEntity(logger, entity)
 	if err != nil {
 		return nil, err
 	}
 
-	log.Debugln("Discovering relations")
+	logger.Debugln("Discovering relations")
 
-	relations := map[string][]int64{}
+	// Start with the relations set directly on the Entity, so that relations
+	// without a matching field survive. Fields are authoritative for the
+	// relations they map.
+	relations := relationsFromEdges(entity.Edges())
 	for _, field := range fields {
-		if fieldIsPublic(field.Info) && !field.Info.Anonymous && isEntity(field.Info.Type) {
-			fieldName := strings.ToLower(inflector.Singularize(field.Info.Name))
-			fieldValue := field.Value.Interface()
-
-			log.Debugf("Found relation %s with value %+v", fieldName, fieldValue)
-
-			switch field.Value.Kind() {
-			case reflect.Slice:
-				entitySlice := reflect.ValueOf(fieldValue)
-				for i := 0; i < entitySlice.Len(); i++ {
-					relations[fieldName], err = appendToCommitList(relations[fieldName], entitySlice.Index(i))
-					if err != nil {
-						return nil, err
-					}
-				}
-			case reflect.Struct:
-				relations[fieldName], err = appendToCommitList(relations[fieldName], field.Value)
-				if err != nil {
-					return nil, err
-				}
-			case reflect.Ptr:
-				entityValue := field.Value.Elem()
-				relations[fieldName], err = appendToCommitList(relations[fieldName], entityValue)
+		if !fieldIsPublic(field.Info) || field.Info.Anonymous || !isRelation(field.Info.Type) {
+			continue
+		}
+
+		tag, err := parseFieldTag(field.Info)
+		if err != nil {
+			return nil, err
+		} else if tag.skip {
+			continue
+		}
+
+		fieldName := relationKey(field.Info, tag)
+		logger.Debugf("Found relation %s with value %+v", fieldName, field.Value.Interface())
+
+		edges := []models.RelationEdge{}
+		switch field.Value.Kind() {
+		case reflect.Slice:
+			for i := 0; i < field.Value.Len(); i++ {
+				edge, err := edgeFromValue(field.Value.Index(i), len(edges))
 				if err != nil {
 					return nil, err
 				}
-			default:
-				return nil, fmt.Errorf("Unexpected relation type %v", field.Value.Kind())
+
+				edges = append(edges, edge)
+			}
+		case reflect.Struct, reflect.Ptr:
+			if isZeroRelation(field.Value) {
+				break
+			}
+
+			edge, err := edgeFromValue(field.Value, 0)
+			if err != nil {
+				return nil, err
 			}
+
+			edges = append(edges, edge)
+		default:
+			return nil, fmt.Errorf("Unexpected relation type %v", field.Value.Kind())
 		}
+
+		relations[fieldName] = edges
 	}
 
 	return relations, nil
 }
 
-func appendToCommitList(commits []int64, value reflect.Value) ([]int64, error) {
-	entity, ok := value.Interface().(Entity)
-	if !ok {
-		return nil, errors.New("Cannot convert value to Entity")
+func relationsFromEdges(edges map[string][]Edge) models.EntityRelations {
+	relations := models.EntityRelations{}
+	for entityType, typeEdges := range edges {
+		relationEdges := make([]models.RelationEdge, len(typeEdges))
+		for index, edge := range typeEdges {
+			relationEdges[index] = models.RelationEdge{
+				ID:       edge.ID,
+				Kind:     edge.Kind,
+				Position: edge.Position,
+				Metadata: edge.Metadata,
+			}
+		}
+
+		relations[entityType] = relationEdges
 	}
 
-	if commits == nil {
-		commits = []int64{}
+	return relations
+}
+
+func edgesFromRelations(relations models.EntityRelations) map[string][]Edge {
+	edges := map[string][]Edge{}
+	for entityType, relationEdges := range relations {
+		typeEdges := make([]Edge, len(relationEdges))
+		for index, edge := range relationEdges {
+			typeEdges[index] = Edge{
+				ID:       edge.ID,
+				Kind:     edge.Kind,
+				Position: edge.Position,
+				Metadata: edge.Metadata,
+			}
+		}
+
+		edges[entityType] = typeEdges
 	}
 
-	return append(commits, entity.CommitID()), nil
+	return edges
 }
 
-func entityToFull(entity Entity) (*models.FullObject, error) {
-	name, fields, err := extractEntity(entity)
+// entityToFull converts the content of an Entity into a FullObject. When the
+// Entity is being updated, previous is its current content, from which the
+// values of readonly fields are kept.
+func entityToFull(logger log.FieldLogger, entity Entity, previous *models.FullObject) (*models.FullObject, error) {
+	_, fields, err := extractEntity(logger, entity)
+	if err != nil {
+		return nil, err
+	}
+
+	kind, err := kindOf(entity)
 	if err != nil {
 		return nil, err
 	}
 
-	kind := strings.ToLower(name)
 	form := models.NewObjectForm(kind)
 	shadow := models.NewObjectShadow()
+	shadow.Revision = currentRevision(kind)
+
+	var previousAttributes map[string]IlluminatedAttribute
+	if previous != nil {
+		previousAttributes, err = illuminatedAttributes(logger, *previous)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	log.Debugln("Discovering public fields")
+	logger.Debugln("Discovering public fields")
 
 	for _, field := range fields {
-		if fieldIsPublic(field.Info) && !field.Info.Anonymous && !isEntity(field.Info.Type) {
-			fName := fieldName(field.Info)
-			fType := typeName(field.Info.Type)
-			fVal := field.Value.Interface()
+		if !fieldIsPublic(field.Info) || field.Info.Anonymous || isRelation(field.Info.Type) {
+			continue
+		}
+
+		tag, err := parseFieldTag(field.Info)
+		if err != nil {
+			return nil, err
+		} else if tag.skip {
+			continue
+		}
 
-			log.Debugf("Converting Name=%s, Type=%s, Value=%v", fName, fType, fVal)
+		fName := tag.name
 
-			log.Debugln("Adding value to form")
-			ref, err := form.AddAttribute(fVal)
-			if err != nil {
+		if tag.readOnly && previous != nil {
+			logger.Debugf("Keeping previous value of readonly field %s", fName)
+			if err := copyAttribute(fName, previousAttributes, form, shadow); err != nil {
 				return nil, err
 			}
 
-			log.Debugln("Adding ref to shadow")
-			if err := shadow.AddAttribute(fName, fType, ref); err != nil {
-				return nil, err
+			continue
+		}
+
+		if isEmptyValue(field.Value) {
+			if tag.required {
+				return nil, fmt.Errorf("Field %s is required", fName)
+			} else if tag.omitEmpty {
+				continue
 			}
 		}
+
+		fType := typeName(field.Info.Type)
+		if field.Value.Kind() == reflect.Interface {
+			// Fields of an interface type are typed by the value they hold.
+			fType = valueTypeName(field.Value.Interface())
+		}
+
+		fVal, err := encodeAttribute(fName, field.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		logger.Debugf("Converting Name=%s, Type=%s, Value=%v", fName, fType, fVal)
+
+		logger.Debugln("Adding value to form")
+		ref, err := form.AddAttribute(fVal)
+		if err != nil {
+			return nil, err
+		}
+
+		logger.Debugln("Adding ref to shadow")
+		if err := shadow.AddAttribute(fName, fType, ref); err != nil {
+			return nil, err
+		}
 	}
 
-	log.Debugln("Discovering custom attributes")
+	logger.Debugln("Discovering custom attributes")
 
 	for name, val := range entity.Attributes() {
-		fType := typeName(reflect.TypeOf(val))
+		fType := customTypeName(entity, name, val)
+		fVal, err := encodeAttribute(name, reflect.ValueOf(&val).Elem())
+		if err != nil {
+			return nil, err
+		}
 
-		log.Debugf("Converting Custom Name=%s, Type=%s, Value=%v", name, fType, val)
+		logger.Debugf("Converting Custom Name=%s, Type=%s, Value=%v", name, fType, fVal)
 
-		log.Debugln("Adding value to form")
-		ref, err := form.AddAttribute(val)
+		logger.Debugln("Adding value to form")
+		ref, err := form.AddAttribute(fVal)
 		if err != nil {
 			return nil, err
 		}
 
-		log.Debugln("Adding ref to shadow")
+		logger.Debugln("Adding ref to shadow")
 		if err := shadow.AddAttribute(name, fType, ref); err != nil {
 			return nil, err
 		}
@@ -389,80 +1374,81 @@ func entityToFull(entity Entity) (*models.FullObject, error) {
 	}, nil
 }
 
+// copyAttribute copies an attribute to a form and shadow. If the attribute
+// doesn't exist, nothing is copied.
+func copyAttribute(name string, from map[string]IlluminatedAttribute, form *models.ObjectForm, shadow *models.ObjectShadow) error {
+	attribute, ok := from[name]
+	if !ok {
+		return nil
+	}
+
+	ref, err := form.AddAttribute(attribute.Value)
+	if err != nil {
+		return err
+	}
+
+	return shadow.AddAttribute(name, attribute.Type, ref)
+}
+
 func fieldIsPublic(field reflect.StructField) bool {
 	firstChar, _ := utf8.DecodeRuneInString(field.Name[:1])
 	return unicode.IsUpper(firstChar)
 }
 
-func fieldName(field reflect.StructField) string {
-	return lowercaseFirst(field.Name)
+func lowercaseFirst(str string) string {
+	head := strings.ToLower(str[:1])
+	tail := str[1:]
+	return head + tail
 }
 
-func getTagValue(tag, key string) (string, error) {
-	if tag == "" {
-		return "", nil
-	} else if key == "" {
-		return "", errors.New("Must specify a non-empty key to retrieve from tag")
-	}
-
-	// Append the key with ':"', because they must exist and those characters can
-	// only exist in a key.
-	formattedKey := fmt.Sprintf("%s:\"", key)
-
-	// Find the start of the value.
-	keyStartIdx := strings.Index(tag, formattedKey)
-	if keyStartIdx == -1 {
-		return "", nil
-	}
-
-	valueStartIdx := keyStartIdx + len(formattedKey)
-
-	// Find the next quotation mark (it marks the end of the value)
-	valueLength := strings.Index(tag[valueStartIdx:], "\"")
-	if valueLength == -1 {
-		return "", fmt.Errorf("Malformed tag %s", tag)
+// customTypeName gets the type of a custom attribute, which is either declared
+// by the Entity or derived from the value.
+func customTypeName(entity Entity, name string, value interface{}) string {
+	if typer, ok := entity.(attributeTyper); ok {
+		if attrType := typer.AttributeType(name); attrType != "" {
+			return attrType
+		}
 	}
 
-	valueEndIdx := valueStartIdx + valueLength
-	return tag[valueStartIdx:valueEndIdx], nil
+	return valueTypeName(value)
 }
 
-func illuminatedFieldName(field reflect.StructField) (string, error) {
-	tag := string(field.Tag)
-
-	// Check to see if there's a value 'gizmo'.
-	if gizmoVal, err := getTagValue(tag, gizmoTag); err != nil {
-		return "", err
-	} else if gizmoVal != "" {
-		return gizmoVal, nil
+// valueTypeName gets the type of a value whose Go type is only known at
+// runtime.
+func valueTypeName(value interface{}) string {
+	if value == nil {
+		return "null"
 	}
 
-	// Check to see if there's a value 'json'.
-	if jsonVal, err := getTagValue(tag, jsonTag); err != nil {
-		return "", err
-	} else if jsonVal != "" {
-		return jsonVal, nil
-	}
-
-	return lowercaseFirst(field.Name), nil
-}
-
-func lowercaseFirst(str string) string {
-	head := strings.ToLower(str[:1])
-	tail := str[1:]
-	return head + tail
+	return typeName(reflect.TypeOf(value))
 }
 
 func typeName(tp reflect.Type) string {
+	if codec, ok := codecForType(tp); ok {
+		return codec.ShadowType()
+	}
+
 	switch tp.Kind() {
-	case reflect.Int32:
+	case reflect.Ptr:
+		return typeName(tp.Elem())
+	case reflect.Bool:
+		return "bool"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		return "int"
-	case reflect.Int64:
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
 		return "int"
-	case reflect.Float32:
-		return "float"
-	case reflect.Float64:
+	case reflect.Float32, reflect.Float64:
 		return "float"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		return fmt.Sprintf("list<%s>", typeName(tp.Elem()))
+	case reflect.Map:
+		return fmt.Sprintf("map<%s>", typeName(tp.Elem()))
+	case reflect.Struct:
+		return "object"
+	case reflect.Interface:
+		return "any"
 	default:
 		return strings.ToLower(tp.Name())
 	}
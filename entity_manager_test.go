@@ -1,10 +1,16 @@
 package gizmo
 
 import (
+	"bytes"
 	"fmt"
+	"math"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/jmataya/gizmo/models"
+	"github.com/jmataya/gizmo/store"
 	"github.com/jmataya/gizmo/testutils"
 
 	log "github.com/sirupsen/logrus"
@@ -150,3 +156,1040 @@ func TestFind(t *testing.T) {
 
 	assert.Equal("Fox Socks", findProduct.Title)
 }
+
+func TestUpdate(t *testing.T) {
+	assert := testutils.NewAssert(t)
+
+	db := testutils.InitDB(t)
+	defer db.Close()
+
+	view := models.CreateView(t, db)
+	product := Product{Title: "Fox Socks"}
+
+	mgr := NewEntityManager(db)
+	created, err := mgr.Create(&product, view.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	toUpdate := created.(*Product)
+	toUpdate.Title = "Fox Socks 2.0"
+	updated, err := mgr.Update(toUpdate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(created.Identifier(), updated.Identifier())
+	assert.Equal("Fox Socks 2.0", updated.(*Product).Title)
+	if updated.CommitID() == created.CommitID() {
+		t.Error("Update should create a new commit")
+	}
+
+	var found Product
+	if err := mgr.Find(created.Identifier(), view.ID, &found); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(updated.CommitID(), found.CommitID())
+	assert.Equal("Fox Socks 2.0", found.Title)
+
+	if _, err := mgr.Update(created); err != ErrVersionConflict {
+		t.Errorf("Update from a stale commit = %v, want %v", err, ErrVersionConflict)
+	}
+}
+
+func TestUpdate_PropagatesToParents(t *testing.T) {
+	assert := testutils.NewAssert(t)
+
+	db := testutils.InitDB(t)
+	defer db.Close()
+
+	view := models.CreateView(t, db)
+	mgr := NewEntityManager(db, WithPropagation())
+
+	newSKU, err := mgr.Create(&SKU{Price: 999.0}, view.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	variant := Variant{Title: "Fox Socks", SKUs: []SKU{*newSKU.(*SKU)}}
+	newVariant, err := mgr.Create(&variant, view.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	toUpdate := newSKU.(*SKU)
+	toUpdate.Price = 1299.0
+	updatedSKU, err := mgr.Update(toUpdate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found Variant
+	if err := mgr.Find(newVariant.Identifier(), view.ID, &found); err != nil {
+		t.Fatal(err)
+	}
+
+	if found.CommitID() == newVariant.CommitID() {
+		t.Fatal("Parent should have a new commit after propagation")
+	}
+
+	skus, err := found.RelationsByEntity("sku")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Equal(1, len(skus)) {
+		assert.Equal(updatedSKU.CommitID(), skus[0])
+	}
+
+	if assert.Equal(1, len(found.SKUs)) {
+		assert.Equal(1299.0, found.SKUs[0].Price)
+	}
+
+	original, err := mgr.FindByCommit(newVariant.CommitID(), &Variant{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if originalSKUs := original.(*Variant).SKUs; assert.Equal(1, len(originalSKUs)) {
+		assert.Equal(999.0, originalSKUs[0].Price)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	db := testutils.InitDB(t)
+	defer db.Close()
+
+	view := models.CreateView(t, db)
+	mgr := NewEntityManager(db)
+
+	created, err := mgr.Create(&Product{Title: "Fox Socks"}, view.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mgr.Delete(created.Identifier(), view.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	var found Product
+	if err := mgr.Find(created.Identifier(), view.ID, &found); err != ErrEntityNotFound {
+		t.Errorf("Find after Delete = %v, want %v", err, ErrEntityNotFound)
+	}
+}
+
+type BundleItem struct {
+	EdgeObject
+	SKU      SKU
+	Quantity int
+}
+
+type Bundle struct {
+	EntityObject
+	Title string
+	Items []BundleItem
+}
+
+func TestCreate_EdgeMetadata(t *testing.T) {
+	assert := testutils.NewAssert(t)
+
+	db := testutils.InitDB(t)
+	defer db.Close()
+
+	view := models.CreateView(t, db)
+	mgr := NewEntityManager(db)
+
+	first, err := mgr.Create(&SKU{Price: 999.0}, view.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := mgr.Create(&SKU{Price: 499.0}, view.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bundle := Bundle{
+		Title: "Sock Drawer",
+		Items: []BundleItem{
+			{SKU: *second.(*SKU), Quantity: 1},
+			{SKU: *first.(*SKU), Quantity: 3},
+		},
+	}
+	bundle.Items[1].SetMetadata("label", "Best value")
+
+	created, err := mgr.Create(&bundle, view.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edges, err := created.EdgesByEntity("item")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Equal(2, len(edges)) {
+		assert.Equal(first.CommitID(), edges[1].ID)
+		assert.Equal(1, edges[1].Position)
+	}
+
+	var found Bundle
+	if err := mgr.Find(created.Identifier(), view.ID, &found); err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Equal(2, len(found.Items)) {
+		item := found.Items[1]
+		assert.Equal(3, item.Quantity)
+		assert.Equal(1, item.Position())
+		assert.Equal(999.0, item.SKU.Price)
+		assert.Equal("Best value", item.Metadata()["label"])
+	}
+}
+
+type Article struct {
+	EntityObject
+	Body string
+}
+
+type ContentBlock interface {
+	Entity
+}
+
+type LandingPage struct {
+	EntityObject
+	Title  string
+	Blocks []ContentBlock
+}
+
+func TestCreate_PolymorphicRelations(t *testing.T) {
+	assert := testutils.NewAssert(t)
+
+	db := testutils.InitDB(t)
+	defer db.Close()
+
+	RegisterKind("banner", Banner{})
+	RegisterKind("product", Product{})
+
+	view := models.CreateView(t, db)
+	mgr := NewEntityManager(db)
+
+	banner, err := mgr.Create(&Banner{Headline: "Socks for foxes"}, view.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	product, err := mgr.Create(&Product{Title: "Fox Socks"}, view.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page := LandingPage{Title: "Home", Blocks: []ContentBlock{banner, product}}
+	created, err := mgr.Create(&page, view.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edges, err := created.EdgesByEntity("block")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Equal(2, len(edges)) {
+		assert.Equal("banner", edges[0].Kind)
+		assert.Equal("product", edges[1].Kind)
+	}
+
+	var found LandingPage
+	if err := mgr.Find(created.Identifier(), view.ID, &found); err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Equal(2, len(found.Blocks)) {
+		assert.Equal("Socks for foxes", found.Blocks[0].(*Banner).Headline)
+		assert.Equal("Fox Socks", found.Blocks[1].(*Product).Title)
+	}
+}
+
+func TestFindByCommit_WithoutTypeHint(t *testing.T) {
+	assert := testutils.NewAssert(t)
+
+	db := testutils.InitDB(t)
+	defer db.Close()
+
+	RegisterKind("product", Product{})
+
+	view := models.CreateView(t, db)
+	mgr := NewEntityManager(db)
+
+	product, err := mgr.Create(&Product{Title: "Fox Socks"}, view.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := mgr.FindByCommit(product.CommitID(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if foundProduct, ok := found.(*Product); assert.Equal(true, ok) {
+		assert.Equal("Fox Socks", foundProduct.Title)
+	}
+
+	article, err := mgr.Create(&Article{Body: "All about socks"}, view.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := mgr.Load(article.Identifier(), view.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, ok := loaded.(*GenericEntity)
+	assert.Equal(true, ok)
+	assert.Equal("article", loaded.Kind())
+
+	body, _ := loaded.Attribute("body")
+	assert.Equal("All about socks", body)
+}
+
+func TestCreate_GenericEntity(t *testing.T) {
+	assert := testutils.NewAssert(t)
+
+	db := testutils.InitDB(t)
+	defer db.Close()
+
+	view := models.CreateView(t, db)
+	mgr := NewEntityManager(db)
+
+	entity, err := NewGenericEntity("promotion")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entity.SetTypedAttribute("description", "text", "Half off all socks")
+
+	created, err := mgr.Create(entity, view.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := mgr.Load(created.Identifier(), view.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	generic := found.(*GenericEntity)
+	assert.Equal("promotion", generic.Kind())
+	assert.Equal("text", generic.AttributeType("description"))
+}
+
+type Shipment struct {
+	EntityObject
+	Quantity  int
+	Weight    float32
+	ShippedAt time.Time
+	Label     []byte
+	Carrier   *string
+}
+
+func TestCreate_TypedAttributes(t *testing.T) {
+	assert := testutils.NewAssert(t)
+
+	db := testutils.InitDB(t)
+	defer db.Close()
+
+	view := models.CreateView(t, db)
+	mgr := NewEntityManager(db)
+
+	shippedAt := time.Date(2017, 4, 9, 22, 17, 3, 0, time.UTC)
+	shipment := Shipment{
+		Quantity:  3,
+		Weight:    1.5,
+		ShippedAt: shippedAt,
+		Label:     []byte("fragile"),
+	}
+
+	created, err := mgr.Create(&shipment, view.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found Shipment
+	if err := mgr.Find(created.Identifier(), view.ID, &found); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(3, found.Quantity)
+	assert.Equal(float32(1.5), found.Weight)
+	assert.Equal(true, shippedAt.Equal(found.ShippedAt))
+	assert.Equal("fragile", string(found.Label))
+	assert.Equal((*string)(nil), found.Carrier)
+}
+
+type PricedSKU struct {
+	EntityObject
+	Code        string
+	RetailPrice Money
+	SalePrice   *Money
+}
+
+func TestCreate_AttributeCodec(t *testing.T) {
+	assert := testutils.NewAssert(t)
+
+	db := testutils.InitDB(t)
+	defer db.Close()
+
+	view := models.CreateView(t, db)
+	mgr := NewEntityManager(db)
+
+	sku := PricedSKU{
+		Code:        "SKU-TEST",
+		RetailPrice: Money{Currency: "USD", Amount: 1299},
+	}
+	sku.SetAttribute("cost", Money{Currency: "USD", Amount: 600})
+
+	created, err := mgr.Create(&sku, view.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found PricedSKU
+	if err := mgr.Find(created.Identifier(), view.ID, &found); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(Money{Currency: "USD", Amount: 1299}, found.RetailPrice)
+	assert.Equal((*Money)(nil), found.SalePrice)
+	assert.Equal(Money{Currency: "USD", Amount: 600}, found.Attributes()["cost"])
+}
+
+type Dimensions struct {
+	Width  float64
+	Height float64
+	Unit   string
+}
+
+type Apparel struct {
+	EntityObject
+	Title      string
+	Tags       []string
+	Dimensions Dimensions
+	Stock      map[string]int
+}
+
+func TestCreate_StructuredAttributes(t *testing.T) {
+	assert := testutils.NewAssert(t)
+
+	db := testutils.InitDB(t)
+	defer db.Close()
+
+	view := models.CreateView(t, db)
+	mgr := NewEntityManager(db)
+
+	apparel := Apparel{
+		Title:      "Wool Socks",
+		Tags:       []string{"wool", "winter"},
+		Dimensions: Dimensions{Width: 4, Height: 10.5, Unit: "in"},
+		Stock:      map[string]int{"small": 3, "large": 0},
+	}
+
+	created, err := mgr.Create(&apparel, view.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	version, err := models.FindEntityVersion(db, created.CommitID())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	full, err := models.FullObject{}.Find(db, version.ContentCommitID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal("list<string>", full.Shadow.Attributes["tags"].Type)
+	assert.Equal("object", full.Shadow.Attributes["dimensions"].Type)
+	assert.Equal("map<int>", full.Shadow.Attributes["stock"].Type)
+
+	var found Apparel
+	if err := mgr.Find(created.Identifier(), view.ID, &found); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(Dimensions{Width: 4, Height: 10.5, Unit: "in"}, found.Dimensions)
+
+	if !reflect.DeepEqual([]string{"wool", "winter"}, found.Tags) {
+		t.Errorf("Expected tags [wool winter], got %v", found.Tags)
+	}
+	if !reflect.DeepEqual(map[string]int{"small": 3, "large": 0}, found.Stock) {
+		t.Errorf("Expected stock map[large:0 small:3], got %v", found.Stock)
+	}
+}
+
+func TestUpdate_ReadOnlyFields(t *testing.T) {
+	assert := testutils.NewAssert(t)
+
+	db := testutils.InitDB(t)
+	defer db.Close()
+
+	view := models.CreateView(t, db)
+	mgr := NewEntityManager(db)
+
+	created, err := mgr.Create(&Gadget{Title: "Widget", Serial: "W-1"}, view.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	toUpdate := *created.(*Gadget)
+	toUpdate.Title = "Widget 2.0"
+	toUpdate.Serial = "W-2"
+	updated, err := mgr.Update(&toUpdate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal("Widget 2.0", updated.(*Gadget).Title)
+	assert.Equal("W-1", updated.(*Gadget).Serial)
+
+	toUpdate = *updated.(*Gadget)
+	toUpdate.Title = ""
+	if _, err := mgr.Update(&toUpdate); errorMsg(err) != "Field name is required" {
+		t.Errorf("Update without a required field = %v, want Field name is required", err)
+	}
+}
+
+func TestCreate_ValidatesSchema(t *testing.T) {
+	assert := testutils.NewAssert(t)
+
+	db := testutils.InitDB(t)
+	defer db.Close()
+
+	view := models.CreateView(t, db)
+	mgr := NewEntityManager(db)
+
+	kind := fmt.Sprintf("gadget_%d", view.ID)
+	schema, err := mgr.DefineSchema(Schema{
+		Kind: kind,
+		Attributes: map[string]AttributeSchema{
+			"name":  {Type: "string", Required: true},
+			"color": {Type: "string", Enum: []interface{}{"red", "blue"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(1, schema.Version)
+
+	invalid, _ := NewGenericEntity(kind)
+	invalid.SetAttribute("color", "green")
+	invalid.SetAttribute("size", 3)
+
+	_, err = mgr.Create(invalid, view.ID)
+	validationErr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("Create() = %v, want a ValidationError", err)
+	}
+	assert.Equal(3, len(validationErr.Violations))
+
+	valid, _ := NewGenericEntity(kind)
+	valid.SetAttribute("name", "Widget")
+	valid.SetAttribute("color", "red")
+	if _, err := mgr.Create(valid, view.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	schema.AdditionalAttributes = true
+	schema, err = mgr.DefineSchema(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(2, schema.Version)
+
+	found, err := mgr.FindSchema(kind)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(2, found.Version)
+	assert.Equal(true, found.AdditionalAttributes)
+
+	if _, err := mgr.FindSchema("unschemed"); err != ErrSchemaNotFound {
+		t.Errorf("FindSchema(unschemed) = %v, want %v", err, ErrSchemaNotFound)
+	}
+}
+
+func TestUpdate_SkipsUnchanged(t *testing.T) {
+	db := testutils.InitDB(t)
+	defer db.Close()
+
+	view := models.CreateView(t, db)
+	testUpdateSkipsUnchanged(t, store.NewPostgresStore(db), view.ID)
+}
+
+func TestUpdate_SkipsUnchangedMemoryStore(t *testing.T) {
+	s := store.NewMemoryStore()
+	view, err := s.InsertView(models.View{Name: "Default"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testUpdateSkipsUnchanged(t, s, view.ID)
+}
+
+func testUpdateSkipsUnchanged(t *testing.T, s store.Store, viewID int64) {
+	assert := testutils.NewAssert(t)
+	mgr := NewEntityManagerWithStore(s)
+
+	sku := SKU{Price: 10.00}
+	createdSKU, err := mgr.Create(&sku, viewID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	variant := Variant{Title: "Fox Socks", SKUs: []SKU{*createdSKU.(*SKU)}}
+	created, err := mgr.Create(&variant, viewID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unchanged, err := mgr.Update(created)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(created.CommitID(), unchanged.CommitID())
+
+	otherSKU := SKU{Price: 20.00}
+	createdOther, err := mgr.Create(&otherSKU, viewID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	toUpdate := unchanged.(*Variant)
+	toUpdate.SKUs = append(toUpdate.SKUs, *createdOther.(*SKU))
+	relinked, err := mgr.Update(toUpdate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if relinked.CommitID() == created.CommitID() {
+		t.Error("Changing relations should create a new version")
+	}
+
+	before, err := s.FindVersion(created.CommitID())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := s.FindVersion(relinked.CommitID())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(before.ContentCommitID, after.ContentCommitID)
+	assert.Equal(2, len(after.Relations["sku"]))
+}
+
+func TestPatch(t *testing.T) {
+	assert := testutils.NewAssert(t)
+
+	db := testutils.InitDB(t)
+	defer db.Close()
+
+	RegisterKind("variant", Variant{})
+
+	view := models.CreateView(t, db)
+	mgr := NewEntityManager(db)
+
+	sku := SKU{Price: 10.00}
+	createdSKU, err := mgr.Create(&sku, view.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	variant := Variant{Title: "Fox Socks", SKUs: []SKU{*createdSKU.(*SKU)}}
+	created, err := mgr.Create(&variant, view.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	merged, err := mgr.Patch(created.Identifier(), view.ID, []byte(`{"attributes": {"title": {"value": "Fox Socks 2.0"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mergedVariant, ok := merged.(*Variant)
+	if !ok {
+		t.Fatalf("Patch returned %T, want *Variant", merged)
+	}
+	assert.Equal("Fox Socks 2.0", mergedVariant.Title)
+	assert.Equal(1, len(mergedVariant.Relations()["sku"]))
+	if merged.CommitID() == created.CommitID() {
+		t.Error("Patch should create a new commit")
+	}
+
+	jsonPatch := fmt.Sprintf(`[
+		{"op": "test", "path": "/commit_id", "value": %d},
+		{"op": "add", "path": "/relations/sku/-", "value": %d}
+	]`, merged.CommitID(), createdSKU.CommitID())
+	patched, err := mgr.Patch(created.Identifier(), view.ID, []byte(jsonPatch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(2, len(patched.Relations()["sku"]))
+
+	var found Variant
+	if err := mgr.Find(created.Identifier(), view.ID, &found); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(patched.CommitID(), found.CommitID())
+	assert.Equal("Fox Socks 2.0", found.Title)
+	assert.Equal(2, len(found.SKUs))
+
+	stale := fmt.Sprintf(`{"commit_id": %d, "attributes": {"title": {"value": "Stale"}}}`, created.CommitID())
+	if _, err := mgr.Patch(created.Identifier(), view.ID, []byte(stale)); err != ErrVersionConflict {
+		t.Errorf("Patch from a stale commit = %v, want %v", err, ErrVersionConflict)
+	}
+
+	_, err = mgr.Patch(created.Identifier(), view.ID, []byte(`{"kind": "product"}`))
+	assert.Equal("Unable to apply patch: the kind of an Entity can't be changed", errorMsg(err))
+}
+
+type Brochure struct {
+	EntityObject
+	Title  string
+	Manual Blob
+}
+
+func TestPatch_PolymorphicRelations(t *testing.T) {
+	assert := testutils.NewAssert(t)
+
+	s := store.NewMemoryStore()
+	view, err := s.InsertView(models.View{Name: "Default"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	RegisterKind("banner", Banner{})
+	RegisterKind("product", Product{})
+	RegisterKind("landing_page", LandingPage{})
+
+	mgr := NewEntityManagerWithStore(s)
+
+	banner, err := mgr.Create(&Banner{Headline: "Socks for foxes"}, view.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	product, err := mgr.Create(&Product{Title: "Fox Socks"}, view.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := mgr.Create(&LandingPage{Title: "Home", Blocks: []ContentBlock{banner, product}}, view.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A GenericEntity has no fields, so the kinds of its edges are only kept
+	// by the edges themselves.
+	collection, err := NewGenericEntity("collection")
+	if err != nil {
+		t.Fatal(err)
+	}
+	collection.SetTypedAttribute("name", "string", "Featured")
+	collection.SetEdge("item", Edge{ID: banner.CommitID(), Kind: "banner", Position: 0})
+	collection.SetEdge("item", Edge{ID: product.CommitID(), Kind: "product", Position: 1})
+
+	createdCollection, err := mgr.Create(collection, view.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		entity       Entity
+		relationName string
+		patch        string
+	}{
+		{page, "block", `{"attributes": {"title": {"value": "Welcome"}}}`},
+		{createdCollection, "item", `{"attributes": {"name": {"value": "Popular"}}}`},
+	}
+
+	for _, test := range tests {
+		patched, err := mgr.Patch(test.entity.Identifier(), view.ID, []byte(test.patch))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		version, err := s.FindVersion(patched.CommitID())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		edges := version.Relations[test.relationName]
+		if assert.Equal(2, len(edges)) {
+			assert.Equal("banner", edges[0].Kind)
+			assert.Equal("product", edges[1].Kind)
+		}
+	}
+}
+
+func TestCreate_Blob(t *testing.T) {
+	assert := testutils.NewAssert(t)
+
+	db := testutils.InitDB(t)
+	defer db.Close()
+
+	view := models.CreateView(t, db)
+	mgr := NewEntityManager(db)
+
+	content := strings.Repeat("%PDF-1.4 ", 200000)
+	manual, err := mgr.PutBlob(strings.NewReader(content), "application/pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(int64(len(content)), manual.Size)
+
+	brochure := Brochure{Title: "Fox Socks", Manual: manual}
+	created, err := mgr.Create(&brochure, view.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found Brochure
+	if err := mgr.Find(created.Identifier(), view.ID, &found); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(manual, found.Manual)
+
+	var out bytes.Buffer
+	if _, err := mgr.WriteBlob(&out, found.Manual); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(content, out.String())
+
+	missing := Brochure{Title: "Fox Socks", Manual: Blob{Digest: manualDigest, Size: 12}}
+	_, err = mgr.Create(&missing, view.ID)
+	assert.Equal("Content of Blob "+manualDigest+" is not stored", errorMsg(err))
+}
+
+func TestEntityManager_MemoryStore(t *testing.T) {
+	assert := testutils.NewAssert(t)
+
+	s := store.NewMemoryStore()
+	view, err := s.InsertView(models.View{Name: "Default"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mgr := NewEntityManagerWithStore(s, WithPropagation())
+
+	newSKU, err := mgr.Create(&SKU{Price: 999.0}, view.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newVariant, err := mgr.Create(&Variant{Title: "Fox Socks", SKUs: []SKU{*newSKU.(*SKU)}}, view.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	toUpdate := newSKU.(*SKU)
+	toUpdate.Price = 1299.0
+	if _, err := mgr.Update(toUpdate); err != nil {
+		t.Fatal(err)
+	}
+
+	var found Variant
+	if err := mgr.Find(newVariant.Identifier(), view.ID, &found); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal("Fox Socks", found.Title)
+	if assert.Equal(1, len(found.SKUs)) {
+		assert.Equal(1299.0, found.SKUs[0].Price)
+	}
+
+	if err := mgr.Delete(newVariant.Identifier(), view.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mgr.Find(newVariant.Identifier(), view.ID, &Variant{}); err != ErrEntityNotFound {
+		t.Errorf("Find after Delete = %v, want %v", err, ErrEntityNotFound)
+	}
+}
+
+func TestEntityManager_MemoryStoreRoundTrip(t *testing.T) {
+	assert := testutils.NewAssert(t)
+
+	s := store.NewMemoryStore()
+	view, err := s.InsertView(models.View{Name: "Default"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mgr := NewEntityManagerWithStore(s)
+
+	createdSKU, err := mgr.Create(&SKU{Price: 10.00}, view.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created, err := mgr.Create(&Variant{Title: "Fox Socks", SKUs: []SKU{*createdSKU.(*SKU)}}, view.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Equal(1, len(created.(*Variant).SKUs)) {
+		assert.Equal(10.00, created.(*Variant).SKUs[0].Price)
+	}
+
+	// An Entity that is returned by Create keeps its relations when it is
+	// passed back to Update.
+	unchanged, err := mgr.Update(created)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(created.CommitID(), unchanged.CommitID())
+	assert.Equal(1, len(unchanged.(*Variant).SKUs))
+
+	toUpdate := unchanged.(*Variant)
+	toUpdate.Title = "Bear Socks"
+	updated, err := mgr.Update(toUpdate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	version, err := s.FindVersion(updated.CommitID())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(1, len(version.Relations["sku"]))
+	if assert.Equal(1, len(updated.(*Variant).SKUs)) {
+		assert.Equal(createdSKU.CommitID(), updated.(*Variant).SKUs[0].CommitID())
+	}
+}
+
+func TestEntityManager_MemoryStoreLargeUnsigned(t *testing.T) {
+	assert := testutils.NewAssert(t)
+
+	s := store.NewMemoryStore()
+	view, err := s.InsertView(models.View{Name: "Default"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mgr := NewEntityManagerWithStore(s)
+
+	sku := SKU{Price: 10.00}
+	sku.SetAttribute("serial", uint64(math.MaxUint64))
+	created, err := mgr.Create(&sku, view.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found SKU
+	if err := mgr.Find(created.Identifier(), view.ID, &found); err != nil {
+		t.Fatal(err)
+	}
+
+	serial, err := found.Attribute("serial")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(uint64(math.MaxUint64), serial)
+}
+
+func TestWithLogger(t *testing.T) {
+	s := store.NewMemoryStore()
+	view, err := s.InsertView(models.View{Name: "Default"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	logger := log.New()
+	logger.Out = &out
+	logger.Level = log.DebugLevel
+
+	mgr := NewEntityManagerWithStore(s, WithLogger(logger), WithPropagation())
+
+	newSKU, err := mgr.Create(&SKU{Price: 10.00}, view.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := mgr.Create(&Variant{Title: "Fox Socks", SKUs: []SKU{*newSKU.(*SKU)}}, view.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	toUpdate := newSKU.(*SKU)
+	toUpdate.Price = 12.00
+	if _, err := mgr.Update(toUpdate); err != nil {
+		t.Fatal(err)
+	}
+
+	generic := &GenericEntity{}
+	generic.SetKind("unregistered")
+	createdGeneric, err := mgr.Create(generic, view.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := mgr.FindByCommit(createdGeneric.CommitID(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The helpers that the EntityManager calls log to its logger as well.
+	for _, want := range []string{
+		"Discovering public fields",
+		"Discovering relations",
+		"Inserting Form",
+		"Converting FullObject to Entity",
+		"Propagated EntityVersion",
+		"Kind unregistered is not registered",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected the logger to receive %q", want)
+		}
+	}
+}
+
+func TestEntityManager_MemoryStoreConcurrentUpdates(t *testing.T) {
+	s := store.NewMemoryStore()
+	view, err := s.InsertView(models.View{Name: "Default"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mgr := NewEntityManagerWithStore(s)
+	created, err := mgr.Create(&Product{Title: "Fox Socks"}, view.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const updaters = 10
+	errs := make(chan error, updaters)
+	for i := 0; i < updaters; i++ {
+		toUpdate := *created.(*Product)
+		toUpdate.Title = fmt.Sprintf("Fox Socks %d", i)
+
+		go func() {
+			_, err := mgr.Update(&toUpdate)
+			errs <- err
+		}()
+	}
+
+	updated := 0
+	for i := 0; i < updaters; i++ {
+		if err := <-errs; err == nil {
+			updated++
+		} else if err != ErrVersionConflict {
+			t.Errorf("Unexpected error %v", err)
+		}
+	}
+
+	if updated != 1 {
+		t.Errorf("Expected exactly one update from the same commit to succeed, got %d", updated)
+	}
+}
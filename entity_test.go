@@ -317,3 +317,173 @@ func sortStrings(a []string) []string {
 
 	return a
 }
+
+func TestSetEdge(t *testing.T) {
+	var tests = []struct {
+		entityType string
+		edge       Edge
+		want       []int64
+		wantErr    string
+	}{
+		{"sku", Edge{ID: 4, Position: 0}, []int64{4, 1, 2, 3}, ""},
+		{"sku", Edge{ID: 3, Position: 1}, []int64{1, 3, 2}, ""},
+		{"sku", Edge{ID: 5, Position: -1}, []int64{1, 2, 3, 5}, ""},
+		{"variant", Edge{ID: 10, Position: 3}, []int64{10}, ""},
+		{"", Edge{ID: 3}, nil, "Entity type must be non-empty"},
+		{"sku", Edge{ID: 0}, nil, "Entity ID must be greater than 0"},
+	}
+
+	for _, test := range tests {
+		entity := createEntityObject()
+		test.edge.Metadata = map[string]interface{}{"quantity": 3}
+
+		err := entity.(EntityUpdater).SetEdge(test.entityType, test.edge)
+		if errorMsg(err) != test.wantErr {
+			t.Errorf("SetEdge(%s, %+v) = %s, want %s", test.entityType, test.edge, errorMsg(err), test.wantErr)
+			continue
+		}
+
+		if test.wantErr != "" {
+			continue
+		}
+
+		got, err := entity.EdgesByEntity(test.entityType)
+		if err != nil {
+			t.Errorf("EdgesByEntity(%s) got error %s, want none", test.entityType, err.Error())
+			continue
+		}
+
+		if len(got) != len(test.want) {
+			t.Errorf("EdgesByEntity(%s) = %+v, want IDs %v", test.entityType, got, test.want)
+			continue
+		}
+
+		for index, edge := range got {
+			if edge.ID != test.want[index] || edge.Position != index {
+				t.Errorf("EdgesByEntity(%s)[%d] = %+v, want ID %d", test.entityType, index, edge, test.want[index])
+			}
+
+			hasMetadata := edge.Metadata != nil
+			if wantMetadata := edge.ID == test.edge.ID; hasMetadata != wantMetadata {
+				t.Errorf("EdgesByEntity(%s)[%d] metadata = %v, want metadata %t", test.entityType, index, edge.Metadata, wantMetadata)
+			}
+		}
+	}
+}
+
+func TestSetEdge_ReplacesByID(t *testing.T) {
+	entity := createEntityObject()
+	updater := entity.(EntityUpdater)
+	updater.SetEdges(map[string][]Edge{
+		"sku": []Edge{
+			{ID: 7, Position: 0, Metadata: map[string]interface{}{"quantity": 1}},
+			{ID: 8, Position: 1},
+			{ID: 7, Position: 2, Metadata: map[string]interface{}{"quantity": 2}},
+		},
+	})
+
+	err := updater.SetEdge("sku", Edge{ID: 7, Position: 0, Metadata: map[string]interface{}{"quantity": 3}})
+	if err != nil {
+		t.Fatalf("SetEdge(sku, 7) got error %s, want none", err.Error())
+	}
+
+	got, err := entity.EdgesByEntity("sku")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 2 || got[0].ID != 7 || got[1].ID != 8 {
+		t.Fatalf("EdgesByEntity(sku) = %+v, want IDs [7 8]", got)
+	}
+
+	if got[0].Metadata["quantity"] != 3 {
+		t.Errorf("EdgesByEntity(sku)[0] metadata = %v, want quantity 3", got[0].Metadata)
+	}
+
+	if got[1].Metadata != nil {
+		t.Errorf("EdgesByEntity(sku)[1] metadata = %v, want none", got[1].Metadata)
+	}
+}
+
+func TestSetEdges(t *testing.T) {
+	entity := createEntityObject()
+	entity.(EntityUpdater).SetEdges(map[string][]Edge{
+		"sku": []Edge{
+			{ID: 7, Position: 1, Metadata: map[string]interface{}{"quantity": 3}},
+			{ID: 8, Position: 0},
+		},
+	})
+
+	ids, err := entity.RelationsByEntity("sku")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !compareOrderedInts([]int64{8, 7}, ids) {
+		t.Errorf("RelationsByEntity(sku) = %v, want %v", ids, []int64{8, 7})
+	}
+
+	if err := entity.(EntityUpdater).UpdateRelation("sku", 7, 9); err != nil {
+		t.Fatal(err)
+	}
+
+	edges, err := entity.EdgesByEntity("sku")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if edges[1].ID != 9 || edges[1].Metadata["quantity"] != 3 {
+		t.Errorf("EdgesByEntity(sku)[1] = %+v, want ID 9 with quantity 3", edges[1])
+	}
+
+	if err := entity.(EntityUpdater).RemoveRelation("sku", 9); err != nil {
+		t.Fatal(err)
+	}
+
+	if edges := entity.Edges()["sku"]; len(edges) != 1 || edges[0].ID != 8 {
+		t.Errorf("Edges()[sku] = %+v, want a single edge to 8", edges)
+	}
+}
+
+func TestSetEdges_SameTarget(t *testing.T) {
+	entity := createEntityObject()
+	entity.(EntityUpdater).SetEdges(map[string][]Edge{
+		"sku": []Edge{
+			{ID: 7, Position: 0, Metadata: map[string]interface{}{"quantity": 3}},
+			{ID: 8, Position: 1},
+			{ID: 7, Position: 2, Metadata: map[string]interface{}{"quantity": 5}},
+		},
+	})
+
+	edges := entity.Edges()["sku"]
+	if len(edges) != 3 {
+		t.Fatalf("Edges()[sku] = %+v, want 3 edges", edges)
+	}
+
+	if edges[0].Metadata["quantity"] != 3 || edges[1].Metadata != nil || edges[2].Metadata["quantity"] != 5 {
+		t.Errorf("Edges()[sku] = %+v, want the metadata of each edge", edges)
+	}
+
+	if err := entity.(EntityUpdater).RemoveRelation("sku", 8); err != nil {
+		t.Fatal(err)
+	}
+
+	edges = entity.Edges()["sku"]
+	if len(edges) != 2 || edges[0].Metadata["quantity"] != 3 || edges[1].Metadata["quantity"] != 5 {
+		t.Errorf("Edges()[sku] = %+v, want both edges to 7 with their metadata", edges)
+	}
+}
+
+func compareOrderedInts(a []int64, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := 0; i < len(a); i++ {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,92 @@
+package gizmo
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileBlobStore is a BlobStore that keeps content in files in a directory of
+// the local filesystem. The content with the digest sha256:abcdef... is kept
+// in the file ab/cdef... of the directory.
+type FileBlobStore struct {
+	dir string
+}
+
+// NewFileBlobStore creates a FileBlobStore in a directory, creating the
+// directory if it doesn't exist.
+func NewFileBlobStore(dir string) (*FileBlobStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &FileBlobStore{dir: dir}, nil
+}
+
+// Put stores the content read from r. The content is written to a temporary
+// file while it's digested, and then renamed to its final path, so partially
+// written content is never visible.
+func (s *FileBlobStore) Put(r io.Reader) (string, int64, error) {
+	file, err := os.CreateTemp(s.dir, "upload-")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(file.Name())
+
+	h := newBlobHash()
+	size, err := io.Copy(io.MultiWriter(file, h), r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	digest := blobDigest(h)
+	path := s.path(digest)
+	if _, err := os.Stat(path); err == nil {
+		return digest, size, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", 0, err
+	}
+
+	return digest, size, os.Rename(file.Name(), path)
+}
+
+// Open opens the file that holds the content with a digest.
+func (s *FileBlobStore) Open(digest string) (io.ReadCloser, error) {
+	if !isBlobDigest(digest) {
+		return nil, ErrBlobNotFound
+	}
+
+	file, err := os.Open(s.path(digest))
+	if os.IsNotExist(err) {
+		return nil, ErrBlobNotFound
+	}
+
+	return file, err
+}
+
+// Size gets the size of the file that holds the content with a digest.
+func (s *FileBlobStore) Size(digest string) (int64, error) {
+	if !isBlobDigest(digest) {
+		return 0, ErrBlobNotFound
+	}
+
+	info, err := os.Stat(s.path(digest))
+	if os.IsNotExist(err) {
+		return 0, ErrBlobNotFound
+	} else if err != nil {
+		return 0, err
+	}
+
+	return info.Size(), nil
+}
+
+func (s *FileBlobStore) path(digest string) string {
+	hexDigest := strings.TrimPrefix(digest, "sha256:")
+	return filepath.Join(s.dir, hexDigest[:2], hexDigest[2:])
+}
@@ -0,0 +1,246 @@
+package gizmo
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+var genericEntityType = reflect.TypeOf(GenericEntity{})
+
+// attributeTyper is implemented by Entities that declare the types of their
+// custom attributes instead of having them derived from the values.
+type attributeTyper interface {
+	// AttributeType gets the declared type of a custom attribute. If the type
+	// isn't declared, an empty string is returned.
+	AttributeType(key string) string
+
+	// SetTypedAttribute sets the value and type of a custom attribute.
+	SetTypedAttribute(key string, attrType string, value interface{}) error
+}
+
+// GenericEntity is an Entity without a Go type of its own. All of its content
+// is held in custom attributes and relations, which makes it suitable for
+// kinds that are not registered with RegisterKind.
+//
+// The JSON encoding of a GenericEntity is the illuminated form of the Entity:
+//
+//	{
+//	  "id": 1,
+//	  "commit_id": 13,
+//	  "view_id": 1,
+//	  "kind": "product",
+//	  "attributes": {
+//	    "title": {"type": "string", "value": "My Product"}
+//	  },
+//	  "relations": {
+//	    "sku": [23]
+//	  }
+//	}
+//
+// Relations with a kind or metadata are encoded as objects with the fields
+// id, kind, and metadata instead of as bare commit IDs.
+type GenericEntity struct {
+	EntityObject
+	types map[string]string
+}
+
+// NewGenericEntity creates an empty GenericEntity of the specified kind.
+func NewGenericEntity(kind string) (*GenericEntity, error) {
+	entity := &GenericEntity{}
+	if err := entity.SetKind(kind); err != nil {
+		return nil, err
+	}
+
+	return entity, nil
+}
+
+// AttributeType gets the declared type of a custom attribute. If the type
+// isn't declared, an empty string is returned.
+func (g GenericEntity) AttributeType(key string) string {
+	return g.types[key]
+}
+
+// SetTypedAttribute sets the value and type of a custom attribute. It can be
+// used to either create or update the attribute.
+func (g *GenericEntity) SetTypedAttribute(key string, attrType string, value interface{}) error {
+	if err := g.SetAttribute(key, value); err != nil {
+		return err
+	}
+
+	if g.types == nil {
+		g.types = map[string]string{}
+	}
+
+	if attrType == "" {
+		delete(g.types, key)
+	} else {
+		g.types[key] = attrType
+	}
+
+	return nil
+}
+
+// RemoveAttribute removes the attribute and its type from the list of custom
+// attributes. If the key does not exist, the function is a no-op.
+func (g *GenericEntity) RemoveAttribute(key string) error {
+	if err := g.EntityObject.RemoveAttribute(key); err != nil {
+		return err
+	}
+
+	delete(g.types, key)
+	return nil
+}
+
+type illuminatedEntity struct {
+	ID         int64                           `json:"id"`
+	CommitID   int64                           `json:"commit_id"`
+	ViewID     int64                           `json:"view_id"`
+	Kind       string                          `json:"kind"`
+	Attributes map[string]illuminatedAttribute `json:"attributes"`
+	Relations  map[string][]illuminatedEdge    `json:"relations"`
+}
+
+type illuminatedAttribute struct {
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+type illuminatedEdge struct {
+	ID       int64                  `json:"id"`
+	Kind     string                 `json:"kind,omitempty"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// MarshalJSON encodes an edge as its commit ID unless it has a kind or
+// metadata.
+func (e illuminatedEdge) MarshalJSON() ([]byte, error) {
+	if e.Kind == "" && len(e.Metadata) == 0 {
+		return json.Marshal(e.ID)
+	}
+
+	type edge illuminatedEdge
+	return json.Marshal(edge(e))
+}
+
+// UnmarshalJSON decodes an edge from either a commit ID or an object.
+func (e *illuminatedEdge) UnmarshalJSON(data []byte) error {
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		*e = illuminatedEdge{}
+		return json.Unmarshal(data, &e.ID)
+	}
+
+	type edge illuminatedEdge
+	var decoded edge
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	*e = illuminatedEdge(decoded)
+	return nil
+}
+
+// MarshalJSON encodes the GenericEntity as an illuminated Entity.
+func (g GenericEntity) MarshalJSON() ([]byte, error) {
+	illuminated := illuminatedEntity{
+		ID:         g.Identifier(),
+		CommitID:   g.CommitID(),
+		ViewID:     g.ViewID(),
+		Kind:       g.Kind(),
+		Attributes: map[string]illuminatedAttribute{},
+		Relations:  map[string][]illuminatedEdge{},
+	}
+
+	for name, value := range g.Attributes() {
+		encoded, err := encodeAttribute(name, reflect.ValueOf(&value).Elem())
+		if err != nil {
+			return nil, err
+		}
+
+		illuminated.Attributes[name] = illuminatedAttribute{
+			Type:  customTypeName(&g, name, value),
+			Value: encoded,
+		}
+	}
+
+	for entityType, edges := range g.Edges() {
+		illuminatedEdges := make([]illuminatedEdge, len(edges))
+		for index, edge := range edges {
+			illuminatedEdges[index] = illuminatedEdge{ID: edge.ID, Kind: edge.Kind, Metadata: edge.Metadata}
+		}
+
+		illuminated.Relations[entityType] = illuminatedEdges
+	}
+
+	return json.Marshal(illuminated)
+}
+
+// UnmarshalJSON decodes an illuminated Entity into the GenericEntity. All
+// attributes and relations are replaced by those in the JSON.
+func (g *GenericEntity) UnmarshalJSON(data []byte) error {
+	var illuminated illuminatedEntity
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&illuminated); err != nil {
+		return err
+	}
+
+	decoded := GenericEntity{}
+	if illuminated.ID != 0 {
+		if err := decoded.SetIdentifier(illuminated.ID); err != nil {
+			return err
+		}
+	}
+	if illuminated.CommitID != 0 {
+		if err := decoded.SetCommitID(illuminated.CommitID); err != nil {
+			return err
+		}
+	}
+	if illuminated.ViewID != 0 {
+		if err := decoded.SetViewID(illuminated.ViewID); err != nil {
+			return err
+		}
+	}
+	if illuminated.Kind != "" {
+		if err := decoded.SetKind(illuminated.Kind); err != nil {
+			return err
+		}
+	}
+
+	for name, attribute := range illuminated.Attributes {
+		if attribute.Type == "" {
+			return fmt.Errorf("Attribute %s must have a type", name)
+		}
+
+		value, err := decodeCustomAttribute(name, attribute.Type, attribute.Value)
+		if err != nil {
+			return err
+		}
+
+		if err := decoded.SetTypedAttribute(name, attribute.Type, value); err != nil {
+			return err
+		}
+	}
+
+	edges := map[string][]Edge{}
+	for entityType, illuminatedEdges := range illuminated.Relations {
+		typeEdges := make([]Edge, len(illuminatedEdges))
+		for index, edge := range illuminatedEdges {
+			if edge.ID < 1 {
+				return errors.New("Entity ID must be greater than 0")
+			}
+
+			metadata, _ := normalizeNumbers(edge.Metadata).(map[string]interface{})
+			typeEdges[index] = Edge{ID: edge.ID, Kind: edge.Kind, Position: index, Metadata: metadata}
+		}
+
+		edges[entityType] = typeEdges
+	}
+	decoded.SetEdges(edges)
+
+	*g = decoded
+	return nil
+}
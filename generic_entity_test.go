@@ -0,0 +1,96 @@
+package gizmo
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/jmataya/gizmo/testutils"
+)
+
+func TestGenericEntity_MarshalJSON(t *testing.T) {
+	entity, err := NewGenericEntity("product")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entity.SetIdentifier(1)
+	entity.SetCommitID(13)
+	entity.SetViewID(1)
+	entity.SetTypedAttribute("title", "string", "My Product")
+	entity.SetTypedAttribute("description", "text", "I'm a product!")
+	entity.SetAttribute("stock", int64(12))
+	entity.SetRelation("sku", 23)
+	entity.SetEdge("bundle", Edge{ID: 24, Metadata: map[string]interface{}{"quantity": 3}})
+	entity.SetEdge("block", Edge{ID: 25, Kind: "banner"})
+
+	got, err := json.Marshal(entity)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"id":1,"commit_id":13,"view_id":1,"kind":"product",` +
+		`"attributes":{"description":{"type":"text","value":"I'm a product!"},` +
+		`"stock":{"type":"int","value":12},"title":{"type":"string","value":"My Product"}},` +
+		`"relations":{"block":[{"id":25,"kind":"banner"}],"bundle":[{"id":24,"metadata":{"quantity":3}}],"sku":[23]}}`
+
+	if string(got) != want {
+		t.Errorf("Marshal(GenericEntity) = %s, want %s", got, want)
+	}
+}
+
+func TestGenericEntity_UnmarshalJSON(t *testing.T) {
+	assert := testutils.NewAssert(t)
+
+	source := `{
+		"id": 1,
+		"commit_id": 13,
+		"view_id": 1,
+		"kind": "product",
+		"attributes": {
+			"title": {"type": "string", "value": "My Product"},
+			"stock": {"type": "int", "value": 12},
+			"weight": {"type": "float", "value": 1.5}
+		},
+		"relations": {
+			"skus": [23, {"id": 24, "kind": "sku", "metadata": {"quantity": 3}}]
+		}
+	}`
+
+	var entity GenericEntity
+	if err := json.Unmarshal([]byte(source), &entity); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(int64(1), entity.Identifier())
+	assert.Equal(int64(13), entity.CommitID())
+	assert.Equal(int64(1), entity.ViewID())
+	assert.Equal("product", entity.Kind())
+
+	title, _ := entity.Attribute("title")
+	assert.Equal("My Product", title)
+	assert.Equal("string", entity.AttributeType("title"))
+
+	stock, _ := entity.Attribute("stock")
+	assert.Equal(int64(12), stock)
+
+	weight, _ := entity.Attribute("weight")
+	assert.Equal(1.5, weight)
+
+	edges, err := entity.EdgesByEntity("skus")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Equal(2, len(edges)) {
+		assert.Equal(int64(23), edges[0].ID)
+		assert.Equal(int64(24), edges[1].ID)
+		assert.Equal(1, edges[1].Position)
+		assert.Equal("", edges[0].Kind)
+		assert.Equal("sku", edges[1].Kind)
+		assert.Equal(3.0, edges[1].Metadata["quantity"])
+	}
+
+	if err := json.Unmarshal([]byte(`{"attributes": {"title": {"value": "x"}}}`), &entity); err == nil {
+		t.Error("Unmarshal of an attribute without a type should fail")
+	}
+}
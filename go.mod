@@ -5,6 +5,7 @@ go 1.17
 require (
 	github.com/gedex/inflector v0.0.0-20170307190818-16278e9db813
 	github.com/lib/pq v0.0.0-20160617163312-55196ec83d60
+	github.com/mattn/go-sqlite3 v1.14.16
 	github.com/sirupsen/logrus v0.11.5
 )
 
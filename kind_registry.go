@@ -0,0 +1,261 @@
+package gizmo
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Kinder is implemented by Entities that declare their kind, instead of having
+// it derived from the name of their Go type. EntityKind is called on the zero
+// value of the type, so it must not depend on the content of the Entity.
+//
+// The kind can also be declared by tagging the embedded EntityObject:
+//
+//	type Product struct {
+//	  gizmo.EntityObject `gizmo:"product"`
+//	}
+type Kinder interface {
+	EntityKind() string
+}
+
+var (
+	kinderInterface        = reflect.TypeOf((*Kinder)(nil)).Elem()
+	entityObjectType       = reflect.TypeOf(EntityObject{})
+	entityUpdaterInterface = reflect.TypeOf((*EntityUpdater)(nil)).Elem()
+)
+
+// kinds maps the kind of an Entity to the Go type that represents it, so that
+// Entities can be loaded without knowing their type in advance.
+var kinds = &kindRegistry{
+	types: map[string]reflect.Type{},
+	names: map[reflect.Type]string{},
+}
+
+type kindRegistry struct {
+	sync.RWMutex
+	types map[string]reflect.Type
+	names map[reflect.Type]string
+}
+
+// RegisterKind associates a kind with the Go type of the prototype, which is
+// either a struct or a pointer to a struct that implements Entity. Entities
+// of the type are saved with the registered kind, so the Go type can be
+// renamed without orphaning its data. Entities of the kind are loaded into the
+// registered type whenever the type isn't known in advance, such as by
+// FindByCommit without a type hint or for a field of type []Entity. Problems
+// with the type that don't prevent its registration are logged to the logger
+// that is set with WithLogger.
+func RegisterKind(kind string, prototype Entity, opts ...Option) error {
+	if kind == "" {
+		return errors.New("Kind must be non-empty")
+	} else if prototype == nil {
+		return errors.New("Prototype must be non-nil")
+	}
+
+	entityType := reflect.TypeOf(prototype)
+	if entityType.Kind() == reflect.Ptr {
+		entityType = entityType.Elem()
+	}
+
+	if entityType.Kind() != reflect.Struct {
+		return fmt.Errorf("Expected prototype of kind %s to be a struct, not %v", kind, entityType)
+	}
+
+	if entityType == genericEntityType {
+		return errors.New("GenericEntity can't be registered to a kind")
+	}
+
+	if !reflect.PtrTo(entityType).Implements(entityUpdaterInterface) {
+		return fmt.Errorf("Type %v of kind %s does not implement EntityUpdater", entityType, kind)
+	}
+
+	if declared, ok, err := declaredKind(entityType); err != nil {
+		return err
+	} else if ok && declared != kind {
+		return fmt.Errorf("Type %v declares kind %s, not %s", entityType, declared, kind)
+	}
+
+	if err := validateEntityType(loggerOf(opts), entityType); err != nil {
+		return err
+	}
+
+	kinds.Lock()
+	defer kinds.Unlock()
+
+	if existing, ok := kinds.types[kind]; ok && existing != entityType {
+		return fmt.Errorf("Kind %s is already registered to %v", kind, existing)
+	} else if existing, ok := kinds.names[entityType]; ok && existing != kind {
+		return fmt.Errorf("Type %v is already registered as kind %s", entityType, existing)
+	}
+
+	kinds.types[kind] = entityType
+	kinds.names[entityType] = kind
+	return nil
+}
+
+// registeredType gets the Go type registered for a kind.
+func registeredType(kind string) (reflect.Type, bool) {
+	kinds.RLock()
+	defer kinds.RUnlock()
+
+	entityType, ok := kinds.types[kind]
+	return entityType, ok
+}
+
+// registeredKind gets the kind registered for a Go type.
+func registeredKind(entityType reflect.Type) (string, bool) {
+	kinds.RLock()
+	defer kinds.RUnlock()
+
+	kind, ok := kinds.names[entityType]
+	return kind, ok
+}
+
+// kindOf determines the kind that an Entity is saved as. A GenericEntity uses
+// the kind set on it. Other types use their registered kind, then their
+// declared kind, and finally the lowercased name of the type. A kind that is
+// registered to a different type is rejected, since the two types would share
+// data.
+func kindOf(entity Entity) (string, error) {
+	entityType := reflect.TypeOf(entity)
+	if entityType.Kind() == reflect.Ptr {
+		entityType = entityType.Elem()
+	}
+
+	if entityType == genericEntityType {
+		if entity.Kind() == "" {
+			return "", errors.New("Kind of GenericEntity must be set before it is saved")
+		}
+
+		return entity.Kind(), nil
+	}
+
+	if kind, ok := registeredKind(entityType); ok {
+		return kind, nil
+	}
+
+	kind, declared, err := declaredKind(entityType)
+	if err != nil {
+		return "", err
+	} else if declared {
+		if registered, ok := registeredType(kind); ok {
+			return "", fmt.Errorf("Type %v declares kind %s, which is registered to %v", entityType, kind, registered)
+		}
+
+		return kind, nil
+	}
+
+	kind = strings.ToLower(entityType.Name())
+	if registered, ok := registeredType(kind); ok {
+		return "", fmt.Errorf("Type %v derives kind %s, which is registered to %v", entityType, kind, registered)
+	}
+
+	return kind, nil
+}
+
+// declaredKind gets the kind that a struct type declares, either through
+// Kinder or a tag on its embedded EntityObject. The second return value
+// reports whether a kind is declared.
+func declaredKind(entityType reflect.Type) (string, bool, error) {
+	tagged := ""
+	for i := 0; i < entityType.NumField(); i++ {
+		field := entityType.Field(i)
+		if field.Anonymous && field.Type == entityObjectType {
+			tagged, _ = field.Tag.Lookup(gizmoTag)
+			break
+		}
+	}
+
+	if !reflect.PtrTo(entityType).Implements(kinderInterface) {
+		return tagged, tagged != "", nil
+	}
+
+	kind := reflect.New(entityType).Interface().(Kinder).EntityKind()
+	if kind == "" {
+		return "", false, fmt.Errorf("Type %v declares an empty kind", entityType)
+	} else if tagged != "" && tagged != kind {
+		return "", false, fmt.Errorf("Type %v declares kind %s, but its EntityObject is tagged with kind %s", entityType, kind, tagged)
+	}
+
+	return kind, true, nil
+}
+
+// validateEntityType checks that the attribute names and relation keys of a
+// struct type are unambiguous, reporting every problem at once. Relation keys
+// that are derived from the name of a field are logged, since renaming the
+// field orphans the relations that are already stored.
+func validateEntityType(logger log.FieldLogger, entityType reflect.Type) error {
+	problems := []string{}
+	attributes := map[string]string{}
+	relations := map[string]string{}
+
+	for i := 0; i < entityType.NumField(); i++ {
+		field := entityType.Field(i)
+		if !fieldIsPublic(field) || field.Anonymous {
+			continue
+		}
+
+		tag, err := parseFieldTag(field)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		} else if tag.skip {
+			continue
+		}
+
+		if !isRelation(field.Type) {
+			if tag.relation {
+				problems = append(problems, fmt.Sprintf("Field %s is tagged as a relation, but %v is not an Entity", field.Name, field.Type))
+			} else if existing, ok := attributes[tag.name]; ok {
+				problems = append(problems, fmt.Sprintf("Fields %s and %s both map attribute %s", existing, field.Name, tag.name))
+			}
+
+			attributes[tag.name] = field.Name
+			continue
+		}
+
+		key := relationKey(field, tag)
+		if existing, ok := relations[key]; ok {
+			problems = append(problems, fmt.Sprintf("Fields %s and %s both map relation %s", existing, field.Name, key))
+		}
+		relations[key] = field.Name
+
+		if !tag.named {
+			logger.Warnf("Relation %s of %v is derived from field %s; declare it with a gizmo tag so that renaming the field doesn't orphan its relations", key, entityType, field.Name)
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("Type %v is invalid: %s", entityType, strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// entityKind determines the kind of a related Entity. Saved Entities know their
+// kind; otherwise it is determined from the Go type.
+func entityKind(entity Entity) string {
+	if kind := entity.Kind(); kind != "" {
+		return kind
+	}
+
+	kind, _ := kindOf(entity)
+	return kind
+}
+
+// newEntityOfKind creates a new Entity of the Go type registered for a kind. If
+// the kind isn't registered, a GenericEntity is created instead.
+func newEntityOfKind(logger log.FieldLogger, kind string) Entity {
+	entityType, ok := registeredType(kind)
+	if !ok {
+		logger.Debugf("Kind %s is not registered, using GenericEntity", kind)
+		return &GenericEntity{}
+	}
+
+	return reflect.New(entityType).Interface().(Entity)
+}
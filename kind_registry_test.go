@@ -0,0 +1,180 @@
+package gizmo
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type Banner struct {
+	EntityObject
+	Headline string
+}
+
+type Video struct {
+	EntityObject
+	URL string
+}
+
+func TestRegisterKind(t *testing.T) {
+	var tests = []struct {
+		kind      string
+		prototype Entity
+		wantErr   string
+	}{
+		{"banner", Banner{}, ""},
+		{"banner", &Banner{}, ""},
+		{"video", &Video{}, ""},
+		{"banner", Video{}, "Kind banner is already registered to gizmo.Banner"},
+		{"clip", Video{}, "Type gizmo.Video is already registered as kind video"},
+		{"", Banner{}, "Kind must be non-empty"},
+		{"empty", nil, "Prototype must be non-nil"},
+	}
+
+	for _, test := range tests {
+		err := RegisterKind(test.kind, test.prototype)
+		if errorMsg(err) != test.wantErr {
+			t.Errorf("RegisterKind(%s, %T) = %s, want %s", test.kind, test.prototype, errorMsg(err), test.wantErr)
+		}
+	}
+}
+
+type Poster struct {
+	EntityObject
+	Caption string
+}
+
+type Billboard struct {
+	EntityObject
+	Caption string
+}
+
+func TestKindOf(t *testing.T) {
+	if err := RegisterKind("poster", Billboard{}); err != nil {
+		t.Fatal(err)
+	}
+
+	generic := &GenericEntity{}
+	generic.SetKind("article")
+
+	var tests = []struct {
+		entity  Entity
+		want    string
+		wantErr string
+	}{
+		{&Billboard{}, "poster", ""},
+		{&Video{}, "video", ""},
+		{&Poster{}, "", "Type gizmo.Poster derives kind poster, which is registered to gizmo.Billboard"},
+		{generic, "article", ""},
+		{&GenericEntity{}, "", "Kind of GenericEntity must be set before it is saved"},
+	}
+
+	for _, test := range tests {
+		got, err := kindOf(test.entity)
+		if errorMsg(err) != test.wantErr {
+			t.Errorf("kindOf(%T) = %s, want %s", test.entity, errorMsg(err), test.wantErr)
+		} else if got != test.want {
+			t.Errorf("kindOf(%T) = %s, want %s", test.entity, got, test.want)
+		}
+	}
+}
+
+func TestNewEntityOfKind(t *testing.T) {
+	if err := RegisterKind("poster", Billboard{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := newEntityOfKind(log.StandardLogger(), "poster").(*Billboard); !ok {
+		t.Errorf("newEntityOfKind(poster) = %T, want *gizmo.Billboard", newEntityOfKind(log.StandardLogger(), "poster"))
+	}
+
+	if _, ok := newEntityOfKind(log.StandardLogger(), "unregistered").(*GenericEntity); !ok {
+		t.Errorf("newEntityOfKind(unregistered) = %T, want *gizmo.GenericEntity", newEntityOfKind(log.StandardLogger(), "unregistered"))
+	}
+}
+
+type Flyer struct {
+	EntityObject
+	Headline string
+}
+
+func (Flyer) EntityKind() string {
+	return "leaflet"
+}
+
+type Mural struct {
+	EntityObject `gizmo:"wall_art"`
+	Artist       string
+}
+
+type Catalog struct {
+	EntityObject
+	Title   string
+	Name    string   `gizmo:"title"`
+	Banners []Banner `gizmo:"promo,relation"`
+	Promos  []Banner `gizmo:"promo"`
+	Cover   string   `gizmo:",relation"`
+}
+
+func TestDeclaredKind(t *testing.T) {
+	var tests = []struct {
+		entity  Entity
+		want    string
+		wantErr string
+	}{
+		{&Flyer{}, "leaflet", ""},
+		{&Mural{}, "wall_art", ""},
+	}
+
+	for _, test := range tests {
+		got, err := kindOf(test.entity)
+		if errorMsg(err) != test.wantErr {
+			t.Errorf("kindOf(%T) = %s, want %s", test.entity, errorMsg(err), test.wantErr)
+		} else if got != test.want {
+			t.Errorf("kindOf(%T) = %s, want %s", test.entity, got, test.want)
+		}
+	}
+}
+
+func TestRegisterKind_Validation(t *testing.T) {
+	var tests = []struct {
+		kind      string
+		prototype Entity
+		wantErr   string
+	}{
+		{"flyer", Flyer{}, "Type gizmo.Flyer declares kind leaflet, not flyer"},
+		{"mural", Mural{}, "Type gizmo.Mural declares kind wall_art, not mural"},
+		{"catalog", Catalog{}, "Type gizmo.Catalog is invalid: " +
+			"Fields Title and Name both map attribute title; " +
+			"Fields Banners and Promos both map relation promo; " +
+			"Field Cover is tagged as a relation, but string is not an Entity"},
+	}
+
+	for _, test := range tests {
+		err := RegisterKind(test.kind, test.prototype)
+		if errorMsg(err) != test.wantErr {
+			t.Errorf("RegisterKind(%s, %T) = %s, want %s", test.kind, test.prototype, errorMsg(err), test.wantErr)
+		}
+	}
+}
+
+type Gallery struct {
+	EntityObject
+	Posters []Poster
+}
+
+func TestRegisterKind_WithLogger(t *testing.T) {
+	var out bytes.Buffer
+	logger := log.New()
+	logger.Out = &out
+
+	if err := RegisterKind("gallery", Gallery{}, WithLogger(logger)); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(out.String(), "Relation poster of gizmo.Gallery is derived from field Posters") {
+		t.Errorf("Expected the logger to receive the warning about Posters, got %q", out.String())
+	}
+}
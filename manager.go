@@ -0,0 +1,259 @@
+package gizmo
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jmataya/gizmo/store"
+	"github.com/lib/pq"
+)
+
+// Manager is an EntityManager that owns its connection to a PostgreSQL
+// database. It is created with NewManager, and must be closed with Close when
+// it is no longer used.
+type Manager struct {
+	EntityManager
+	db    *sql.DB
+	store store.Store
+}
+
+// DB returns the connection pool that the Manager uses.
+func (m *Manager) DB() *sql.DB {
+	return m.db
+}
+
+// Close closes the statements that the Manager has prepared and its
+// connection pool.
+func (m *Manager) Close() error {
+	if closer, ok := m.store.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			m.db.Close()
+			return err
+		}
+	}
+
+	return m.db.Close()
+}
+
+// ManagerOption configures how NewManager connects to the database.
+type ManagerOption func(*managerConfig)
+
+type managerConfig struct {
+	dsn              string
+	params           map[string]string
+	maxOpenConns     int
+	maxIdleConns     int
+	connMaxLifetime  time.Duration
+	statementTimeout time.Duration
+	migrate          bool
+	options          []Option
+}
+
+// WithDSN sets the connection string of the database, either as a URL such as
+// postgres://gizmo@localhost/gizmo or as space-separated key=value pairs.
+// Parameters that are set with the other options take precedence over the
+// ones in the connection string.
+func WithDSN(dsn string) ManagerOption {
+	return func(c *managerConfig) {
+		c.dsn = dsn
+	}
+}
+
+// WithHost sets the host of the database server.
+func WithHost(host string) ManagerOption {
+	return withParam("host", host)
+}
+
+// WithPort sets the port of the database server.
+func WithPort(port int) ManagerOption {
+	return withParam("port", fmt.Sprintf("%d", port))
+}
+
+// WithDBName sets the name of the database.
+func WithDBName(dbName string) ManagerOption {
+	return withParam("dbname", dbName)
+}
+
+// WithCredentials sets the user and password to connect as. The password is
+// ignored if it is empty.
+func WithCredentials(user string, password string) ManagerOption {
+	return func(c *managerConfig) {
+		c.params["user"] = user
+		if password != "" {
+			c.params["password"] = password
+		}
+	}
+}
+
+// WithSSLMode sets the sslmode of the connection, such as disable or
+// verify-full. The driver requires SSL by default.
+func WithSSLMode(mode string) ManagerOption {
+	return withParam("sslmode", mode)
+}
+
+// WithMaxOpenConns sets the maximum number of open connections to the
+// database. By default, it is unlimited.
+func WithMaxOpenConns(n int) ManagerOption {
+	return func(c *managerConfig) {
+		c.maxOpenConns = n
+	}
+}
+
+// WithMaxIdleConns sets the maximum number of idle connections that are kept
+// in the pool.
+func WithMaxIdleConns(n int) ManagerOption {
+	return func(c *managerConfig) {
+		c.maxIdleConns = n
+	}
+}
+
+// WithConnMaxLifetime sets the maximum amount of time that a connection may
+// be reused.
+func WithConnMaxLifetime(d time.Duration) ManagerOption {
+	return func(c *managerConfig) {
+		c.connMaxLifetime = d
+	}
+}
+
+// WithStatementTimeout aborts statements that take longer than d. It sets the
+// statement_timeout of every connection, so it also limits how long a
+// statement waits for a lock.
+func WithStatementTimeout(d time.Duration) ManagerOption {
+	return func(c *managerConfig) {
+		c.statementTimeout = d
+	}
+}
+
+// WithMigrations applies the migrations that the database doesn't have yet
+// when the Manager is created, like Migrate.
+func WithMigrations() ManagerOption {
+	return func(c *managerConfig) {
+		c.migrate = true
+	}
+}
+
+// WithOptions sets the options of the EntityManager, such as WithPropagation
+// and WithLogger.
+func WithOptions(opts ...Option) ManagerOption {
+	return func(c *managerConfig) {
+		c.options = append(c.options, opts...)
+	}
+}
+
+func withParam(key string, value string) ManagerOption {
+	return func(c *managerConfig) {
+		c.params[key] = value
+	}
+}
+
+// NewManager connects to a PostgreSQL database and returns a Manager for it:
+//
+//	mgr, err := gizmo.NewManager(
+//	  gizmo.WithHost("127.0.0.1"),
+//	  gizmo.WithDBName("gizmo"),
+//	  gizmo.WithCredentials("gizmo", "I<3Gizmo"),
+//	  gizmo.WithSSLMode("disable"),
+//	)
+//
+// The database is pinged before the Manager is returned, so that an
+// unreachable database or bad credentials are reported right away.
+func NewManager(opts ...ManagerOption) (*Manager, error) {
+	config := &managerConfig{params: map[string]string{}}
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	dsn, err := config.connectionString()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// The pool keeps the defaults of database/sql for the settings that
+	// aren't configured, since zero idle connections disables the idle pool.
+	if config.maxOpenConns > 0 {
+		db.SetMaxOpenConns(config.maxOpenConns)
+	}
+	if config.maxIdleConns > 0 {
+		db.SetMaxIdleConns(config.maxIdleConns)
+	}
+	if config.connMaxLifetime > 0 {
+		db.SetConnMaxLifetime(config.connMaxLifetime)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s := store.NewPostgresStore(db)
+	mgr := newPostgresEntityManager(db, s, config.options)
+
+	if config.migrate {
+		applied, err := Migrate(db, WithLogger(mgr.logger))
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+
+		for _, migration := range applied {
+			mgr.logger.Infof("Applied migration %s (%s)", migration.Version, migration.Description)
+		}
+	}
+
+	return &Manager{EntityManager: mgr, db: db, store: s}, nil
+}
+
+// connectionString builds the connection string that is passed to the
+// driver. Later parameters override earlier ones, so the parameters of the
+// options are appended to the DSN.
+func (c *managerConfig) connectionString() (string, error) {
+	dsn := c.dsn
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		var err error
+		if dsn, err = pq.ParseURL(dsn); err != nil {
+			return "", err
+		}
+	}
+
+	params := map[string]string{}
+	for key, value := range c.params {
+		params[key] = value
+	}
+	if c.statementTimeout > 0 {
+		params["statement_timeout"] = fmt.Sprintf("%d", c.statementTimeout/time.Millisecond)
+	}
+
+	pairs := []string{}
+	if dsn != "" {
+		pairs = append(pairs, dsn)
+	}
+
+	// The keys are written in a fixed order, so that the connection string
+	// is the same for the same options.
+	for _, key := range []string{"host", "port", "dbname", "user", "password", "sslmode", "statement_timeout"} {
+		if value, ok := params[key]; ok {
+			pairs = append(pairs, key+"="+quoteParam(value))
+		}
+	}
+
+	return strings.Join(pairs, " "), nil
+}
+
+// quoteParam quotes a value of a connection string if it is empty or contains
+// spaces, quotes, or backslashes.
+func quoteParam(value string) string {
+	if value != "" && !strings.ContainsAny(value, ` '\`) {
+		return value
+	}
+
+	escaper := strings.NewReplacer(`'`, `\'`, `\`, `\\`)
+	return "'" + escaper.Replace(value) + "'"
+}
@@ -0,0 +1,115 @@
+package gizmo
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jmataya/gizmo/models"
+)
+
+func TestManagerConfig_ConnectionString(t *testing.T) {
+	var tests = []struct {
+		name string
+		opts []ManagerOption
+		want string
+	}{
+		{
+			name: "Parameters",
+			opts: []ManagerOption{
+				WithHost("127.0.0.1"),
+				WithDBName("gizmo"),
+				WithCredentials("gizmo", "I<3Gizmo"),
+				WithSSLMode("disable"),
+			},
+			want: "host=127.0.0.1 dbname=gizmo user=gizmo password=I<3Gizmo sslmode=disable",
+		},
+		{
+			name: "Empty password",
+			opts: []ManagerOption{WithCredentials("gizmo", "")},
+			want: "user=gizmo",
+		},
+		{
+			name: "Quoted values",
+			opts: []ManagerOption{WithCredentials("gizmo", `it's a \secret`)},
+			want: `user=gizmo password='it\'s a \\secret'`,
+		},
+		{
+			name: "Key-value DSN",
+			opts: []ManagerOption{WithDSN("dbname=gizmo sslmode=require"), WithSSLMode("disable")},
+			want: "dbname=gizmo sslmode=require sslmode=disable",
+		},
+		{
+			name: "URL DSN",
+			opts: []ManagerOption{WithDSN("postgres://gizmo@localhost:5433/gizmo"), WithPort(5432)},
+			want: "dbname=gizmo host=localhost port=5433 user=gizmo port=5432",
+		},
+		{
+			name: "Statement timeout",
+			opts: []ManagerOption{WithDBName("gizmo"), WithStatementTimeout(2 * time.Second)},
+			want: "dbname=gizmo statement_timeout=2000",
+		},
+	}
+
+	for _, test := range tests {
+		config := &managerConfig{params: map[string]string{}}
+		for _, opt := range test.opts {
+			opt(config)
+		}
+
+		got, err := config.connectionString()
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err.Error())
+		} else if got != test.want {
+			t.Errorf("%s: connectionString() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestNewManager_Unreachable(t *testing.T) {
+	mgr, err := NewManager(WithHost("127.0.0.1"), WithPort(1), WithSSLMode("disable"))
+	if err == nil {
+		mgr.Close()
+		t.Fatal("Expected connecting to an unreachable database to fail")
+	}
+}
+
+func TestNewManager(t *testing.T) {
+	dbName := os.Getenv("DB_NAME")
+	if dbName == "" {
+		dbName = "gizmo_test"
+	}
+
+	user := os.Getenv("DB_USER")
+	if user == "" {
+		user = "gizmo"
+	}
+
+	mgr, err := NewManager(
+		WithDBName(dbName),
+		WithCredentials(user, os.Getenv("DB_PASSWORD")),
+		WithSSLMode("disable"),
+		WithMaxOpenConns(4),
+		WithStatementTimeout(10*time.Second),
+		WithMigrations())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mgr.Close()
+
+	view := models.CreateView(t, mgr.DB())
+
+	created, err := mgr.Create(&SKU{Price: 100}, view.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := SKU{}
+	if err := mgr.Find(created.Identifier(), view.ID, &found); err != nil {
+		t.Fatal(err)
+	}
+
+	if found.Price != 100 {
+		t.Errorf("Expected price 100, got %f", found.Price)
+	}
+}
@@ -0,0 +1,290 @@
+package gizmo
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"embed"
+	"fmt"
+	"hash/crc32"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// migrationLockID identifies the advisory lock that is held while migrating,
+// so that concurrent runners apply every migration exactly once.
+const migrationLockID = 0x67697a6d6f
+
+const (
+	sqlLockMigrations = "SELECT pg_advisory_xact_lock($1)"
+
+	// The schema_version table has the layout that Flyway uses, so databases
+	// that were migrated with Flyway are recognized as up to date.
+	sqlCreateSchemaVersion = `
+		CREATE TABLE IF NOT EXISTS schema_version (
+			installed_rank integer NOT NULL PRIMARY KEY,
+			version varchar(50),
+			description varchar(200) NOT NULL,
+			type varchar(20) NOT NULL,
+			script varchar(1000) NOT NULL,
+			checksum integer,
+			installed_by varchar(100) NOT NULL,
+			installed_on timestamp NOT NULL DEFAULT now(),
+			execution_time integer NOT NULL,
+			success boolean NOT NULL
+		)
+	`
+
+	sqlSelectAppliedVersions = "SELECT version, checksum FROM schema_version WHERE success AND version IS NOT NULL"
+
+	// Newer versions of Flyway record migrations in flyway_schema_history.
+	sqlSelectFlywayVersions = "SELECT version, checksum FROM flyway_schema_history WHERE success AND version IS NOT NULL"
+	sqlHasFlywayHistory     = "SELECT to_regclass('flyway_schema_history') IS NOT NULL"
+
+	sqlInsertSchemaVersion = `
+		INSERT INTO schema_version (installed_rank, version, description, type, script, checksum, installed_by, execution_time, success)
+		SELECT COALESCE(MAX(installed_rank), 0) + 1, $1, $2, 'SQL', $3, $4, current_user, $5, true
+		FROM schema_version
+	`
+)
+
+//go:embed sql/*.sql
+var migrationFiles embed.FS
+
+// Migration is a versioned SQL script that is part of the schema of gizmo.
+// Scripts are named V<version>__<description>.sql.
+type Migration struct {
+	Version     string
+	Description string
+	Script      string
+}
+
+// Migrate brings the schema of a Postgres database up to date by applying
+// the migrations that are embedded in gizmo. Applied migrations are recorded
+// in the schema_version table, and only the ones that aren't recorded yet are
+// applied, in the order of their versions. All of them are applied in a
+// single transaction, which holds an advisory lock so that concurrent runners
+// wait for each other instead of applying the same migration twice.
+//
+// Migrate returns the migrations that it applied, which are none if the
+// database is already up to date. It fails without applying anything if an
+// applied migration was changed since, which is detected by its checksum.
+// Migrations are logged to the logger that is set with WithLogger.
+func Migrate(db *sql.DB, opts ...Option) ([]Migration, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := migrate(loggerOf(opts), tx, migrations)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return applied, tx.Commit()
+}
+
+func migrate(logger log.FieldLogger, tx *sql.Tx, migrations []Migration) ([]Migration, error) {
+	if _, err := tx.Exec(sqlLockMigrations, migrationLockID); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(sqlCreateSchemaVersion); err != nil {
+		return nil, err
+	}
+
+	versions, err := appliedVersions(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := []Migration{}
+	for _, migration := range migrations {
+		script, err := migrationFiles.ReadFile(path.Join("sql", migration.Script))
+		if err != nil {
+			return nil, err
+		}
+
+		checksum, err := migrationChecksum(script)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to compute the checksum of migration %s: %s", migration.Script, err.Error())
+		}
+
+		if recorded, ok := versions[migration.Version]; ok {
+			if err := verifyChecksum(migration, checksum, recorded); err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		logger.Debugf("Applying migration %s (%s)", migration.Version, migration.Description)
+		start := time.Now()
+		if _, err := tx.Exec(string(script)); err != nil {
+			return nil, fmt.Errorf("Unable to apply migration %s: %s", migration.Script, err.Error())
+		}
+
+		elapsed := int(time.Since(start) / time.Millisecond)
+		_, err = tx.Exec(sqlInsertSchemaVersion,
+			migration.Version,
+			migration.Description,
+			migration.Script,
+			checksum,
+			elapsed)
+		if err != nil {
+			return nil, err
+		}
+
+		applied = append(applied, migration)
+	}
+
+	return applied, nil
+}
+
+// appliedVersions gets the checksums of the migrations that were applied by
+// Migrate or by Flyway, by version. The checksum is null if it wasn't
+// recorded.
+func appliedVersions(tx *sql.Tx) (map[string]sql.NullInt32, error) {
+	versions := map[string]sql.NullInt32{}
+	if err := scanVersions(tx, sqlSelectAppliedVersions, versions); err != nil {
+		return nil, err
+	}
+
+	var hasFlywayHistory bool
+	if err := tx.QueryRow(sqlHasFlywayHistory).Scan(&hasFlywayHistory); err != nil {
+		return nil, err
+	} else if hasFlywayHistory {
+		if err := scanVersions(tx, sqlSelectFlywayVersions, versions); err != nil {
+			return nil, err
+		}
+	}
+
+	return versions, nil
+}
+
+func scanVersions(tx *sql.Tx, query string, versions map[string]sql.NullInt32) error {
+	rows, err := tx.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version string
+		var checksum sql.NullInt32
+		if err := rows.Scan(&version, &checksum); err != nil {
+			return err
+		}
+
+		versions[version] = checksum
+	}
+
+	return rows.Err()
+}
+
+// verifyChecksum checks that the checksum that was recorded when a migration
+// was applied matches the checksum of its embedded script. Migrations without
+// a recorded checksum can't be checked, and are assumed to be unchanged.
+func verifyChecksum(migration Migration, checksum int32, recorded sql.NullInt32) error {
+	if recorded.Valid && recorded.Int32 != checksum {
+		return fmt.Errorf("Migration %s has changed since it was applied: its checksum is %d, but %d was recorded", migration.Script, checksum, recorded.Int32)
+	}
+
+	return nil
+}
+
+// loadMigrations lists the embedded migrations ordered by version.
+func loadMigrations() ([]Migration, error) {
+	files, err := migrationFiles.ReadDir("sql")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := []Migration{}
+	for _, file := range files {
+		name := strings.TrimSuffix(file.Name(), ".sql")
+		parts := strings.SplitN(strings.TrimPrefix(name, "V"), "__", 2)
+		if !strings.HasPrefix(name, "V") || len(parts) != 2 {
+			return nil, fmt.Errorf("Migration %s must be named V<version>__<description>.sql", file.Name())
+		}
+
+		if _, err := versionParts(parts[0]); err != nil {
+			return nil, fmt.Errorf("Migration %s has an invalid version: %s", file.Name(), err.Error())
+		}
+
+		migrations = append(migrations, Migration{
+			Version:     parts[0],
+			Description: strings.Replace(parts[1], "_", " ", -1),
+			Script:      file.Name(),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return compareVersions(migrations[i].Version, migrations[j].Version) < 0
+	})
+
+	return migrations, nil
+}
+
+// compareVersions compares two versions part by part, so that 1.10 comes
+// after 1.9.
+func compareVersions(a string, b string) int {
+	partsA, _ := versionParts(a)
+	partsB, _ := versionParts(b)
+
+	for index := 0; index < len(partsA) && index < len(partsB); index++ {
+		if partsA[index] != partsB[index] {
+			if partsA[index] < partsB[index] {
+				return -1
+			}
+
+			return 1
+		}
+	}
+
+	return len(partsA) - len(partsB)
+}
+
+func versionParts(version string) ([]int64, error) {
+	parts := []int64{}
+	for _, part := range strings.Split(version, ".") {
+		number, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		parts = append(parts, number)
+	}
+
+	return parts, nil
+}
+
+// migrationChecksum computes the checksum of a script the way that Flyway
+// does: the CRC-32 of its lines, without line terminators. The buffer of the
+// scanner fits the whole script, so that long lines are never cut off.
+func migrationChecksum(script []byte) (int32, error) {
+	checksum := crc32.NewIEEE()
+
+	scanner := bufio.NewScanner(bytes.NewReader(bytes.TrimPrefix(script, []byte("\xef\xbb\xbf"))))
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), len(script)+1)
+	for scanner.Scan() {
+		checksum.Write(scanner.Bytes())
+	}
+
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	return int32(checksum.Sum32()), nil
+}
@@ -0,0 +1,156 @@
+package gizmo
+
+import (
+	"database/sql"
+	"hash/crc32"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jmataya/gizmo/testutils"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scripts, err := filepath.Glob("sql/*.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(migrations) != len(scripts) {
+		t.Fatalf("Expected %d migrations, got %d", len(scripts), len(migrations))
+	}
+
+	first := migrations[0]
+	if first.Version != "20161113.164321" || first.Description != "domains" || first.Script != "V20161113.164321__domains.sql" {
+		t.Errorf("Unexpected first migration %+v", first)
+	}
+
+	for index := 1; index < len(migrations); index++ {
+		if compareVersions(migrations[index-1].Version, migrations[index].Version) >= 0 {
+			t.Errorf("Migration %s is ordered before %s", migrations[index-1].Version, migrations[index].Version)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	var tests = []struct {
+		a    string
+		b    string
+		want int
+	}{
+		{"1", "1", 0},
+		{"1.9", "1.10", -1},
+		{"20170409.222511", "20161113.164321", 1},
+		{"1", "1.1", -1},
+	}
+
+	for _, test := range tests {
+		got := compareVersions(test.a, test.b)
+		if (got < 0) != (test.want < 0) || (got > 0) != (test.want > 0) {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestMigrationChecksum(t *testing.T) {
+	want := int32(crc32.ChecksumIEEE([]byte("create table a ();drop table a;")))
+
+	var tests = []string{
+		"create table a ();\ndrop table a;\n",
+		"create table a ();\r\ndrop table a;",
+		"\xef\xbb\xbfcreate table a ();\ndrop table a;\n",
+	}
+
+	for _, script := range tests {
+		if got, err := migrationChecksum([]byte(script)); err != nil {
+			t.Errorf("migrationChecksum(%q) got error %s, want none", script, err.Error())
+		} else if got != want {
+			t.Errorf("migrationChecksum(%q) = %d, want %d", script, got, want)
+		}
+	}
+
+	// Lines longer than the default limit of bufio.Scanner are included in
+	// full.
+	long := strings.Repeat("x", 100*1024)
+	if got, err := migrationChecksum([]byte("select 1;\n" + long + "\n")); err != nil {
+		t.Errorf("migrationChecksum(long line) got error %s, want none", err.Error())
+	} else if want := int32(crc32.ChecksumIEEE([]byte("select 1;" + long))); got != want {
+		t.Errorf("migrationChecksum(long line) = %d, want %d", got, want)
+	}
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	migration := Migration{Version: "1", Description: "domains", Script: "V1__domains.sql"}
+
+	var tests = []struct {
+		recorded sql.NullInt32
+		wantErr  string
+	}{
+		{sql.NullInt32{Int32: 42, Valid: true}, ""},
+		{sql.NullInt32{}, ""},
+		{sql.NullInt32{Int32: 7, Valid: true}, "Migration V1__domains.sql has changed since it was applied: its checksum is 42, but 7 was recorded"},
+	}
+
+	for _, test := range tests {
+		err := verifyChecksum(migration, 42, test.recorded)
+		if errorMsg(err) != test.wantErr {
+			t.Errorf("verifyChecksum(%+v) = %s, want %s", test.recorded, errorMsg(err), test.wantErr)
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	db := testutils.InitDB(t)
+	defer db.Close()
+
+	if _, err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := Migrate(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(applied) != 0 {
+		t.Errorf("Expected an up to date database to apply no migrations, applied %v", applied)
+	}
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := migrations[0]
+	script, err := migrationFiles.ReadFile(path.Join("sql", first.Script))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checksum, err := migrationChecksum(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := db.Exec("UPDATE schema_version SET checksum = $1 WHERE version = $2", checksum+1, first.Version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec("UPDATE schema_version SET checksum = $1 WHERE version = $2", checksum, first.Version)
+
+	if changed, err := result.RowsAffected(); err != nil {
+		t.Fatal(err)
+	} else if changed == 0 {
+		t.Skipf("Migration %s was applied by Flyway", first.Script)
+	}
+
+	if _, err := Migrate(db); err == nil {
+		t.Errorf("Expected a changed migration %s to fail", first.Script)
+	}
+}
@@ -0,0 +1,111 @@
+package models
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// attributeRefPrefix names the digest algorithm of an attribute ref.
+const attributeRefPrefix = "sha256:"
+
+// AttributeRef computes the ref that a value is stored under in an
+// ObjectForm. Refs are content addresses of the form
+//
+//	sha256:<64 lowercase hexadecimal digits>
+//
+// where the digest is the SHA-256 of the canonical JSON encoding of the value.
+// The canonical encoding has no insignificant whitespace, sorts object keys,
+// doesn't escape HTML characters, and writes every number in its shortest
+// form, so 1.0 and 1 have the same ref. Equal values therefore always have
+// equal refs, whether they were just encoded or read back from the database.
+func AttributeRef(value interface{}) (string, error) {
+	canonical, err := canonicalJSON(value)
+	if err != nil {
+		return "", err
+	}
+
+	digest := sha256.Sum256(canonical)
+	return attributeRefPrefix + hex.EncodeToString(digest[:]), nil
+}
+
+// IsAttributeRef determines whether a ref has the format of AttributeRef.
+// Refs written by older versions of gizmo don't.
+func IsAttributeRef(ref string) bool {
+	if !strings.HasPrefix(ref, attributeRefPrefix) {
+		return false
+	}
+
+	digest := ref[len(attributeRefPrefix):]
+	if len(digest) != hex.EncodedLen(sha256.Size) || strings.ToLower(digest) != digest {
+		return false
+	}
+
+	_, err := hex.DecodeString(digest)
+	return err == nil
+}
+
+func canonicalJSON(value interface{}) ([]byte, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded interface{}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	if err := decoder.Decode(&decoded); err != nil {
+		return nil, err
+	}
+
+	canonical := new(bytes.Buffer)
+	encoder := json.NewEncoder(canonical)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(canonicalNumbers(decoded)); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimSuffix(canonical.Bytes(), []byte("\n")), nil
+}
+
+// canonicalNumbers rewrites every number in a decoded JSON value in its
+// shortest form. Integers that don't fit in an int64 are kept as they are.
+func canonicalNumbers(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, elem := range value {
+			value[key] = canonicalNumbers(elem)
+		}
+
+		return value
+	case []interface{}:
+		for index, elem := range value {
+			value[index] = canonicalNumbers(elem)
+		}
+
+		return value
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return json.Number(strconv.FormatInt(i, 10))
+		} else if !strings.ContainsAny(value.String(), ".eE") {
+			return value
+		}
+
+		f, err := value.Float64()
+		if err != nil {
+			return value
+		}
+
+		encoded, err := json.Marshal(f)
+		if err != nil {
+			return value
+		}
+
+		return json.Number(encoded)
+	default:
+		return value
+	}
+}
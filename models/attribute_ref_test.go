@@ -0,0 +1,81 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestAttributeRef(t *testing.T) {
+	var tests = []struct {
+		value interface{}
+		want  string
+	}{
+		{"a product", "sha256:7ab0a9d6d58b01e988d3c6cc58580214461ef1947690aed20f1b5ead134c7969"},
+		{map[string]interface{}{"currency": "USD", "amount": 1299}, "sha256:e36fb15695b8d99f30311d4bf31912277210c83cd65f3f821b99a3d39a3be5c8"},
+	}
+
+	for _, test := range tests {
+		got, err := AttributeRef(test.value)
+		if err != nil {
+			t.Fatal(err)
+		} else if got != test.want {
+			t.Errorf("AttributeRef(%v) = %s, want %s", test.value, got, test.want)
+		}
+	}
+}
+
+func TestAttributeRef_Canonical(t *testing.T) {
+	var tests = []struct {
+		a     interface{}
+		b     interface{}
+		equal bool
+	}{
+		{1, json.Number("1.0"), true},
+		{2.5, json.Number("2.50"), true},
+		{int64(1299), json.Number("1299"), true},
+		{json.Number("12345678901234567890"), json.Number("12345678901234567890"), true},
+		{map[string]interface{}{"a": 1, "b": []interface{}{"x"}}, map[string]interface{}{"b": []string{"x"}, "a": json.Number("1")}, true},
+		{"<b>bold</b>", "<b>bold</b>", true},
+		{"1", 1, false},
+		{[]interface{}{1, 2}, []interface{}{2, 1}, false},
+		{nil, "", false},
+	}
+
+	for _, test := range tests {
+		refA, err := AttributeRef(test.a)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		refB, err := AttributeRef(test.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if (refA == refB) != test.equal {
+			t.Errorf("AttributeRef(%v) == AttributeRef(%v) is %t, want %t", test.a, test.b, refA == refB, test.equal)
+		}
+	}
+}
+
+func TestIsAttributeRef(t *testing.T) {
+	digest := strings.Repeat("0a", 32)
+
+	var tests = []struct {
+		ref  string
+		want bool
+	}{
+		{"sha256:" + digest, true},
+		{"sha256:" + strings.ToUpper(digest), false},
+		{"sha256:" + digest[2:], false},
+		{"sha1:" + digest, false},
+		{"22612070726f64756374220ada39a3ee5e6b4b0d3255bfef95601890afd80709", false},
+	}
+
+	for _, test := range tests {
+		if got := IsAttributeRef(test.ref); got != test.want {
+			t.Errorf("IsAttributeRef(%s) = %t, want %t", test.ref, got, test.want)
+		}
+	}
+}
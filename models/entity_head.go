@@ -5,12 +5,50 @@ import (
 	"time"
 
 	"github.com/jmataya/gizmo/common"
+	"github.com/jmataya/gizmo/dal"
 )
 
 const (
-	sqlInsertEntityHead = "INSERT INTO entity_heads (root_id, view_id, version_id) VALUES ($1, $2, $3) RETURNING *"
+	sqlInsertEntityHead = `
+		INSERT INTO entity_heads (root_id, view_id, version_id) VALUES ($1, $2, $3)
+		RETURNING id, root_id, view_id, version_id, created_at, updated_at, archived_at
+	`
+
+	sqlSelectEntityHead = `
+		SELECT id, root_id, view_id, version_id, created_at, updated_at, archived_at
+		FROM entity_heads
+		WHERE root_id = $1 AND view_id = $2 AND archived_at IS NULL
+	`
+
+	sqlSelectEntityHeadForUpdate = sqlSelectEntityHead + " FOR UPDATE"
+
+	sqlSelectEntityHeadsByRelation = `
+		SELECT h.id, h.root_id, h.view_id, h.version_id, h.created_at, h.updated_at, h.archived_at
+		FROM entity_heads AS h
+		INNER JOIN entity_versions AS v ON h.version_id = v.id
+		WHERE h.view_id = $1 AND h.archived_at IS NULL AND EXISTS (
+			SELECT 1 FROM jsonb_each(v.relations) AS r
+			WHERE r.value @> jsonb_build_array(jsonb_build_object('id', $2::integer))
+		)
+		ORDER BY h.id
+		FOR UPDATE OF h
+	`
+
+	sqlUpdateEntityHead = `
+		UPDATE entity_heads SET version_id = $1, updated_at = (now() at time zone 'utc')
+		WHERE id = $2 AND archived_at IS NULL
+		RETURNING id, root_id, view_id, version_id, created_at, updated_at, archived_at
+	`
+
+	sqlArchiveEntityHead = `
+		UPDATE entity_heads SET archived_at = (now() at time zone 'utc')
+		WHERE id = $1 AND archived_at IS NULL
+		RETURNING id, root_id, view_id, version_id, created_at, updated_at, archived_at
+	`
 )
 
+// EntityHead points an EntityRoot to the EntityVersion that is current within
+// a View.
 type EntityHead struct {
 	ID        int64
 	RootID    int64
@@ -22,6 +60,65 @@ type EntityHead struct {
 	ArchivedAt *time.Time
 }
 
+// Identifier returns the primary key of the EntityHead.
+func (head EntityHead) Identifier() int64 {
+	return head.ID
+}
+
+// FindEntityHead retrieves the live EntityHead for an EntityRoot in a View.
+func FindEntityHead(db common.DB, rootID int64, viewID int64) (EntityHead, error) {
+	return findEntityHead(db, sqlSelectEntityHead, rootID, viewID)
+}
+
+// FindEntityHeadForUpdate retrieves the live EntityHead for an EntityRoot in a
+// View and locks it until the end of the current transaction.
+func FindEntityHeadForUpdate(db common.DB, rootID int64, viewID int64) (EntityHead, error) {
+	return findEntityHead(db, sqlSelectEntityHeadForUpdate, rootID, viewID)
+}
+
+// FindEntityHeadsByRelation retrieves and locks the live EntityHeads in a View
+// whose current EntityVersion has a relation to the EntityVersion versionID.
+func FindEntityHeadsByRelation(db common.DB, viewID int64, versionID int64) ([]EntityHead, error) {
+	if viewID == 0 {
+		return nil, fmt.Errorf(errFieldMustBeGreaterThanZero, "viewID")
+	} else if versionID == 0 {
+		return nil, fmt.Errorf(errFieldMustBeGreaterThanZero, "versionID")
+	}
+
+	heads := []EntityHead{}
+
+	d := dal.NewDataAccessLayer(db)
+	d.ScanRows(d.Query(sqlSelectEntityHeadsByRelation, viewID, versionID), func(row dal.Scanner) error {
+		var head EntityHead
+		if err := row.Scan(head.columns()...); err != nil {
+			return err
+		}
+
+		heads = append(heads, head)
+		return nil
+	})
+
+	if err := d.Result(); err != nil {
+		return nil, err
+	}
+
+	return heads, nil
+}
+
+func findEntityHead(db common.DB, query string, rootID int64, viewID int64) (EntityHead, error) {
+	var head EntityHead
+
+	if rootID == 0 {
+		return head, fmt.Errorf(errFieldMustBeGreaterThanZero, "rootID")
+	} else if viewID == 0 {
+		return head, fmt.Errorf(errFieldMustBeGreaterThanZero, "viewID")
+	}
+
+	d := dal.NewDataAccessLayer(db)
+	d.Scan(d.QueryRow(query, rootID, viewID), head.columns()...)
+	return head, d.Result()
+}
+
 func (head EntityHead) Validate() error {
 	if head.ViewID == 0 {
 		return fmt.Errorf(errFieldMustBeNonEmpty, "ViewID")
@@ -35,29 +132,43 @@ func (head EntityHead) Validate() error {
 }
 
 func (head EntityHead) Insert(db common.DB) (EntityHead, error) {
-	if err := head.Validate(); err != nil {
-		return head, err
-	}
+	var newHead EntityHead
 
-	if head.ID != 0 {
-		return head, fmt.Errorf(errNoInsertHasPrimaryKey, "EntityHead")
-	}
+	d := dal.NewDataAccessLayer(db)
+	d.ValidateInsert(head)
+	d.Scan(d.QueryRow(sqlInsertEntityHead, head.RootID, head.ViewID, head.VersionID), newHead.columns()...)
+	return newHead, d.Result()
+}
 
-	stmt, err := db.Prepare(sqlInsertEntityHead)
-	if err != nil {
-		return head, err
-	}
+// Update moves the EntityHead to point at its VersionID and returns a copy of
+// the EntityHead with the values that were saved.
+func (head EntityHead) Update(db common.DB) (EntityHead, error) {
+	var updated EntityHead
 
-	var newHead EntityHead
-	row := stmt.QueryRow(head.RootID, head.ViewID, head.VersionID)
-	err = row.Scan(
-		&newHead.ID,
-		&newHead.RootID,
-		&newHead.ViewID,
-		&newHead.VersionID,
-		&newHead.CreatedAt,
-		&newHead.UpdatedAt,
-		&newHead.ArchivedAt)
-
-	return newHead, err
+	d := dal.NewDataAccessLayer(db)
+	d.ValidateUpdate(head)
+	d.Scan(d.QueryRow(sqlUpdateEntityHead, head.VersionID, head.ID), updated.columns()...)
+	return updated, d.Result()
+}
+
+// Archive marks the EntityHead as archived, removing the Entity from its View.
+func (head EntityHead) Archive(db common.DB) (EntityHead, error) {
+	var archived EntityHead
+
+	d := dal.NewDataAccessLayer(db)
+	d.ValidateIdentifier(head)
+	d.Scan(d.QueryRow(sqlArchiveEntityHead, head.ID), archived.columns()...)
+	return archived, d.Result()
+}
+
+func (head *EntityHead) columns() []interface{} {
+	return []interface{}{
+		&head.ID,
+		&head.RootID,
+		&head.ViewID,
+		&head.VersionID,
+		&head.CreatedAt,
+		&head.UpdatedAt,
+		&head.ArchivedAt,
+	}
 }
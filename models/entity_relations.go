@@ -1,6 +1,7 @@
 package models
 
 import (
+	"bytes"
 	"database/sql/driver"
 	"encoding/json"
 	"errors"
@@ -9,16 +10,106 @@ import (
 // EntityRelations is a map graphs the linkage of an entity (the EntityVersion
 // that includes this value) to the commit IDs of other entity versions. The
 // string in the map represents the version kind of the destination of the
-// mapping.
-type EntityRelations map[string][]int64
+// mapping, and the edges are ordered by their position.
+type EntityRelations map[string][]RelationEdge
+
+// RelationEdge is a single link from an EntityVersion to another
+// EntityVersion, with optional metadata describing the link.
+type RelationEdge struct {
+	ID       int64                  `json:"id"`
+	Kind     string                 `json:"kind,omitempty"`
+	Position int                    `json:"position"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
 
 // NewEntityRelations initializes a new EntityRelations object based on a map
-// of relations.
+// of relations. Each commit ID is positioned by its index.
 func NewEntityRelations(relations map[string][]int64) EntityRelations {
-	entityRelations := EntityRelations(relations)
+	entityRelations := EntityRelations{}
+	for kind, ids := range relations {
+		edges := make([]RelationEdge, len(ids))
+		for index, id := range ids {
+			edges[index] = RelationEdge{ID: id, Position: index}
+		}
+
+		entityRelations[kind] = edges
+	}
+
 	return entityRelations
 }
 
+// IDs gets the commit IDs of the relations, grouped by kind.
+func (er EntityRelations) IDs() map[string][]int64 {
+	relations := map[string][]int64{}
+	for kind, edges := range er {
+		ids := make([]int64, len(edges))
+		for index, edge := range edges {
+			ids[index] = edge.ID
+		}
+
+		relations[kind] = ids
+	}
+
+	return relations
+}
+
+// ReplaceVersion returns a copy of the relations in which every link to the
+// entity version oldID is replaced by a link to newID. The second return value
+// reports whether any link was replaced.
+func (er EntityRelations) ReplaceVersion(oldID int64, newID int64) (EntityRelations, bool) {
+	replaced := false
+	relations := EntityRelations{}
+
+	for kind, edges := range er {
+		updatedEdges := make([]RelationEdge, len(edges))
+		for index, edge := range edges {
+			if edge.ID == oldID {
+				edge.ID = newID
+				replaced = true
+			}
+
+			updatedEdges[index] = edge
+		}
+
+		relations[kind] = updatedEdges
+	}
+
+	return relations, replaced
+}
+
+// UnmarshalJSON decodes the relations from JSON. Besides edge objects, it
+// accepts the bare commit IDs that earlier versions of the relations stored.
+func (er *EntityRelations) UnmarshalJSON(data []byte) error {
+	raw := map[string][]json.RawMessage{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	relations := EntityRelations{}
+	for kind, values := range raw {
+		edges := make([]RelationEdge, len(values))
+		for index, value := range values {
+			if bytes.HasPrefix(bytes.TrimSpace(value), []byte("{")) {
+				if err := json.Unmarshal(value, &edges[index]); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			edges[index].Position = index
+			if err := json.Unmarshal(value, &edges[index].ID); err != nil {
+				return err
+			}
+		}
+
+		relations[kind] = edges
+	}
+
+	*er = relations
+	return nil
+}
+
 // Scan is an interface for getting JSON out of the database and turns it into a
 // struct.
 func (er *EntityRelations) Scan(src interface{}) error {
@@ -32,5 +123,9 @@ func (er *EntityRelations) Scan(src interface{}) error {
 
 // Value converts the struct to a byte array of JSON.
 func (er *EntityRelations) Value() (driver.Value, error) {
+	if er == nil || *er == nil {
+		return []byte("{}"), nil
+	}
+
 	return json.Marshal(er)
 }
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/jmataya/gizmo/testutils"
+)
+
+func TestEntityRelations_UnmarshalJSON(t *testing.T) {
+	assert := testutils.NewAssert(t)
+
+	var tests = []struct {
+		source string
+		want   []RelationEdge
+	}{
+		{`{"sku": [4, 5]}`, []RelationEdge{{ID: 4, Position: 0}, {ID: 5, Position: 1}}},
+		{`{"sku": [{"id": 4, "position": 0, "metadata": {"quantity": 3}}]}`, []RelationEdge{{ID: 4, Position: 0}}},
+		{`{"sku": []}`, []RelationEdge{}},
+	}
+
+	for _, test := range tests {
+		var relations EntityRelations
+		if err := json.Unmarshal([]byte(test.source), &relations); err != nil {
+			t.Errorf("Unmarshal(%s) got error %s, want none", test.source, err.Error())
+			continue
+		}
+
+		got := relations["sku"]
+		if !assert.Equal(len(test.want), len(got)) {
+			continue
+		}
+
+		for index, edge := range got {
+			assert.Equal(test.want[index].ID, edge.ID)
+			assert.Equal(test.want[index].Position, edge.Position)
+		}
+	}
+}
+
+func TestEntityRelations_ReplaceVersion(t *testing.T) {
+	assert := testutils.NewAssert(t)
+
+	relations := EntityRelations{
+		"sku": []RelationEdge{
+			{ID: 4, Position: 0, Metadata: map[string]interface{}{"quantity": 3}},
+			{ID: 5, Position: 1},
+		},
+	}
+
+	replaced, ok := relations.ReplaceVersion(4, 6)
+	assert.Equal(true, ok)
+	assert.Equal(int64(6), replaced["sku"][0].ID)
+	assert.Equal(3, replaced["sku"][0].Metadata["quantity"])
+	assert.Equal(int64(4), relations["sku"][0].ID)
+
+	_, ok = relations.ReplaceVersion(7, 8)
+	assert.Equal(false, ok)
+}
@@ -2,9 +2,20 @@ package models
 
 import (
 	"fmt"
+	"strings"
 	"time"
+
+	"github.com/jmataya/gizmo/common"
+	"github.com/jmataya/gizmo/dal"
+)
+
+const (
+	sqlInsertEntityRoot = "INSERT INTO entity_roots (kind) VALUES ($1) RETURNING id, kind, created_at, archived_at"
+	sqlSelectEntityRoot = "SELECT id, kind, created_at, archived_at FROM entity_roots WHERE id = $1"
 )
 
+// EntityRoot is the identity of an Entity across all of its versions and
+// Views. It records the kind of the Entity.
 type EntityRoot struct {
 	ID         int64
 	Kind       string
@@ -12,9 +23,43 @@ type EntityRoot struct {
 	ArchivedAt *time.Time
 }
 
+// Identifier returns the primary key of the EntityRoot.
+func (root EntityRoot) Identifier() int64 {
+	return root.ID
+}
+
 func (root EntityRoot) Validate() error {
 	if root.Kind == "" {
 		return fmt.Errorf(errFieldMustBeNonEmpty, "Kind")
 	}
 	return nil
 }
+
+// FindEntityRoot retrieves the EntityRoot with the specified ID.
+func FindEntityRoot(db common.DB, id int64) (EntityRoot, error) {
+	var root EntityRoot
+
+	if id == 0 {
+		return root, fmt.Errorf(errFieldMustBeGreaterThanZero, "id")
+	}
+
+	d := dal.NewDataAccessLayer(db)
+	d.Scan(d.QueryRow(sqlSelectEntityRoot, id), root.columns()...)
+	return root, d.Result()
+}
+
+// Insert adds the EntityRoot to the database and returns a copy of the
+// EntityRoot with the values that were inserted. Kinds are stored in lower
+// case.
+func (root EntityRoot) Insert(db common.DB) (EntityRoot, error) {
+	var newRoot EntityRoot
+
+	d := dal.NewDataAccessLayer(db)
+	d.ValidateInsert(root)
+	d.Scan(d.QueryRow(sqlInsertEntityRoot, strings.ToLower(root.Kind)), newRoot.columns()...)
+	return newRoot, d.Result()
+}
+
+func (root *EntityRoot) columns() []interface{} {
+	return []interface{}{&root.ID, &root.Kind, &root.CreatedAt, &root.ArchivedAt}
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jmataya/gizmo/common"
+	"github.com/jmataya/gizmo/dal"
+)
+
+const (
+	sqlInsertEntitySchema = `
+		INSERT INTO entity_schemas (kind, version, definition)
+		SELECT $1::text, COALESCE(MAX(version), 0) + 1, $2::jsonb
+		FROM entity_schemas
+		WHERE kind = $1::text
+		RETURNING id, kind, version, definition, created_at
+	`
+
+	sqlSelectLatestEntitySchema = `
+		SELECT id, kind, version, definition, created_at
+		FROM entity_schemas
+		WHERE kind = $1
+		ORDER BY version DESC
+		LIMIT 1
+	`
+)
+
+// EntitySchema is a version of the schema that Entities of a kind are
+// validated against. The definition is stored as JSON. Schemas are immutable:
+// changing the schema of a kind inserts a new version.
+type EntitySchema struct {
+	ID         int64
+	Kind       string
+	Version    int
+	Definition json.RawMessage
+	CreatedAt  time.Time
+}
+
+// Identifier returns the primary key of the EntitySchema.
+func (schema EntitySchema) Identifier() int64 {
+	return schema.ID
+}
+
+// FindLatestEntitySchema retrieves the most recent version of the schema of
+// a kind.
+func FindLatestEntitySchema(db common.DB, kind string) (EntitySchema, error) {
+	var schema EntitySchema
+
+	if kind == "" {
+		return schema, fmt.Errorf(errFieldMustBeNonEmpty, "kind")
+	}
+
+	d := dal.NewDataAccessLayer(db)
+	d.Scan(d.QueryRow(sqlSelectLatestEntitySchema, kind), schema.columns()...)
+	return schema, d.Result()
+}
+
+// Validate checks all the properties on the EntitySchema and determines if
+// they are all in a valid state.
+func (schema EntitySchema) Validate() error {
+	if schema.Kind == "" {
+		return fmt.Errorf(errFieldMustBeNonEmpty, "Kind")
+	} else if len(schema.Definition) == 0 {
+		return fmt.Errorf(errFieldMustBeNonEmpty, "Definition")
+	}
+
+	return nil
+}
+
+// Insert adds the EntitySchema to the database as the next version of the
+// schema of its kind, and returns a copy of the EntitySchema with the values
+// that were inserted.
+func (schema EntitySchema) Insert(db common.DB) (EntitySchema, error) {
+	var newSchema EntitySchema
+
+	d := dal.NewDataAccessLayer(db)
+	d.ValidateInsert(schema)
+	d.Scan(d.QueryRow(sqlInsertEntitySchema, schema.Kind, []byte(schema.Definition)), newSchema.columns()...)
+	return newSchema, d.Result()
+}
+
+// columns scans the definition as bytes, since json.RawMessage doesn't
+// implement sql.Scanner.
+func (schema *EntitySchema) columns() []interface{} {
+	return []interface{}{
+		&schema.ID,
+		&schema.Kind,
+		&schema.Version,
+		(*[]byte)(&schema.Definition),
+		&schema.CreatedAt,
+	}
+}
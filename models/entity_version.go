@@ -7,10 +7,21 @@ import (
 	"time"
 
 	"github.com/jmataya/gizmo/common"
+	"github.com/jmataya/gizmo/dal"
 )
 
 const (
-	sqlInsertEntityVersion = "INSERT INTO entity_versions (content_commit_id, kind, relations) VALUES ($1, $2, $3) RETURNING *"
+	sqlInsertEntityVersion = `
+		INSERT INTO entity_versions (parent_id, root_id, kind, content_commit_id, relations)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, parent_id, COALESCE(root_id, 0), kind, content_commit_id, relations, created_at
+	`
+
+	sqlSelectEntityVersion = `
+		SELECT id, parent_id, COALESCE(root_id, 0), kind, content_commit_id, relations, created_at
+		FROM entity_versions
+		WHERE id = $1
+	`
 )
 
 // EntityVersion is a snapshot in time of the full structure of an Entity. It
@@ -19,12 +30,31 @@ const (
 type EntityVersion struct {
 	ID              int64
 	ParentID        sql.NullInt64
+	RootID          int64
 	Kind            string
 	ContentCommitID int64
 	Relations       EntityRelations
 	CreatedAt       time.Time
 }
 
+// Identifier returns the primary key of the EntityVersion.
+func (version EntityVersion) Identifier() int64 {
+	return version.ID
+}
+
+// FindEntityVersion retrieves the EntityVersion with the specified ID.
+func FindEntityVersion(db common.DB, id int64) (EntityVersion, error) {
+	var version EntityVersion
+
+	if id == 0 {
+		return version, fmt.Errorf(errFieldMustBeGreaterThanZero, "id")
+	}
+
+	d := dal.NewDataAccessLayer(db)
+	d.Scan(d.QueryRow(sqlSelectEntityVersion, id), version.columns()...)
+	return version, d.Result()
+}
+
 // Validate checks all the properties on the EntityVersion and determines if
 // they are all in a valid state.
 func (version EntityVersion) Validate() error {
@@ -42,36 +72,33 @@ func (version EntityVersion) Validate() error {
 func (version EntityVersion) Insert(db common.DB) (EntityVersion, error) {
 	var newVersion EntityVersion
 
-	if err := version.Validate(); err != nil {
-		return newVersion, err
-	}
-
-	if version.ID != 0 {
-		return newVersion, fmt.Errorf(errNoInsertHasPrimaryKey, "EntityVersion")
+	var rootID sql.NullInt64
+	if version.RootID != 0 {
+		rootID = sql.NullInt64{Int64: version.RootID, Valid: true}
 	}
 
-	stmt, err := db.Prepare(sqlInsertEntityVersion)
-	if err != nil {
-		return newVersion, err
-	}
+	d := dal.NewDataAccessLayer(db)
+	d.ValidateInsert(version)
+	row := d.QueryRow(
+		sqlInsertEntityVersion,
+		version.ParentID,
+		rootID,
+		strings.ToLower(version.Kind),
+		version.ContentCommitID,
+		&version.Relations)
 
-	var id int64
-	var parentID sql.NullInt64
-	var kind string
-	var contentCommitID int64
-	var entityRelations EntityRelations
-	var createdAt time.Time
+	d.Scan(row, newVersion.columns()...)
+	return newVersion, d.Result()
+}
 
-	row := stmt.QueryRow(version.ContentCommitID, strings.ToLower(version.Kind), &version.Relations)
-	if err := row.Scan(&id, &parentID, &kind, &contentCommitID, &entityRelations, &createdAt); err != nil {
-		return newVersion, err
+func (version *EntityVersion) columns() []interface{} {
+	return []interface{}{
+		&version.ID,
+		&version.ParentID,
+		&version.RootID,
+		&version.Kind,
+		&version.ContentCommitID,
+		&version.Relations,
+		&version.CreatedAt,
 	}
-
-	newVersion.ID = id
-	newVersion.ParentID = parentID
-	newVersion.Kind = kind
-	newVersion.ContentCommitID = contentCommitID
-	newVersion.CreatedAt = createdAt
-
-	return newVersion, nil
 }
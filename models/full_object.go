@@ -1,17 +1,19 @@
 package models
 
 import (
-	"database/sql"
 	"fmt"
-	"time"
 
 	"github.com/jmataya/gizmo/common"
+	"github.com/jmataya/gizmo/dal"
 	log "github.com/sirupsen/logrus"
 )
 
 const (
 	sqlSelectFullObjectByCommit = `
-		SELECT f.*, s.*, c.* FROM object_commits AS c
+		SELECT f.id, f.kind, ` + sqlObjectFormAttributes + `, f.created_at, f.updated_at,
+			s.id, s.form_id, s.attributes, s.revision, s.created_at,
+			c.id, c.form_id, c.shadow_id, c.previous_id, c.created_at
+		FROM object_commits AS c
 		INNER JOIN object_forms AS f ON c.form_id = f.id
 		INNER JOIN object_shadows AS s ON c.shadow_id = s.id
 		WHERE c.id = $1
@@ -27,13 +29,22 @@ type FullObject struct {
 }
 
 // Find retrieves a FullObject at a specific commit.
-func (f FullObject) Find(db *sql.DB, commitID int64) (FullObject, error) {
+func (f FullObject) Find(db common.DB, commitID int64) (FullObject, error) {
 	if commitID == 0 {
 		return f, fmt.Errorf(errFieldMustBeGreaterThanZero, "commitID")
 	}
 
-	row := db.QueryRow(sqlSelectFullObjectByCommit, commitID)
-	return f.findRow(row)
+	var found FullObject
+	columns := append(found.Form.columns(), found.Shadow.columns()...)
+	columns = append(columns, found.Commit.columns()...)
+
+	d := dal.NewDataAccessLayer(db)
+	d.Scan(d.QueryRow(sqlSelectFullObjectByCommit, commitID), columns...)
+	if err := d.Result(); err != nil {
+		return f, err
+	}
+
+	return found, nil
 }
 
 // Insert adds the FullObject to the database.
@@ -76,47 +87,3 @@ func (f FullObject) Insert(db common.DB) (FullObject, error) {
 		Commit: newCommit,
 	}, nil
 }
-
-func (f FullObject) findRow(row *sql.Row) (FullObject, error) {
-	var found FullObject
-
-	var formID int64
-	var formKind string
-	var formAttributes ObjectFormAttributes
-	var formCreatedAt time.Time
-	var formUpdatedAt time.Time
-	var shadowID int64
-	var shadowFormID int64
-	var shadowAttributes ObjectShadowAttributes
-	var shadowCreatedAt time.Time
-	var commitID int64
-	var commitFormID int64
-	var commitShadowID int64
-	var commitPreviousID sql.NullInt64
-	var commitCreatedAt time.Time
-
-	err := row.Scan(&formID, &formKind, &formAttributes, &formCreatedAt, &formUpdatedAt,
-		&shadowID, &shadowFormID, &shadowAttributes, &shadowCreatedAt,
-		&commitID, &commitFormID, &commitShadowID, &commitPreviousID, &commitCreatedAt)
-
-	if err != nil {
-		return found, err
-	}
-
-	found.Form.ID = formID
-	found.Form.Kind = formKind
-	found.Form.Attributes = formAttributes
-	found.Form.CreatedAt = formCreatedAt
-	found.Form.UpdatedAt = formUpdatedAt
-	found.Shadow.ID = shadowID
-	found.Shadow.FormID = shadowFormID
-	found.Shadow.Attributes = shadowAttributes
-	found.Shadow.CreatedAt = shadowCreatedAt
-	found.Commit.ID = commitID
-	found.Commit.FormID = commitFormID
-	found.Commit.ShadowID = commitShadowID
-	found.Commit.PreviousID = commitPreviousID
-	found.Commit.CreatedAt = commitCreatedAt
-
-	return found, nil
-}
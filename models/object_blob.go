@@ -0,0 +1,94 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jmataya/gizmo/common"
+	"github.com/jmataya/gizmo/dal"
+)
+
+const (
+	sqlInsertObjectBlob = `
+		INSERT INTO object_blobs (digest, size) VALUES ($1, $2)
+		ON CONFLICT (digest) DO NOTHING
+		RETURNING digest, size, created_at
+	`
+
+	sqlSelectObjectBlob = "SELECT digest, size, created_at FROM object_blobs WHERE digest = $1"
+
+	sqlInsertObjectBlobChunk = "INSERT INTO object_blob_chunks (digest, position, content) VALUES ($1, $2, $3)"
+
+	sqlSelectObjectBlobChunk = "SELECT content FROM object_blob_chunks WHERE digest = $1 AND position = $2"
+)
+
+// ObjectBlob is binary content that is too large to be stored in an
+// ObjectForm. It is identified by the digest of its content, and the content
+// itself is stored in ObjectBlobChunks. ObjectBlobs are immutable.
+type ObjectBlob struct {
+	Digest    string
+	Size      int64
+	CreatedAt time.Time
+}
+
+// ObjectBlobChunk is a part of the content of an ObjectBlob. The chunks of an
+// ObjectBlob are numbered from zero by their position in the content.
+type ObjectBlobChunk struct {
+	Digest   string
+	Position int
+	Content  []byte
+}
+
+// FindObjectBlob retrieves the ObjectBlob with a digest.
+func FindObjectBlob(db common.DB, digest string) (ObjectBlob, error) {
+	var blob ObjectBlob
+
+	if digest == "" {
+		return blob, fmt.Errorf(errFieldMustBeNonEmpty, "digest")
+	}
+
+	d := dal.NewDataAccessLayer(db)
+	d.Scan(d.QueryRow(sqlSelectObjectBlob, digest), &blob.Digest, &blob.Size, &blob.CreatedAt)
+	return blob, d.Result()
+}
+
+// Insert adds the ObjectBlob to the database and returns a copy of the
+// ObjectBlob with the values that were inserted. If an ObjectBlob with the
+// same digest already exists, nothing is inserted and sql.ErrNoRows is
+// returned.
+func (blob ObjectBlob) Insert(db common.DB) (ObjectBlob, error) {
+	var newBlob ObjectBlob
+
+	if blob.Digest == "" {
+		return newBlob, fmt.Errorf(errFieldMustBeNonEmpty, "Digest")
+	}
+
+	d := dal.NewDataAccessLayer(db)
+	d.Scan(d.QueryRow(sqlInsertObjectBlob, blob.Digest, blob.Size), &newBlob.Digest, &newBlob.Size, &newBlob.CreatedAt)
+	return newBlob, d.Result()
+}
+
+// FindObjectBlobChunk retrieves the content of the chunk of an ObjectBlob at
+// a position.
+func FindObjectBlobChunk(db common.DB, digest string, position int) (ObjectBlobChunk, error) {
+	chunk := ObjectBlobChunk{Digest: digest, Position: position}
+
+	if digest == "" {
+		return chunk, fmt.Errorf(errFieldMustBeNonEmpty, "digest")
+	}
+
+	d := dal.NewDataAccessLayer(db)
+	d.Scan(d.QueryRow(sqlSelectObjectBlobChunk, digest, position), &chunk.Content)
+	return chunk, d.Result()
+}
+
+// Insert adds the ObjectBlobChunk to the database.
+func (chunk ObjectBlobChunk) Insert(db common.DB) error {
+	if chunk.Digest == "" {
+		return fmt.Errorf(errFieldMustBeNonEmpty, "Digest")
+	}
+
+	d := dal.NewDataAccessLayer(db)
+	d.Exec(sqlInsertObjectBlobChunk, chunk.Digest, chunk.Position, chunk.Content)
+	return d.Result()
+}
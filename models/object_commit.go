@@ -6,10 +6,11 @@ import (
 	"time"
 
 	"github.com/jmataya/gizmo/common"
+	"github.com/jmataya/gizmo/dal"
 )
 
 const (
-	sqlInsertObjectCommit = "INSERT INTO object_commits (form_id, shadow_id) VALUES ($1, $2) RETURNING id, form_id, shadow_id, created_at"
+	sqlInsertObjectCommit = "INSERT INTO object_commits (form_id, shadow_id, previous_id) VALUES ($1, $2, $3) RETURNING id, form_id, shadow_id, previous_id, created_at"
 )
 
 // ObjectCommit represents an update to an object. It is an immutable object in
@@ -22,6 +23,11 @@ type ObjectCommit struct {
 	CreatedAt  time.Time
 }
 
+// Identifier returns the primary key of the ObjectCommit.
+func (commit ObjectCommit) Identifier() int64 {
+	return commit.ID
+}
+
 // Validate checks the properties on the ObjectCommit and determines if they
 // are all in a valid state.
 func (commit ObjectCommit) Validate() error {
@@ -39,33 +45,12 @@ func (commit ObjectCommit) Validate() error {
 func (commit ObjectCommit) Insert(db common.DB) (ObjectCommit, error) {
 	var newCommit ObjectCommit
 
-	if err := commit.Validate(); err != nil {
-		return newCommit, err
-	}
-
-	if commit.ID != 0 {
-		return newCommit, fmt.Errorf(errNoInsertHasPrimaryKey, "ObjectCommit")
-	}
-
-	stmt, err := db.Prepare(sqlInsertObjectCommit)
-	if err != nil {
-		return newCommit, err
-	}
-
-	var id int64
-	var formID int64
-	var shadowID int64
-	var createdAt time.Time
-
-	row := stmt.QueryRow(commit.FormID, commit.ShadowID)
-	if err := row.Scan(&id, &formID, &shadowID, &createdAt); err != nil {
-		return newCommit, err
-	}
+	d := dal.NewDataAccessLayer(db)
+	d.ValidateInsert(commit)
+	d.Scan(d.QueryRow(sqlInsertObjectCommit, commit.FormID, commit.ShadowID, commit.PreviousID), newCommit.columns()...)
+	return newCommit, d.Result()
+}
 
-	return ObjectCommit{
-		ID:        id,
-		FormID:    formID,
-		ShadowID:  shadowID,
-		CreatedAt: createdAt,
-	}, nil
+func (commit *ObjectCommit) columns() []interface{} {
+	return []interface{}{&commit.ID, &commit.FormID, &commit.ShadowID, &commit.PreviousID, &commit.CreatedAt}
 }
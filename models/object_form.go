@@ -1,22 +1,56 @@
 package models
 
 import (
-	"bytes"
-	"crypto/sha1"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/jmataya/gizmo/common"
+	"github.com/jmataya/gizmo/dal"
 )
 
 const (
-	sqlInsertObjectForm = "INSERT INTO object_forms (kind, attributes) VALUES ($1, $2) RETURNING *"
+	// sqlObjectFormAttributes reassembles the attributes of the form f from
+	// the shared values that it refers to and any values that are still
+	// stored inline.
+	sqlObjectFormAttributes = `
+		COALESCE(f.attributes, '{}'::jsonb) || COALESCE((
+			SELECT jsonb_object_agg(v.ref, v.value)
+			FROM object_values AS v
+			WHERE v.ref IN (SELECT jsonb_array_elements_text(f.refs))
+		), '{}'::jsonb)
+	`
+
+	sqlInsertObjectValue = "INSERT INTO object_values (ref, value) VALUES ($1, $2) ON CONFLICT (ref) DO NOTHING"
+
+	sqlInsertObjectForm = `
+		INSERT INTO object_forms AS f (kind, refs) VALUES ($1, $2)
+		RETURNING f.id, f.kind, ` + sqlObjectFormAttributes + `, f.created_at, f.updated_at
+	`
+
+	sqlSelectObjectFormsAfter = `
+		SELECT f.id, f.kind, ` + sqlObjectFormAttributes + `, f.created_at, f.updated_at
+		FROM object_forms AS f
+		WHERE f.id > $1
+		ORDER BY f.id
+		LIMIT $2
+	`
+
+	sqlUpdateObjectFormRefs = `
+		UPDATE object_forms
+		SET attributes = NULL, refs = $2, updated_at = (now() at time zone 'utc')
+		WHERE id = $1
+	`
 )
 
 // ObjectForm is the central component in the object model. It is a flat
-// collection of attributes. The key of each attribute is a hash of the
-// attribute's value.
+// collection of attributes. The key of each attribute is its ref, a content
+// address computed from the attribute's value by AttributeRef.
+//
+// Values are stored once in the object_values table, which is shared by every
+// form, and each form only stores the refs of its values. Its attributes are
+// reassembled from the shared values when it is read.
 type ObjectForm struct {
 	ID         int64
 	Kind       string
@@ -33,21 +67,21 @@ func NewObjectForm(kind string) *ObjectForm {
 	}
 }
 
-// AddAttribute computes a SHA for the value and adds it to the ObjectForm.
-// The SHA is returned as a result.
+// AddAttribute adds a value to the ObjectForm and returns its ref, which is
+// computed by AttributeRef.
 func (form *ObjectForm) AddAttribute(value interface{}) (string, error) {
-	hasher := sha1.New()
-	valBytes := new(bytes.Buffer)
-
-	if err := json.NewEncoder(valBytes).Encode(value); err != nil {
+	ref, err := AttributeRef(value)
+	if err != nil {
 		return "", err
 	}
 
-	checksum := hasher.Sum(valBytes.Bytes())
-	hash := fmt.Sprintf("%x", checksum)
+	form.Attributes[ref] = value
+	return ref, nil
+}
 
-	form.Attributes[hash] = value
-	return hash, nil
+// Identifier returns the primary key of the ObjectForm.
+func (form ObjectForm) Identifier() int64 {
+	return form.ID
 }
 
 // Validate checks the properties on the ObjectForm and determines if they are
@@ -65,35 +99,91 @@ func (form ObjectForm) Validate() error {
 func (form ObjectForm) Insert(db common.DB) (ObjectForm, error) {
 	var newForm ObjectForm
 
-	if err := form.Validate(); err != nil {
-		return newForm, err
-	}
+	d := dal.NewDataAccessLayer(db)
+	d.ValidateInsert(form)
+	refs := form.insertValues(d)
+	d.Scan(d.QueryRow(sqlInsertObjectForm, form.Kind, refs), newForm.columns()...)
+	return newForm, d.Result()
+}
 
-	if form.ID != 0 {
-		return newForm, fmt.Errorf(errNoInsertHasPrimaryKey, "ObjectForm")
+// FindObjectForms retrieves up to limit ObjectForms whose IDs are greater than
+// afterID, ordered by ID, so that every form can be visited in batches.
+func FindObjectForms(db common.DB, afterID int64, limit int) ([]ObjectForm, error) {
+	if limit < 1 {
+		return nil, fmt.Errorf(errFieldMustBeGreaterThanZero, "limit")
 	}
 
-	stmt, err := db.Prepare(sqlInsertObjectForm)
-	if err != nil {
-		return newForm, err
+	forms := []ObjectForm{}
+
+	d := dal.NewDataAccessLayer(db)
+	d.ScanRows(d.Query(sqlSelectObjectFormsAfter, afterID, limit), func(row dal.Scanner) error {
+		var form ObjectForm
+		if err := row.Scan(form.columns()...); err != nil {
+			return err
+		}
+
+		forms = append(forms, form)
+		return nil
+	})
+
+	if err := d.Result(); err != nil {
+		return nil, err
 	}
 
-	var id int64
-	var kind string
-	var attributes ObjectFormAttributes
-	var createdAt time.Time
-	var updatedAt time.Time
+	return forms, nil
+}
 
-	row := stmt.QueryRow(form.Kind, form.Attributes)
-	if err := row.Scan(&id, &kind, &attributes, &createdAt, &updatedAt); err != nil {
-		return newForm, err
+// UpdateAttributes overwrites the attributes of a saved ObjectForm. Forms are
+// otherwise never modified, so this is only meant for migrations that change
+// how attributes are stored.
+func (form ObjectForm) UpdateAttributes(db common.DB) error {
+	d := dal.NewDataAccessLayer(db)
+	d.ValidateIdentifier(form)
+	refs := form.insertValues(d)
+	d.Exec(sqlUpdateObjectFormRefs, form.ID, refs)
+	return d.Result()
+}
+
+// insertValues adds every value of the ObjectForm that isn't stored yet to
+// the shared values, and returns the JSON encoded list of the form's refs.
+// Values must be stored under the ref that AttributeRef computes for them,
+// since they are shared with every form that has the same value.
+func (form ObjectForm) insertValues(d *dal.DataAccessLayer) []byte {
+	refs := make([]string, 0, len(form.Attributes))
+	for ref := range form.Attributes {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+
+	for _, ref := range refs {
+		value := form.Attributes[ref]
+
+		expected, err := AttributeRef(value)
+		if err != nil {
+			d.Fail(err)
+			return nil
+		} else if expected != ref {
+			d.Fail(fmt.Errorf("Value with ref %s must be stored under ref %s", ref, expected))
+			return nil
+		}
+
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			d.Fail(err)
+			return nil
+		}
+
+		d.Exec(sqlInsertObjectValue, ref, encoded)
 	}
 
-	return ObjectForm{
-		ID:         id,
-		Kind:       kind,
-		Attributes: attributes,
-		CreatedAt:  createdAt,
-		UpdatedAt:  updatedAt,
-	}, nil
+	encoded, err := json.Marshal(refs)
+	if err != nil {
+		d.Fail(err)
+	}
+
+	return encoded
+}
+
+func (form *ObjectForm) columns() []interface{} {
+	return []interface{}{&form.ID, &form.Kind, &form.Attributes, &form.CreatedAt, &form.UpdatedAt}
 }
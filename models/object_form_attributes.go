@@ -1,6 +1,7 @@
 package models
 
 import (
+	"bytes"
 	"database/sql/driver"
 	"encoding/json"
 	"errors"
@@ -18,7 +19,11 @@ func (ofa *ObjectFormAttributes) Scan(src interface{}) error {
 		return errors.New("type assertion .([]byte) failed")
 	}
 
-	return json.Unmarshal(source, ofa)
+	// Numbers are kept as json.Number so that they can be converted to the
+	// type of the attribute without losing precision.
+	decoder := json.NewDecoder(bytes.NewReader(source))
+	decoder.UseNumber()
+	return decoder.Decode(ofa)
 }
 
 // Value converts the struct to a byte array of JSON.
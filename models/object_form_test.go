@@ -0,0 +1,67 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jmataya/gizmo/testutils"
+)
+
+func TestInsert_SharesValues(t *testing.T) {
+	assert := testutils.NewAssert(t)
+	db := testutils.InitDB(t)
+	defer db.Close()
+
+	description := strings.Repeat("A very long description. ", 800)
+
+	var refs []string
+	var forms []ObjectForm
+	for _, title := range []string{"Fox Socks", "Fox Socks 2.0"} {
+		form := NewObjectForm("product")
+		if _, err := form.AddAttribute(title); err != nil {
+			t.Fatal(err)
+		}
+
+		ref, err := form.AddAttribute(description)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		inserted, err := form.Insert(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		refs = append(refs, ref)
+		forms = append(forms, inserted)
+	}
+
+	assert.Equal(refs[0], refs[1])
+	assert.Equal(2, len(forms[1].Attributes))
+	assert.Equal(description, forms[1].Attributes[refs[1]])
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM object_values WHERE ref = $1", refs[0]).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(1, count)
+
+	found, err := FindObjectForms(db, forms[0].ID-1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(description, found[0].Attributes[refs[0]])
+}
+
+func TestInsert_RejectsMismatchedRefs(t *testing.T) {
+	db := testutils.InitDB(t)
+	defer db.Close()
+
+	form := NewObjectForm("product")
+	form.Attributes["abcdef"] = "a product"
+
+	_, err := form.Insert(db)
+	if err == nil || !strings.HasPrefix(err.Error(), "Value with ref abcdef must be stored under ref sha256:") {
+		t.Errorf("Insert() = %v, want a mismatched ref error", err)
+	}
+}
@@ -5,19 +5,38 @@ import (
 	"time"
 
 	"github.com/jmataya/gizmo/common"
+	"github.com/jmataya/gizmo/dal"
 )
 
 const (
-	sqlInsertObjectShadow = "INSERT INTO object_shadows (form_id, attributes) VALUES ($1, $2) RETURNING *"
+	sqlInsertObjectShadow = `
+		INSERT INTO object_shadows (form_id, attributes, revision)
+		VALUES ($1, $2, $3)
+		RETURNING id, form_id, attributes, revision, created_at
+	`
+
+	sqlSelectObjectShadowsByForm = `
+		SELECT id, form_id, attributes, revision, created_at
+		FROM object_shadows
+		WHERE form_id = $1
+		ORDER BY id
+	`
+
+	sqlUpdateObjectShadowAttributes = "UPDATE object_shadows SET attributes = $2 WHERE id = $1"
 )
 
 // ObjectShadow is a view of data on a form. It is an immutable record in the
 // database that defines which attributes should be visible on the illuminated
 // object.
+//
+// Revision is the revision of the form's kind that the attributes were
+// written in, so that shadows of older revisions can be upgraded as they are
+// read.
 type ObjectShadow struct {
 	ID         int64
 	FormID     int64
 	Attributes ObjectShadowAttributes
+	Revision   int
 	CreatedAt  time.Time
 }
 
@@ -43,6 +62,11 @@ func (shadow *ObjectShadow) AddAttribute(attrName, attrType, attrRef string) err
 	return nil
 }
 
+// Identifier returns the primary key of the ObjectShadow.
+func (shadow ObjectShadow) Identifier() int64 {
+	return shadow.ID
+}
+
 // Validate checks the properties on the ObjectShadow and determines if they
 // are all in a valid state.
 func (shadow ObjectShadow) Validate() error {
@@ -58,33 +82,49 @@ func (shadow ObjectShadow) Validate() error {
 func (shadow ObjectShadow) Insert(db common.DB) (ObjectShadow, error) {
 	var newShadow ObjectShadow
 
-	if err := shadow.Validate(); err != nil {
-		return newShadow, err
-	}
+	d := dal.NewDataAccessLayer(db)
+	d.ValidateInsert(shadow)
+	d.Scan(d.QueryRow(sqlInsertObjectShadow, shadow.FormID, shadow.Attributes, shadow.Revision), newShadow.columns()...)
+	return newShadow, d.Result()
+}
 
-	if shadow.ID != 0 {
-		return newShadow, fmt.Errorf(errNoInsertHasPrimaryKey, "ObjectShadow")
+// FindObjectShadowsByForm retrieves every ObjectShadow of an ObjectForm,
+// ordered by ID.
+func FindObjectShadowsByForm(db common.DB, formID int64) ([]ObjectShadow, error) {
+	if formID == 0 {
+		return nil, fmt.Errorf(errFieldMustBeGreaterThanZero, "formID")
 	}
 
-	stmt, err := db.Prepare(sqlInsertObjectShadow)
-	if err != nil {
-		return newShadow, err
-	}
+	shadows := []ObjectShadow{}
 
-	var id int64
-	var formID int64
-	var attributes ObjectShadowAttributes
-	var createdAt time.Time
+	d := dal.NewDataAccessLayer(db)
+	d.ScanRows(d.Query(sqlSelectObjectShadowsByForm, formID), func(row dal.Scanner) error {
+		var shadow ObjectShadow
+		if err := row.Scan(shadow.columns()...); err != nil {
+			return err
+		}
 
-	row := stmt.QueryRow(shadow.FormID, shadow.Attributes)
-	if err := row.Scan(&id, &formID, &attributes, &createdAt); err != nil {
-		return newShadow, err
+		shadows = append(shadows, shadow)
+		return nil
+	})
+
+	if err := d.Result(); err != nil {
+		return nil, err
 	}
 
-	return ObjectShadow{
-		ID:         id,
-		FormID:     formID,
-		Attributes: attributes,
-		CreatedAt:  createdAt,
-	}, nil
+	return shadows, nil
+}
+
+// UpdateAttributes overwrites the attributes of a saved ObjectShadow. Shadows
+// are otherwise immutable, so this is only meant for migrations that change
+// how attributes are stored.
+func (shadow ObjectShadow) UpdateAttributes(db common.DB) error {
+	d := dal.NewDataAccessLayer(db)
+	d.ValidateIdentifier(shadow)
+	d.Exec(sqlUpdateObjectShadowAttributes, shadow.ID, shadow.Attributes)
+	return d.Result()
+}
+
+func (shadow *ObjectShadow) columns() []interface{} {
+	return []interface{}{&shadow.ID, &shadow.FormID, &shadow.Attributes, &shadow.Revision, &shadow.CreatedAt}
 }
@@ -0,0 +1,122 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jmataya/gizmo/common"
+	"github.com/jmataya/gizmo/dal"
+)
+
+const (
+	sqlSelectKinds = "SELECT DISTINCT kind FROM object_forms ORDER BY kind"
+
+	sqlCountCommitsByKind = `
+		SELECT COUNT(*)
+		FROM object_commits AS c
+		INNER JOIN object_forms AS f ON c.form_id = f.id
+		WHERE f.kind = $1
+	`
+
+	sqlSelectShadowAttributeStats = `
+		SELECT
+			a.key,
+			COALESCE(a.value->>'type', ''),
+			COUNT(*),
+			MIN(c.id),
+			MAX(c.id),
+			MIN(c.created_at),
+			MAX(c.created_at)
+		FROM object_commits AS c
+		INNER JOIN object_forms AS f ON c.form_id = f.id
+		INNER JOIN object_shadows AS s ON c.shadow_id = s.id
+		CROSS JOIN LATERAL jsonb_each(COALESCE(s.attributes, '{}'::jsonb)) AS a
+		WHERE f.kind = $1
+		GROUP BY a.key, a.value->>'type'
+		ORDER BY a.key, MIN(c.id)
+	`
+)
+
+// ShadowAttributeStat summarizes the commits of a kind in which an attribute
+// was stored with a specific type.
+type ShadowAttributeStat struct {
+	Name          string
+	Type          string
+	Commits       int64
+	FirstCommitID int64
+	LastCommitID  int64
+	FirstSeenAt   time.Time
+	LastSeenAt    time.Time
+}
+
+// FindKinds retrieves every kind that has content.
+func FindKinds(db common.DB) ([]string, error) {
+	kinds := []string{}
+
+	d := dal.NewDataAccessLayer(db)
+	d.ScanRows(d.Query(sqlSelectKinds), func(row dal.Scanner) error {
+		var kind string
+		if err := row.Scan(&kind); err != nil {
+			return err
+		}
+
+		kinds = append(kinds, kind)
+		return nil
+	})
+
+	if err := d.Result(); err != nil {
+		return nil, err
+	}
+
+	return kinds, nil
+}
+
+// CountCommitsByKind counts the content commits of a kind.
+func CountCommitsByKind(db common.DB, kind string) (int64, error) {
+	if kind == "" {
+		return 0, fmt.Errorf(errFieldMustBeNonEmpty, "kind")
+	}
+
+	var count int64
+
+	d := dal.NewDataAccessLayer(db)
+	d.Scan(d.QueryRow(sqlCountCommitsByKind, kind), &count)
+	return count, d.Result()
+}
+
+// FindShadowAttributeStats retrieves a ShadowAttributeStat for every
+// combination of attribute name and type in the shadows of a kind, ordered by
+// name and then by first commit.
+func FindShadowAttributeStats(db common.DB, kind string) ([]ShadowAttributeStat, error) {
+	if kind == "" {
+		return nil, fmt.Errorf(errFieldMustBeNonEmpty, "kind")
+	}
+
+	stats := []ShadowAttributeStat{}
+
+	d := dal.NewDataAccessLayer(db)
+	d.ScanRows(d.Query(sqlSelectShadowAttributeStats, kind), func(row dal.Scanner) error {
+		var stat ShadowAttributeStat
+		err := row.Scan(
+			&stat.Name,
+			&stat.Type,
+			&stat.Commits,
+			&stat.FirstCommitID,
+			&stat.LastCommitID,
+			&stat.FirstSeenAt,
+			&stat.LastSeenAt)
+
+		if err != nil {
+			return err
+		}
+
+		stats = append(stats, stat)
+		return nil
+	})
+
+	if err := d.Result(); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
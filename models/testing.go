@@ -6,11 +6,9 @@ import (
 )
 
 func createObjectForm(t *testing.T, db *sql.DB) ObjectForm {
-	form := ObjectForm{
-		Kind: "product",
-		Attributes: map[string]interface{}{
-			"abcdef": "a product",
-		},
+	form := NewObjectForm("product")
+	if _, err := form.AddAttribute("a product"); err != nil {
+		t.Error(err)
 	}
 
 	inserted, err := form.Insert(db)
@@ -60,7 +58,7 @@ func createObjectCommit(t *testing.T, db *sql.DB, form ObjectForm, shadow Object
 	return inserted
 }
 
-func CreateView(t *testing.T, db *sql.DB) View {
+func CreateView(t testing.TB, db *sql.DB) View {
 	view := View{Name: "Default"}
 
 	inserted, err := view.Insert(db)
@@ -1,13 +1,16 @@
 package models
 
 import (
-	"database/sql"
 	"fmt"
 	"time"
+
+	"github.com/jmataya/gizmo/common"
+	"github.com/jmataya/gizmo/dal"
 )
 
 const (
-	sqlInsertView = "INSERT INTO views (name, attributes) VALUES ($1, $2) RETURNING *"
+	sqlInsertView = "INSERT INTO views (name, attributes) VALUES ($1, $2) RETURNING id, name, attributes, created_at, updated_at"
+	sqlSelectView = "SELECT id, name, attributes, created_at, updated_at FROM views WHERE id = $1"
 )
 
 // View is an object that is used to define the different ways that an Entity,
@@ -20,6 +23,24 @@ type View struct {
 	UpdatedAt  time.Time
 }
 
+// Identifier returns the primary key of the View.
+func (view View) Identifier() int64 {
+	return view.ID
+}
+
+// FindView retrieves the View with the specified ID.
+func FindView(db common.DB, id int64) (View, error) {
+	var view View
+
+	if id == 0 {
+		return view, fmt.Errorf(errFieldMustBeGreaterThanZero, "id")
+	}
+
+	d := dal.NewDataAccessLayer(db)
+	d.Scan(d.QueryRow(sqlSelectView, id), view.columns()...)
+	return view, d.Result()
+}
+
 // Validate checks the properties on the View and determines if they
 // are in a valid state.
 func (view View) Validate() error {
@@ -32,36 +53,15 @@ func (view View) Validate() error {
 
 // Insert adds the View to the database and returns a copy of the
 // View with values that were inserted.
-func (view View) Insert(db *sql.DB) (View, error) {
-	if err := view.Validate(); err != nil {
-		return view, err
-	}
-
-	if view.ID != 0 {
-		return view, fmt.Errorf(errNoInsertHasPrimaryKey, "View")
-	}
-
-	stmt, err := db.Prepare(sqlInsertView)
-	if err != nil {
-		return view, err
-	}
-
-	var id int64
-	var name string
-	var attributes ViewAttributes
-	var createdAt time.Time
-	var updatedAt time.Time
+func (view View) Insert(db common.DB) (View, error) {
+	var newView View
 
-	row := stmt.QueryRow(view.Name, view.Attributes)
-	if err := row.Scan(&id, &name, &attributes, &createdAt, &updatedAt); err != nil {
-		return view, err
-	}
+	d := dal.NewDataAccessLayer(db)
+	d.ValidateInsert(view)
+	d.Scan(d.QueryRow(sqlInsertView, view.Name, view.Attributes), newView.columns()...)
+	return newView, d.Result()
+}
 
-	return View{
-		ID:         id,
-		Name:       name,
-		Attributes: attributes,
-		CreatedAt:  createdAt,
-		UpdatedAt:  updatedAt,
-	}, nil
+func (view *View) columns() []interface{} {
+	return []interface{}{&view.ID, &view.Name, &view.Attributes, &view.CreatedAt, &view.UpdatedAt}
 }
@@ -0,0 +1,421 @@
+package gizmo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	patchAdd     = "add"
+	patchRemove  = "remove"
+	patchReplace = "replace"
+	patchMove    = "move"
+	patchCopy    = "copy"
+	patchTest    = "test"
+)
+
+// PatchError is returned when a patch is malformed or can't be applied to the
+// current version of an Entity.
+type PatchError struct {
+	Message string
+}
+
+func (e *PatchError) Error() string {
+	return fmt.Sprintf("Unable to apply patch: %s", e.Message)
+}
+
+func patchErrorf(format string, args ...interface{}) error {
+	return &PatchError{Message: fmt.Sprintf(format, args...)}
+}
+
+// patchOperation is a single operation of a JSON Patch document.
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// applyPatch applies a patch to a JSON document. A patch that is a JSON array
+// is a JSON Patch (RFC 6902), and a patch that is a JSON object is a JSON
+// Merge Patch (RFC 7386).
+func applyPatch(document []byte, patch []byte) ([]byte, error) {
+	target, err := decodeJSON(document)
+	if err != nil {
+		return nil, err
+	}
+
+	trimmed := bytes.TrimSpace(patch)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		var operations []patchOperation
+		if err := json.Unmarshal(trimmed, &operations); err != nil {
+			return nil, patchErrorf("invalid JSON Patch: %s", err.Error())
+		}
+
+		target, err = applyOperations(target, operations)
+		if err != nil {
+			return nil, err
+		}
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		mergeDocument, err := decodeJSON(trimmed)
+		if err != nil {
+			return nil, patchErrorf("invalid JSON Merge Patch: %s", err.Error())
+		}
+
+		target = mergePatch(target, mergeDocument)
+	default:
+		return nil, patchErrorf("patch must be a JSON object or array")
+	}
+
+	return json.Marshal(target)
+}
+
+// mergePatch applies a JSON Merge Patch to a decoded document. Objects are
+// merged recursively, null removes a member, and every other value replaces
+// the value in the document.
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+			continue
+		}
+
+		targetObject[name] = mergePatch(targetObject[name], value)
+	}
+
+	return targetObject
+}
+
+// applyOperations applies the operations of a JSON Patch to a decoded
+// document in order. If any operation fails, the whole patch fails.
+func applyOperations(target interface{}, operations []patchOperation) (interface{}, error) {
+	for index, operation := range operations {
+		var err error
+		target, err = applyOperation(target, operation)
+		if err != nil {
+			return nil, patchErrorf("operation %d (%s %s) failed: %s", index, operation.Op, operation.Path, err.Error())
+		}
+	}
+
+	return target, nil
+}
+
+func applyOperation(target interface{}, operation patchOperation) (interface{}, error) {
+	path, err := parsePointer(operation.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch operation.Op {
+	case patchAdd, patchReplace, patchTest:
+		if len(operation.Value) == 0 {
+			return nil, fmt.Errorf("%s requires a value", operation.Op)
+		}
+
+		value, err := decodeJSON(operation.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		switch operation.Op {
+		case patchAdd:
+			return addValue(target, path, value)
+		case patchReplace:
+			return replaceValue(target, path, value)
+		}
+
+		current, err := getValue(target, path)
+		if err != nil {
+			return nil, err
+		} else if !equalJSON(current, value) {
+			return nil, fmt.Errorf("value at %s is not equal to the tested value", operation.Path)
+		}
+
+		return target, nil
+	case patchRemove:
+		return removeValue(target, path)
+	case patchMove, patchCopy:
+		from, err := parsePointer(operation.From)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := getValue(target, from)
+		if err != nil {
+			return nil, err
+		}
+
+		if operation.Op == patchCopy {
+			if value, err = copyJSON(value); err != nil {
+				return nil, err
+			}
+
+			return addValue(target, path, value)
+		}
+
+		if strings.HasPrefix(operation.Path+"/", operation.From+"/") && operation.Path != operation.From {
+			return nil, fmt.Errorf("can't move %s into one of its children", operation.From)
+		}
+
+		if target, err = removeValue(target, from); err != nil {
+			return nil, err
+		}
+
+		return addValue(target, path, value)
+	default:
+		return nil, fmt.Errorf("unknown operation %q", operation.Op)
+	}
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) into its unescaped reference
+// tokens. The empty pointer refers to the whole document.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	} else if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("path %q must start with /", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for index, token := range tokens {
+		tokens[index] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+
+	return tokens, nil
+}
+
+func getValue(target interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch container := target.(type) {
+		case map[string]interface{}:
+			value, ok := container[token]
+			if !ok {
+				return nil, fmt.Errorf("member %s does not exist", token)
+			}
+
+			target = value
+		case []interface{}:
+			index, err := arrayIndex(token, len(container)-1)
+			if err != nil {
+				return nil, err
+			}
+
+			target = container[index]
+		default:
+			return nil, fmt.Errorf("can't look up %s in a scalar value", token)
+		}
+	}
+
+	return target, nil
+}
+
+func addValue(target interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return updateParent(target, path, func(parent interface{}, token string) (interface{}, error) {
+		switch container := parent.(type) {
+		case map[string]interface{}:
+			container[token] = value
+			return container, nil
+		case []interface{}:
+			index := len(container)
+			if token != "-" {
+				var err error
+				if index, err = arrayIndex(token, len(container)); err != nil {
+					return nil, err
+				}
+			}
+
+			container = append(container, nil)
+			copy(container[index+1:], container[index:])
+			container[index] = value
+			return container, nil
+		default:
+			return nil, fmt.Errorf("can't add %s to a scalar value", token)
+		}
+	})
+}
+
+func removeValue(target interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("can't remove the whole document")
+	}
+
+	return updateParent(target, path, func(parent interface{}, token string) (interface{}, error) {
+		switch container := parent.(type) {
+		case map[string]interface{}:
+			if _, ok := container[token]; !ok {
+				return nil, fmt.Errorf("member %s does not exist", token)
+			}
+
+			delete(container, token)
+			return container, nil
+		case []interface{}:
+			index, err := arrayIndex(token, len(container)-1)
+			if err != nil {
+				return nil, err
+			}
+
+			return append(container[:index], container[index+1:]...), nil
+		default:
+			return nil, fmt.Errorf("can't remove %s from a scalar value", token)
+		}
+	})
+}
+
+func replaceValue(target interface{}, path []string, value interface{}) (interface{}, error) {
+	if _, err := getValue(target, path); err != nil {
+		return nil, err
+	} else if len(path) == 0 {
+		return value, nil
+	}
+
+	return updateParent(target, path, func(parent interface{}, token string) (interface{}, error) {
+		switch container := parent.(type) {
+		case map[string]interface{}:
+			container[token] = value
+			return container, nil
+		case []interface{}:
+			index, err := arrayIndex(token, len(container)-1)
+			if err != nil {
+				return nil, err
+			}
+
+			container[index] = value
+			return container, nil
+		default:
+			return nil, fmt.Errorf("can't replace %s in a scalar value", token)
+		}
+	})
+}
+
+// updateParent walks to the parent of the value at a path and calls update
+// with the parent and the last token of the path. The parent returned by
+// update replaces the old one, since inserting into or removing from an array
+// creates a new slice.
+func updateParent(target interface{}, path []string, update func(interface{}, string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return update(target, path[0])
+	}
+
+	child, err := getValue(target, path[:1])
+	if err != nil {
+		return nil, err
+	}
+
+	child, err = updateParent(child, path[1:], update)
+	if err != nil {
+		return nil, err
+	}
+
+	switch container := target.(type) {
+	case map[string]interface{}:
+		container[path[0]] = child
+	case []interface{}:
+		index, _ := arrayIndex(path[0], len(container)-1)
+		container[index] = child
+	}
+
+	return target, nil
+}
+
+// arrayIndex parses an array index from a reference token and checks that it
+// is no greater than max.
+func arrayIndex(token string, max int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	} else if index > max {
+		return 0, fmt.Errorf("array index %d is out of bounds", index)
+	}
+
+	return index, nil
+}
+
+// equalJSON determines whether two decoded JSON values are equal. Numbers are
+// compared by value, so 1 and 1.0 are equal.
+func equalJSON(a interface{}, b interface{}) bool {
+	switch a := a.(type) {
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+
+		for name, value := range a {
+			other, ok := b[name]
+			if !ok || !equalJSON(value, other) {
+				return false
+			}
+		}
+
+		return true
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+
+		for index := range a {
+			if !equalJSON(a[index], b[index]) {
+				return false
+			}
+		}
+
+		return true
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+
+		floatA, errA := a.Float64()
+		floatB, errB := b.Float64()
+		return errA == nil && errB == nil && floatA == floatB
+	default:
+		return a == b
+	}
+}
+
+func copyJSON(value interface{}) (interface{}, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeJSON(encoded)
+}
+
+// decodeJSON decodes a JSON document, keeping numbers as json.Number so that
+// integers survive the round trip.
+func decodeJSON(data []byte) (interface{}, error) {
+	var value interface{}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
@@ -0,0 +1,76 @@
+package gizmo
+
+import (
+	"testing"
+)
+
+func TestApplyPatch_MergePatch(t *testing.T) {
+	var tests = []struct {
+		document string
+		patch    string
+		want     string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+		{`{"a":12345678901234567}`, `{"b":1}`, `{"a":12345678901234567,"b":1}`},
+	}
+
+	for _, test := range tests {
+		got, err := applyPatch([]byte(test.document), []byte(test.patch))
+		if err != nil {
+			t.Errorf("applyPatch(%s, %s) returned error %s", test.document, test.patch, err.Error())
+		} else if string(got) != test.want {
+			t.Errorf("applyPatch(%s, %s) = %s, want %s", test.document, test.patch, got, test.want)
+		}
+	}
+}
+
+func TestApplyPatch_JSONPatch(t *testing.T) {
+	var tests = []struct {
+		document string
+		patch    string
+		want     string
+		wantErr  string
+	}{
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`, ""},
+		{`{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`, ""},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc"]}]`, `{"foo":["bar",["abc"]]}`, ""},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`, ""},
+		{`{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`, ""},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`, ""},
+		{`{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`, ""},
+		{`{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`, ""},
+		{`{"foo":{"bar":1}}`, `[{"op":"copy","from":"/foo","path":"/baz"},{"op":"replace","path":"/baz/bar","value":2}]`, `{"baz":{"bar":2},"foo":{"bar":1}}`, ""},
+		{`{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2.0}]`, `{"baz":"qux","foo":["a",2,"c"]}`, ""},
+		{`{"/":9,"~1":10}`, `[{"op":"replace","path":"/~01","value":11},{"op":"remove","path":"/~1"}]`, `{"~1":11}`, ""},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"","value":{"baz":1}}]`, `{"baz":1}`, ""},
+		{`{"foo":null}`, `[{"op":"replace","path":"/foo","value":null}]`, `{"foo":null}`, ""},
+		{`{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`, "", "Unable to apply patch: operation 0 (test /baz) failed: value at /baz is not equal to the tested value"},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`, "", "Unable to apply patch: operation 0 (add /baz/bat) failed: member baz does not exist"},
+		{`{"foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"qux"}]`, "", "Unable to apply patch: operation 0 (replace /baz) failed: member baz does not exist"},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/2","value":"qux"}]`, "", "Unable to apply patch: operation 0 (add /foo/2) failed: array index 2 is out of bounds"},
+		{`{"foo":["bar"]}`, `[{"op":"remove","path":"/foo/01"}]`, "", "Unable to apply patch: operation 0 (remove /foo/01) failed: invalid array index \"01\""},
+		{`{"foo":{"bar":1}}`, `[{"op":"move","from":"/foo","path":"/foo/bar/baz"}]`, "", "Unable to apply patch: operation 0 (move /foo/bar/baz) failed: can't move /foo into one of its children"},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz"}]`, "", "Unable to apply patch: operation 0 (add /baz) failed: add requires a value"},
+		{`{"foo":"bar"}`, `[{"op":"update","path":"/foo","value":1}]`, "", "Unable to apply patch: operation 0 (update /foo) failed: unknown operation \"update\""},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"foo","value":1}]`, "", "Unable to apply patch: operation 0 (add foo) failed: path \"foo\" must start with /"},
+		{`{"foo":"bar"}`, `"foo"`, "", "Unable to apply patch: patch must be a JSON object or array"},
+	}
+
+	for _, test := range tests {
+		got, err := applyPatch([]byte(test.document), []byte(test.patch))
+		if errorMsg(err) != test.wantErr {
+			t.Errorf("applyPatch(%s, %s) = %s, want %s", test.document, test.patch, errorMsg(err), test.wantErr)
+		} else if test.wantErr == "" && string(got) != test.want {
+			t.Errorf("applyPatch(%s, %s) = %s, want %s", test.document, test.patch, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package gizmo
+
+import (
+	"database/sql"
+	"io"
+	"os"
+
+	"github.com/jmataya/gizmo/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// blobChunkSize is the size of the chunks that content is stored in by
+// postgresBlobStore, which bounds the memory that's used to stream it.
+const blobChunkSize = 1 << 20
+
+// postgresBlobStore is the default BlobStore of an EntityManager. It keeps
+// content in the object_blobs and object_blob_chunks tables.
+type postgresBlobStore struct {
+	db     *sql.DB
+	logger log.FieldLogger
+}
+
+// Put stores the content read from r. Since the digest of the content is only
+// known once all of it has been read, the content is first spooled to a
+// temporary file.
+func (s *postgresBlobStore) Put(r io.Reader) (string, int64, error) {
+	spool, err := os.CreateTemp("", "gizmo-blob-")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	h := newBlobHash()
+	size, err := io.Copy(io.MultiWriter(spool, h), r)
+	if err != nil {
+		return "", 0, err
+	}
+
+	digest := blobDigest(h)
+	if _, err := models.FindObjectBlob(s.db, digest); err == nil {
+		s.logger.Debugf("Blob %s is already stored", digest)
+		return digest, size, nil
+	} else if err != sql.ErrNoRows {
+		return "", 0, err
+	}
+
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return "", 0, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", 0, err
+	}
+
+	if err := insertBlob(tx, digest, size, spool); err == sql.ErrNoRows {
+		s.logger.Debugf("Blob %s was stored concurrently", digest)
+		tx.Rollback()
+		return digest, size, nil
+	} else if err != nil {
+		tx.Rollback()
+		return "", 0, err
+	}
+
+	return digest, size, tx.Commit()
+}
+
+func insertBlob(tx *sql.Tx, digest string, size int64, r io.Reader) error {
+	blob := models.ObjectBlob{Digest: digest, Size: size}
+	if _, err := blob.Insert(tx); err != nil {
+		return err
+	}
+
+	buffer := make([]byte, blobChunkSize)
+	for position := 0; ; position++ {
+		n, err := io.ReadFull(r, buffer)
+		if err == io.EOF {
+			return nil
+		} else if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+
+		chunk := models.ObjectBlobChunk{Digest: digest, Position: position, Content: buffer[:n]}
+		if err := chunk.Insert(tx); err != nil {
+			return err
+		}
+	}
+}
+
+// Open opens the content with a digest. Chunks are read from the database as
+// the content is read.
+func (s *postgresBlobStore) Open(digest string) (io.ReadCloser, error) {
+	if _, err := s.Size(digest); err != nil {
+		return nil, err
+	}
+
+	return &blobChunkReader{db: s.db, digest: digest}, nil
+}
+
+func (s *postgresBlobStore) Size(digest string) (int64, error) {
+	blob, err := models.FindObjectBlob(s.db, digest)
+	if err == sql.ErrNoRows {
+		return 0, ErrBlobNotFound
+	} else if err != nil {
+		return 0, err
+	}
+
+	return blob.Size, nil
+}
+
+// blobChunkReader reads the content of a blob one chunk at a time.
+type blobChunkReader struct {
+	db       *sql.DB
+	digest   string
+	position int
+	chunk    []byte
+	done     bool
+}
+
+func (r *blobChunkReader) Read(p []byte) (int, error) {
+	for len(r.chunk) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+
+		chunk, err := models.FindObjectBlobChunk(r.db, r.digest, r.position)
+		if err == sql.ErrNoRows {
+			r.done = true
+			continue
+		} else if err != nil {
+			return 0, err
+		}
+
+		r.chunk = chunk.Content
+		r.position++
+	}
+
+	n := copy(p, r.chunk)
+	r.chunk = r.chunk[n:]
+	return n, nil
+}
+
+func (r *blobChunkReader) Close() error {
+	r.done = true
+	r.chunk = nil
+	return nil
+}
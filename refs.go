@@ -0,0 +1,224 @@
+package gizmo
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/jmataya/gizmo/common"
+	"github.com/jmataya/gizmo/models"
+)
+
+// refBatchSize is the number of ObjectForms that are read at a time while
+// migrating or verifying refs.
+const refBatchSize = 100
+
+// RefMigration summarizes the work done by MigrateAttributeRefs.
+type RefMigration struct {
+	Forms   int
+	Shadows int
+	Refs    int
+}
+
+// MigrateAttributeRefs rewrites the refs of every ObjectForm and ObjectShadow
+// that were written before refs were computed by models.AttributeRef. Each
+// form is migrated together with its shadows in a transaction of its own, and
+// forms whose refs are already current are skipped, so the migration can be
+// interrupted and run again. Progress is logged to the logger that is set
+// with WithLogger.
+func MigrateAttributeRefs(db *sql.DB, opts ...Option) (RefMigration, error) {
+	logger := loggerOf(opts)
+	migration := RefMigration{}
+
+	var afterID int64
+	for {
+		forms, err := models.FindObjectForms(db, afterID, refBatchSize)
+		if err != nil {
+			return migration, err
+		} else if len(forms) == 0 {
+			return migration, nil
+		}
+
+		for _, form := range forms {
+			afterID = form.ID
+
+			refs, err := migratedRefs(form)
+			if err != nil {
+				return migration, err
+			} else if len(refs) == 0 {
+				continue
+			}
+
+			logger.Debugf("Migrating %d refs of ObjectForm with ID=%d", len(refs), form.ID)
+			shadows, err := migrateForm(db, form, refs)
+			if err != nil {
+				return migration, fmt.Errorf("Unable to migrate refs of form %d: %s", form.ID, err.Error())
+			}
+
+			migration.Forms++
+			migration.Shadows += shadows
+			migration.Refs += len(refs)
+		}
+	}
+}
+
+// migratedRefs maps each ref of a form that isn't current to its new ref.
+func migratedRefs(form models.ObjectForm) (map[string]string, error) {
+	refs := map[string]string{}
+	for ref, value := range form.Attributes {
+		newRef, err := models.AttributeRef(value)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to compute ref of %s in form %d: %s", ref, form.ID, err.Error())
+		}
+
+		if newRef != ref {
+			refs[ref] = newRef
+		}
+	}
+
+	return refs, nil
+}
+
+func migrateForm(db *sql.DB, form models.ObjectForm, refs map[string]string) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	shadows, err := models.FindObjectShadowsByForm(tx, form.ID)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	attributes := models.ObjectFormAttributes{}
+	for ref, value := range form.Attributes {
+		if newRef, ok := refs[ref]; ok {
+			ref = newRef
+		}
+
+		attributes[ref] = value
+	}
+
+	form.Attributes = attributes
+	if err := form.UpdateAttributes(tx); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	for _, shadow := range shadows {
+		for name, attribute := range shadow.Attributes {
+			if newRef, ok := refs[attribute.Ref]; ok {
+				attribute.Ref = newRef
+				shadow.Attributes[name] = attribute
+			}
+		}
+
+		if err := shadow.UpdateAttributes(tx); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	return len(shadows), tx.Commit()
+}
+
+// RefProblem is a ref that VerifyAttributeRefs found to be invalid. ShadowID
+// and Attribute are only set for refs in shadows.
+type RefProblem struct {
+	FormID    int64
+	ShadowID  int64
+	Attribute string
+	Ref       string
+	Message   string
+}
+
+func (p RefProblem) String() string {
+	if p.ShadowID != 0 {
+		return fmt.Sprintf("shadow %d: attribute %s with ref %s %s", p.ShadowID, p.Attribute, p.Ref, p.Message)
+	}
+
+	return fmt.Sprintf("form %d: ref %s %s", p.FormID, p.Ref, p.Message)
+}
+
+// VerifyAttributeRefs checks that every ref in an ObjectForm is the
+// models.AttributeRef of its value, and that every ref in an ObjectShadow
+// resolves to a value in its form. It returns every problem that it finds,
+// ordered by form.
+func VerifyAttributeRefs(db common.DB) ([]RefProblem, error) {
+	problems := []RefProblem{}
+
+	var afterID int64
+	for {
+		forms, err := models.FindObjectForms(db, afterID, refBatchSize)
+		if err != nil {
+			return nil, err
+		} else if len(forms) == 0 {
+			return problems, nil
+		}
+
+		for _, form := range forms {
+			afterID = form.ID
+
+			formProblems, err := verifyForm(db, form)
+			if err != nil {
+				return nil, err
+			}
+
+			problems = append(problems, formProblems...)
+		}
+	}
+}
+
+func verifyForm(db common.DB, form models.ObjectForm) ([]RefProblem, error) {
+	problems := []RefProblem{}
+
+	refs := map[string]bool{}
+	for ref := range form.Attributes {
+		refs[ref] = true
+	}
+
+	for _, ref := range sortedKeys(refs) {
+		if !models.IsAttributeRef(ref) {
+			problems = append(problems, RefProblem{FormID: form.ID, Ref: ref, Message: "is not a sha256 ref"})
+			continue
+		}
+
+		expected, err := models.AttributeRef(form.Attributes[ref])
+		if err != nil {
+			return nil, err
+		} else if expected != ref {
+			problems = append(problems, RefProblem{FormID: form.ID, Ref: ref, Message: "does not match its value"})
+		}
+	}
+
+	shadows, err := models.FindObjectShadowsByForm(db, form.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, shadow := range shadows {
+		for _, name := range sortedAttributeNames(shadow.Attributes) {
+			ref := shadow.Attributes[name].Ref
+			if !refs[ref] {
+				problems = append(problems, RefProblem{
+					FormID:    form.ID,
+					ShadowID:  shadow.ID,
+					Attribute: name,
+					Ref:       ref,
+					Message:   fmt.Sprintf("does not resolve to a value in form %d", form.ID),
+				})
+			}
+		}
+	}
+
+	return problems, nil
+}
+
+func sortedAttributeNames(attributes models.ObjectShadowAttributes) []string {
+	names := map[string]bool{}
+	for name := range attributes {
+		names[name] = true
+	}
+
+	return sortedKeys(names)
+}
@@ -0,0 +1,86 @@
+package gizmo
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/jmataya/gizmo/models"
+	"github.com/jmataya/gizmo/testutils"
+)
+
+func TestMigrateAttributeRefs(t *testing.T) {
+	assert := testutils.NewAssert(t)
+
+	db := testutils.InitDB(t)
+	defer db.Close()
+
+	// Refs written by older versions of gizmo were the hex encoding of the
+	// JSON value followed by the SHA-1 of nothing.
+	legacyRef := fmt.Sprintf("%x%s", `"Fox Socks"`, "da39a3ee5e6b4b0d3255bfef95601890afd80709")
+
+	// They were stored inline, which ObjectForm no longer does.
+	var formID int64
+	err := db.QueryRow(
+		"INSERT INTO object_forms (kind, attributes) VALUES ($1, $2) RETURNING id",
+		"product",
+		models.ObjectFormAttributes{legacyRef: "Fox Socks"}).Scan(&formID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shadow := models.NewObjectShadow()
+	shadow.FormID = formID
+	if err := shadow.AddAttribute("title", "string", legacyRef); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := shadow.Insert(db); err != nil {
+		t.Fatal(err)
+	}
+
+	migration, err := MigrateAttributeRefs(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(true, migration.Forms >= 1)
+	assert.Equal(true, migration.Refs >= 1)
+
+	problems, err := VerifyAttributeRefs(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(0, len(problems))
+
+	shadows, err := models.FindObjectShadowsByForm(db, formID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref, err := models.AttributeRef("Fox Socks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(ref, shadows[0].Attributes["title"].Ref)
+
+	again, err := MigrateAttributeRefs(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(0, again.Forms)
+
+	broken := models.NewObjectShadow()
+	broken.FormID = formID
+	if err := broken.AddAttribute("title", "string", legacyRef); err != nil {
+		t.Fatal(err)
+	}
+	savedBroken, err := broken.Insert(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	problems, err = VerifyAttributeRefs(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(1, len(problems))
+	assert.Equal(savedBroken.ID, problems[0].ShadowID)
+}
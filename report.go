@@ -0,0 +1,149 @@
+package gizmo
+
+import (
+	"time"
+
+	"github.com/jmataya/gizmo/common"
+	"github.com/jmataya/gizmo/models"
+)
+
+// KindReport describes the attributes that are actually stored for a kind, as
+// recorded by the shadows of its commits. It is a starting point for writing
+// the Schema of a kind.
+type KindReport struct {
+	Kind       string            `json:"kind"`
+	Commits    int64             `json:"commits"`
+	Attributes []AttributeReport `json:"attributes"`
+}
+
+// AttributeReport describes a single attribute of a kind. Frequency is the
+// share of the kind's commits that include the attribute. TypeChanged flags
+// attributes that have been stored with more than one type, not counting null.
+type AttributeReport struct {
+	Name          string       `json:"name"`
+	Types         []TypeReport `json:"types"`
+	Commits       int64        `json:"commits"`
+	Frequency     float64      `json:"frequency"`
+	FirstCommitID int64        `json:"first_commit_id"`
+	LastCommitID  int64        `json:"last_commit_id"`
+	TypeChanged   bool         `json:"type_changed"`
+}
+
+// TypeReport describes the commits in which an attribute had a single type.
+type TypeReport struct {
+	Type          string    `json:"type"`
+	Commits       int64     `json:"commits"`
+	FirstCommitID int64     `json:"first_commit_id"`
+	LastCommitID  int64     `json:"last_commit_id"`
+	FirstSeenAt   time.Time `json:"first_seen_at"`
+	LastSeenAt    time.Time `json:"last_seen_at"`
+}
+
+// Report scans the stored shadows of the specified kinds and describes their
+// attributes. If no kinds are specified, every kind with content is reported.
+func Report(db common.DB, kinds ...string) ([]KindReport, error) {
+	if len(kinds) == 0 {
+		var err error
+		if kinds, err = models.FindKinds(db); err != nil {
+			return nil, err
+		}
+	}
+
+	reports := make([]KindReport, len(kinds))
+	for index, kind := range kinds {
+		commits, err := models.CountCommitsByKind(db, kind)
+		if err != nil {
+			return nil, err
+		}
+
+		stats, err := models.FindShadowAttributeStats(db, kind)
+		if err != nil {
+			return nil, err
+		}
+
+		reports[index] = newKindReport(kind, commits, stats)
+	}
+
+	return reports, nil
+}
+
+// newKindReport builds the report of a kind from statistics that are ordered
+// by attribute name.
+func newKindReport(kind string, commits int64, stats []models.ShadowAttributeStat) KindReport {
+	report := KindReport{Kind: kind, Commits: commits, Attributes: []AttributeReport{}}
+
+	for _, stat := range stats {
+		last := len(report.Attributes) - 1
+		if last < 0 || report.Attributes[last].Name != stat.Name {
+			report.Attributes = append(report.Attributes, AttributeReport{
+				Name:          stat.Name,
+				Types:         []TypeReport{},
+				FirstCommitID: stat.FirstCommitID,
+				LastCommitID:  stat.LastCommitID,
+			})
+			last++
+		}
+
+		attribute := &report.Attributes[last]
+		attribute.Types = append(attribute.Types, TypeReport{
+			Type:          stat.Type,
+			Commits:       stat.Commits,
+			FirstCommitID: stat.FirstCommitID,
+			LastCommitID:  stat.LastCommitID,
+			FirstSeenAt:   stat.FirstSeenAt,
+			LastSeenAt:    stat.LastSeenAt,
+		})
+
+		attribute.Commits += stat.Commits
+		if stat.FirstCommitID < attribute.FirstCommitID {
+			attribute.FirstCommitID = stat.FirstCommitID
+		}
+		if stat.LastCommitID > attribute.LastCommitID {
+			attribute.LastCommitID = stat.LastCommitID
+		}
+	}
+
+	for index := range report.Attributes {
+		attribute := &report.Attributes[index]
+		if commits > 0 {
+			attribute.Frequency = float64(attribute.Commits) / float64(commits)
+		}
+
+		types := 0
+		for _, typeReport := range attribute.Types {
+			if typeReport.Type != "null" {
+				types++
+			}
+		}
+		attribute.TypeChanged = types > 1
+	}
+
+	return report
+}
+
+// InferSchema drafts a Schema from the report. Each attribute gets the type it
+// was most recently stored with, and attributes that are in every commit are
+// required. Relations aren't recorded in shadows, so any are allowed.
+func (r KindReport) InferSchema() Schema {
+	schema := Schema{
+		Kind:                r.Kind,
+		Attributes:          map[string]AttributeSchema{},
+		AdditionalRelations: true,
+	}
+
+	for _, attribute := range r.Attributes {
+		var latest TypeReport
+		for _, typeReport := range attribute.Types {
+			if typeReport.Type != "null" && typeReport.LastCommitID >= latest.LastCommitID {
+				latest = typeReport
+			}
+		}
+
+		schema.Attributes[attribute.Name] = AttributeSchema{
+			Type:     latest.Type,
+			Required: r.Commits > 0 && attribute.Commits == r.Commits,
+		}
+	}
+
+	return schema
+}
@@ -0,0 +1,72 @@
+package gizmo
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jmataya/gizmo/models"
+	"github.com/jmataya/gizmo/testutils"
+)
+
+var listingStats = []models.ShadowAttributeStat{
+	{Name: "name", Type: "string", Commits: 4, FirstCommitID: 1, LastCommitID: 9},
+	{Name: "notes", Type: "null", Commits: 1, FirstCommitID: 2, LastCommitID: 2},
+	{Name: "notes", Type: "string", Commits: 1, FirstCommitID: 5, LastCommitID: 5},
+	{Name: "price", Type: "string", Commits: 2, FirstCommitID: 1, LastCommitID: 4},
+	{Name: "price", Type: "money", Commits: 2, FirstCommitID: 6, LastCommitID: 9},
+}
+
+func TestNewKindReport(t *testing.T) {
+	assert := testutils.NewAssert(t)
+
+	report := newKindReport("listing", 4, listingStats)
+	assert.Equal("listing", report.Kind)
+	assert.Equal(3, len(report.Attributes))
+
+	var tests = []struct {
+		name        string
+		types       []string
+		commits     int64
+		frequency   float64
+		first       int64
+		last        int64
+		typeChanged bool
+	}{
+		{"name", []string{"string"}, 4, 1, 1, 9, false},
+		{"notes", []string{"null", "string"}, 2, 0.5, 2, 5, false},
+		{"price", []string{"string", "money"}, 4, 1, 1, 9, true},
+	}
+
+	for index, test := range tests {
+		attribute := report.Attributes[index]
+
+		types := []string{}
+		for _, typeReport := range attribute.Types {
+			types = append(types, typeReport.Type)
+		}
+
+		if attribute.Name != test.name ||
+			!reflect.DeepEqual(types, test.types) ||
+			attribute.Commits != test.commits ||
+			attribute.Frequency != test.frequency ||
+			attribute.FirstCommitID != test.first ||
+			attribute.LastCommitID != test.last ||
+			attribute.TypeChanged != test.typeChanged {
+			t.Errorf("Attribute %d = %+v, want %+v", index, attribute, test)
+		}
+	}
+}
+
+func TestKindReport_InferSchema(t *testing.T) {
+	schema := newKindReport("listing", 4, listingStats).InferSchema()
+
+	want := map[string]AttributeSchema{
+		"name":  {Type: "string", Required: true},
+		"notes": {Type: "string"},
+		"price": {Type: "money", Required: true},
+	}
+
+	if schema.Kind != "listing" || !reflect.DeepEqual(schema.Attributes, want) {
+		t.Errorf("InferSchema() = %+v, want attributes %+v", schema, want)
+	}
+}
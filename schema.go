@@ -0,0 +1,318 @@
+package gizmo
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jmataya/gizmo/models"
+)
+
+// ErrSchemaNotFound is returned when a kind has no schema.
+var ErrSchemaNotFound = errors.New("Schema not found")
+
+// Schema describes the attributes and relations that Entities of a kind may
+// have. Schemas are stored in the database and versioned: defining the schema
+// of a kind again creates a new version, and Entities are validated against
+// the most recent version when they are created or updated.
+type Schema struct {
+	Kind    string `json:"-"`
+	Version int    `json:"-"`
+
+	Attributes map[string]AttributeSchema `json:"attributes,omitempty"`
+	Relations  map[string]RelationSchema  `json:"relations,omitempty"`
+
+	// AdditionalAttributes allows attributes that aren't in the schema.
+	AdditionalAttributes bool `json:"additional_attributes,omitempty"`
+
+	// AdditionalRelations allows relations that aren't in the schema.
+	AdditionalRelations bool `json:"additional_relations,omitempty"`
+}
+
+// AttributeSchema constrains a single attribute. Min and Max bound the value
+// of a number, the length of a string, or the number of elements in a list or
+// map.
+type AttributeSchema struct {
+	Type     string        `json:"type,omitempty"`
+	Required bool          `json:"required,omitempty"`
+	Enum     []interface{} `json:"enum,omitempty"`
+	Min      *float64      `json:"min,omitempty"`
+	Max      *float64      `json:"max,omitempty"`
+	Pattern  string        `json:"pattern,omitempty"`
+}
+
+// RelationSchema constrains the edges of a single relation. Kinds lists the
+// kinds that may be related, and Min and Max bound the number of edges. A Max
+// of zero doesn't limit the number of edges.
+type RelationSchema struct {
+	Kinds []string `json:"kinds,omitempty"`
+	Min   int      `json:"min,omitempty"`
+	Max   int      `json:"max,omitempty"`
+}
+
+// Violation is a single way in which an Entity doesn't conform to the schema
+// of its kind. Either Attribute or Relation is set.
+type Violation struct {
+	Attribute string
+	Relation  string
+	Message   string
+}
+
+func (v Violation) String() string {
+	if v.Relation != "" {
+		return fmt.Sprintf("relation %s %s", v.Relation, v.Message)
+	}
+
+	return fmt.Sprintf("attribute %s %s", v.Attribute, v.Message)
+}
+
+// ValidationError is returned when an Entity is saved that doesn't conform to
+// the schema of its kind. It lists every violation.
+type ValidationError struct {
+	Kind       string
+	Version    int
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for index, violation := range e.Violations {
+		messages[index] = violation.String()
+	}
+
+	return fmt.Sprintf(
+		"Entity does not conform to version %d of the schema of %s: %s",
+		e.Version,
+		e.Kind,
+		strings.Join(messages, "; "))
+}
+
+// Validate checks that the schema itself is well formed.
+func (s Schema) Validate() error {
+	if s.Kind == "" {
+		return errors.New("Kind must be non-empty")
+	}
+
+	for name, attribute := range s.Attributes {
+		if attribute.Pattern != "" {
+			if _, err := regexp.Compile(attribute.Pattern); err != nil {
+				return fmt.Errorf("Pattern of attribute %s is invalid: %s", name, err.Error())
+			}
+		}
+
+		if attribute.Min != nil && attribute.Max != nil && *attribute.Min > *attribute.Max {
+			return fmt.Errorf("Min of attribute %s is greater than its max", name)
+		}
+	}
+
+	for name, relation := range s.Relations {
+		if relation.Min < 0 || relation.Max < 0 {
+			return fmt.Errorf("Min and max of relation %s must not be negative", name)
+		} else if relation.Max != 0 && relation.Min > relation.Max {
+			return fmt.Errorf("Min of relation %s is greater than its max", name)
+		}
+	}
+
+	return nil
+}
+
+// validate checks the content and relations of an Entity against the schema
+// and returns every violation, ordered by name.
+func (s Schema) validate(full models.FullObject, relations models.EntityRelations) []Violation {
+	violations := []Violation{}
+
+	names := map[string]bool{}
+	for name := range s.Attributes {
+		names[name] = true
+	}
+	for name := range full.Shadow.Attributes {
+		names[name] = true
+	}
+
+	for _, name := range sortedKeys(names) {
+		var value interface{}
+		attribute, ok := full.Shadow.Attributes[name]
+		if ok {
+			value = full.Form.Attributes[attribute.Ref]
+		}
+
+		attributeSchema, defined := s.Attributes[name]
+		if !defined {
+			if !s.AdditionalAttributes {
+				violations = append(violations, Violation{Attribute: name, Message: "is not defined in the schema"})
+			}
+
+			continue
+		}
+
+		for _, message := range attributeSchema.validate(attribute.Type, value) {
+			violations = append(violations, Violation{Attribute: name, Message: message})
+		}
+	}
+
+	names = map[string]bool{}
+	for name := range s.Relations {
+		names[name] = true
+	}
+	for name := range relations {
+		names[name] = true
+	}
+
+	for _, name := range sortedKeys(names) {
+		relationSchema, defined := s.Relations[name]
+		if !defined {
+			if !s.AdditionalRelations && len(relations[name]) > 0 {
+				violations = append(violations, Violation{Relation: name, Message: "is not defined in the schema"})
+			}
+
+			continue
+		}
+
+		for _, message := range relationSchema.validate(relations[name]) {
+			violations = append(violations, Violation{Relation: name, Message: message})
+		}
+	}
+
+	return violations
+}
+
+func (a AttributeSchema) validate(attrType string, value interface{}) []string {
+	if value == nil {
+		if a.Required {
+			return []string{"is required"}
+		}
+
+		return nil
+	}
+
+	if a.Type != "" && attrType != a.Type {
+		return []string{fmt.Sprintf("must be of type %s, not %s", a.Type, attrType)}
+	}
+
+	messages := []string{}
+	if len(a.Enum) > 0 && !containsValue(a.Enum, value) {
+		messages = append(messages, fmt.Sprintf("must be one of %v", a.Enum))
+	}
+
+	if size, ok := sizeOf(value); ok {
+		if a.Min != nil && size < *a.Min {
+			messages = append(messages, fmt.Sprintf("must be at least %v", *a.Min))
+		}
+		if a.Max != nil && size > *a.Max {
+			messages = append(messages, fmt.Sprintf("must be at most %v", *a.Max))
+		}
+	}
+
+	if a.Pattern != "" {
+		str, ok := value.(string)
+		if !ok {
+			messages = append(messages, fmt.Sprintf("must be a string to match %s", a.Pattern))
+		} else if matched, _ := regexp.MatchString(a.Pattern, str); !matched {
+			messages = append(messages, fmt.Sprintf("must match %s", a.Pattern))
+		}
+	}
+
+	return messages
+}
+
+func (r RelationSchema) validate(edges []models.RelationEdge) []string {
+	messages := []string{}
+	if len(edges) < r.Min {
+		messages = append(messages, fmt.Sprintf("has %d edges, fewer than the minimum of %d", len(edges), r.Min))
+	} else if r.Max != 0 && len(edges) > r.Max {
+		messages = append(messages, fmt.Sprintf("has %d edges, more than the maximum of %d", len(edges), r.Max))
+	}
+
+	if len(r.Kinds) == 0 {
+		return messages
+	}
+
+	for _, edge := range edges {
+		if !containsString(r.Kinds, edge.Kind) {
+			messages = append(messages, fmt.Sprintf("must relate to %s, not %s", strings.Join(r.Kinds, " or "), edge.Kind))
+		}
+	}
+
+	return messages
+}
+
+// sizeOf gets the value of a number, the length of a string, or the number of
+// elements in a list or map. The second return value reports whether the value
+// has a size.
+func sizeOf(value interface{}) (float64, bool) {
+	if number, ok := value.(json.Number); ok {
+		f, err := number.Float64()
+		return f, err == nil
+	}
+
+	val := reflect.ValueOf(value)
+	switch val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(val.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(val.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return val.Float(), true
+	case reflect.String:
+		return float64(utf8.RuneCountInString(val.String())), true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(val.Len()), true
+	default:
+		return 0, false
+	}
+}
+
+// containsValue determines whether a value is in a list, comparing their JSON
+// encodings so that numbers of different Go types are equal.
+func containsValue(list []interface{}, value interface{}) bool {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return false
+	}
+
+	for _, elem := range list {
+		if encodedElem, err := json.Marshal(elem); err == nil && bytes.Equal(encoded, encodedElem) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsString(list []string, str string) bool {
+	for _, elem := range list {
+		if elem == str {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// schemaFromModel decodes the definition of a stored schema.
+func schemaFromModel(model models.EntitySchema) (Schema, error) {
+	var schema Schema
+	if err := json.Unmarshal(model.Definition, &schema); err != nil {
+		return schema, fmt.Errorf("Unable to decode version %d of the schema of %s: %s", model.Version, model.Kind, err.Error())
+	}
+
+	schema.Kind = model.Kind
+	schema.Version = model.Version
+	return schema, nil
+}
@@ -0,0 +1,127 @@
+package gizmo
+
+import (
+	"testing"
+
+	"github.com/jmataya/gizmo/models"
+	"github.com/jmataya/gizmo/testutils"
+)
+
+func float(f float64) *float64 {
+	return &f
+}
+
+var productSchema = Schema{
+	Kind:    "product",
+	Version: 2,
+	Attributes: map[string]AttributeSchema{
+		"title":  {Type: "string", Required: true, Min: float(1), Max: float(10)},
+		"slug":   {Type: "string", Pattern: "^[a-z-]+$"},
+		"status": {Type: "string", Enum: []interface{}{"draft", "active"}},
+		"stock":  {Type: "int", Min: float(0)},
+		"tags":   {Type: "list<string>", Max: float(2)},
+	},
+	Relations: map[string]RelationSchema{
+		"sku":   {Kinds: []string{"sku"}, Min: 1, Max: 2},
+		"image": {Kinds: []string{"image", "video"}},
+	},
+}
+
+func TestSchema_Validate(t *testing.T) {
+	var tests = []struct {
+		schema  Schema
+		wantErr string
+	}{
+		{productSchema, ""},
+		{Schema{}, "Kind must be non-empty"},
+		{Schema{Kind: "product", Attributes: map[string]AttributeSchema{"slug": {Pattern: "("}}}, "Pattern of attribute slug is invalid: error parsing regexp: missing closing ): `(`"},
+		{Schema{Kind: "product", Attributes: map[string]AttributeSchema{"stock": {Min: float(2), Max: float(1)}}}, "Min of attribute stock is greater than its max"},
+		{Schema{Kind: "product", Relations: map[string]RelationSchema{"sku": {Min: 2, Max: 1}}}, "Min of relation sku is greater than its max"},
+	}
+
+	for _, test := range tests {
+		if err := test.schema.Validate(); errorMsg(err) != test.wantErr {
+			t.Errorf("Validate() = %s, want %s", errorMsg(err), test.wantErr)
+		}
+	}
+}
+
+func TestSchema_ValidateEntity(t *testing.T) {
+	var tests = []struct {
+		name       string
+		attributes map[string]interface{}
+		relations  map[string][]models.RelationEdge
+		want       string
+	}{
+		{
+			"valid",
+			map[string]interface{}{"title": "Socks", "slug": "wool-socks", "status": "active", "stock": 3, "tags": []string{"wool"}},
+			map[string][]models.RelationEdge{"sku": {{ID: 1, Kind: "sku"}}, "image": {{ID: 2, Kind: "video"}}},
+			"",
+		},
+		{
+			"every violation",
+			map[string]interface{}{"title": "Socks for every occasion", "slug": "Wool Socks", "status": "deleted", "stock": -1, "tags": []string{"a", "b", "c"}, "color": "red"},
+			map[string][]models.RelationEdge{"image": {{ID: 2, Kind: "sku"}}, "variant": {{ID: 3, Kind: "variant"}}},
+			"Entity does not conform to version 2 of the schema of product: " +
+				"attribute color is not defined in the schema; " +
+				"attribute slug must match ^[a-z-]+$; " +
+				"attribute status must be one of [draft active]; " +
+				"attribute stock must be at least 0; " +
+				"attribute tags must be at most 2; " +
+				"attribute title must be at most 10; " +
+				"relation image must relate to image or video, not sku; " +
+				"relation sku has 0 edges, fewer than the minimum of 1; " +
+				"relation variant is not defined in the schema",
+		},
+		{
+			"wrong type and missing",
+			map[string]interface{}{"stock": "many"},
+			map[string][]models.RelationEdge{"sku": {{ID: 1, Kind: "sku"}}},
+			"Entity does not conform to version 2 of the schema of product: " +
+				"attribute stock must be of type int, not string; " +
+				"attribute title is required",
+		},
+	}
+
+	for _, test := range tests {
+		full := fullObjectOf(t, test.attributes)
+		violations := productSchema.validate(full, models.EntityRelations(test.relations))
+
+		got := ""
+		if len(violations) > 0 {
+			got = (&ValidationError{Kind: "product", Version: 2, Violations: violations}).Error()
+		}
+
+		if got != test.want {
+			t.Errorf("validate(%s) = %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSchema_AdditionalAttributes(t *testing.T) {
+	assert := testutils.NewAssert(t)
+
+	schema := Schema{Kind: "note", AdditionalAttributes: true, AdditionalRelations: true}
+	full := fullObjectOf(t, map[string]interface{}{"body": "Hello"})
+	relations := models.EntityRelations{"author": {{ID: 1, Kind: "user"}}}
+
+	assert.Equal(0, len(schema.validate(full, relations)))
+}
+
+func fullObjectOf(t *testing.T, attributes map[string]interface{}) models.FullObject {
+	form := models.NewObjectForm("product")
+	shadow := models.NewObjectShadow()
+	for name, value := range attributes {
+		ref, err := form.AddAttribute(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := shadow.AddAttribute(name, valueTypeName(value), ref); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return models.FullObject{Form: *form, Shadow: *shadow}
+}
@@ -0,0 +1,8 @@
+alter table entity_versions add column root_id integer null references entity_roots(id) on update restrict on delete restrict;
+
+update entity_versions as v set root_id = h.root_id
+  from entity_heads as h
+  where h.version_id = v.id;
+
+create index entity_versions_root_idx on entity_versions (root_id);
+create index entity_heads_root_view_idx on entity_heads (root_id, view_id);
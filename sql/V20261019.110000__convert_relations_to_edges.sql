@@ -0,0 +1,11 @@
+update entity_versions set relations = (
+  select coalesce(jsonb_object_agg(r.key, (
+    select coalesce(jsonb_agg(
+      case jsonb_typeof(e.value)
+        when 'object' then e.value
+        else jsonb_build_object('id', e.value, 'position', e.ordinality - 1)
+      end order by e.ordinality), '[]'::jsonb)
+    from jsonb_array_elements(r.value) with ordinality as e(value, ordinality)
+  )), '{}'::jsonb)
+  from jsonb_each(relations) as r
+);
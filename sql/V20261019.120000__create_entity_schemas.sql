@@ -0,0 +1,10 @@
+create table entity_schemas (
+  id serial primary key,
+  kind generic_string not null,
+  version integer not null,
+  definition jsonb not null,
+
+  created_at generic_timestamp,
+
+  unique (kind, version)
+);
@@ -0,0 +1 @@
+alter table object_shadows add column revision integer not null default 0;
@@ -0,0 +1,29 @@
+create table object_values (
+  ref text primary key,
+  value jsonb not null,
+
+  created_at generic_timestamp
+);
+
+alter table object_forms add column refs jsonb not null default '[]';
+
+-- Move the values of forms whose refs are all content addresses into the
+-- shared table. Forms with refs from older versions of gizmo keep their values
+-- inline until `gizmo migrate-refs` rewrites them.
+insert into object_values (ref, value)
+  select distinct on (a.key) a.key, a.value
+  from object_forms as f
+  cross join lateral jsonb_each(f.attributes) as a
+  where not exists (
+    select 1 from jsonb_object_keys(f.attributes) as k where k not like 'sha256:%'
+  )
+  order by a.key
+  on conflict (ref) do nothing;
+
+update object_forms as f
+  set refs = (select coalesce(jsonb_agg(k), '[]') from jsonb_object_keys(f.attributes) as k),
+      attributes = null
+  where f.attributes is not null
+    and not exists (
+      select 1 from jsonb_object_keys(f.attributes) as k where k not like 'sha256:%'
+    );
@@ -0,0 +1,14 @@
+create table object_blobs (
+  digest text primary key,
+  size bigint not null,
+
+  created_at generic_timestamp
+);
+
+create table object_blob_chunks (
+  digest text not null references object_blobs(digest) on update restrict on delete restrict,
+  position integer not null,
+  content bytea not null,
+
+  primary key (digest, position)
+);
@@ -0,0 +1,46 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/jmataya/gizmo"
+	"github.com/jmataya/gizmo/models"
+	"github.com/jmataya/gizmo/store"
+	"github.com/jmataya/gizmo/testutils"
+)
+
+type benchmarkSKU struct {
+	gizmo.EntityObject
+	Code  string
+	Price float64
+}
+
+// BenchmarkCreate compares creating Entities with statements that are
+// prepared for every query against statements that are cached.
+func BenchmarkCreate(b *testing.B) {
+	db := testutils.InitDB(b)
+	defer db.Close()
+
+	view := models.CreateView(b, db)
+
+	var stores = []struct {
+		name  string
+		store store.Store
+	}{
+		{"Uncached", store.NewUncachedPostgresStore(db)},
+		{"Cached", store.NewPostgresStore(db)},
+	}
+
+	for _, s := range stores {
+		b.Run(s.name, func(b *testing.B) {
+			mgr := gizmo.NewEntityManagerWithStore(s.store)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := mgr.Create(&benchmarkSKU{Code: "SKU-BENCH", Price: 999.0}, view.ID); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
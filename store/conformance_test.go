@@ -0,0 +1,33 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/jmataya/gizmo/store"
+	"github.com/jmataya/gizmo/store/storetest"
+	"github.com/jmataya/gizmo/testutils"
+)
+
+func TestMemoryStore_Conformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		return store.NewMemoryStore()
+	})
+}
+
+func TestPostgresStore_Conformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		db := testutils.InitDB(t)
+		t.Cleanup(func() { db.Close() })
+
+		return store.NewPostgresStore(db)
+	})
+}
+
+func TestUncachedPostgresStore_Conformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		db := testutils.InitDB(t)
+		t.Cleanup(func() { db.Close() })
+
+		return store.NewUncachedPostgresStore(db)
+	})
+}
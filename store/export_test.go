@@ -0,0 +1,23 @@
+package store
+
+import "database/sql"
+
+// NewUncachedPostgresStore creates a Postgres Store that prepares and closes a
+// statement for every query, to compare the statement cache against.
+func NewUncachedPostgresStore(db *sql.DB) Store {
+	return &uncachedPostgresStore{postgresQueries: postgresQueries{db: db}, db: db}
+}
+
+type uncachedPostgresStore struct {
+	postgresQueries
+	db *sql.DB
+}
+
+func (s *uncachedPostgresStore) Begin() (Tx, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	return &postgresTx{postgresQueries: postgresQueries{db: tx}, tx: tx}, nil
+}
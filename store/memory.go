@@ -0,0 +1,773 @@
+package store
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmataya/gizmo/models"
+)
+
+// NewMemoryStore creates a Store that keeps Entities in memory. It has the
+// same behavior as the Postgres Store, which makes it suitable for tests that
+// use an EntityManager without a database.
+//
+// Transactions are serialized: Begin waits until the previous transaction is
+// committed or rolled back. Reads outside of a transaction never wait, and see
+// the Store as of the last commit. A goroutine with an open transaction must
+// not write to the Store outside of it.
+func NewMemoryStore() Store {
+	return &memoryStore{data: newMemoryData()}
+}
+
+type memoryStore struct {
+	// writer is held by the open transaction and by writes outside of
+	// transactions.
+	writer sync.Mutex
+
+	// mu guards data.
+	mu   sync.RWMutex
+	data *memoryData
+}
+
+func (s *memoryStore) Begin() (Tx, error) {
+	s.writer.Lock()
+
+	s.mu.RLock()
+	data := s.data.clone()
+	s.mu.RUnlock()
+
+	return &memoryTx{memoryData: data, store: s}, nil
+}
+
+func (s *memoryStore) read(query func(*memoryData) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return query(s.data)
+}
+
+func (s *memoryStore) write(query func(*memoryData) error) error {
+	s.writer.Lock()
+	defer s.writer.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return query(s.data)
+}
+
+func (s *memoryStore) InsertForm(form models.ObjectForm) (models.ObjectForm, error) {
+	var inserted models.ObjectForm
+	err := s.write(func(d *memoryData) (err error) {
+		inserted, err = d.InsertForm(form)
+		return err
+	})
+
+	return inserted, err
+}
+
+func (s *memoryStore) InsertShadow(shadow models.ObjectShadow) (models.ObjectShadow, error) {
+	var inserted models.ObjectShadow
+	err := s.write(func(d *memoryData) (err error) {
+		inserted, err = d.InsertShadow(shadow)
+		return err
+	})
+
+	return inserted, err
+}
+
+func (s *memoryStore) InsertCommit(commit models.ObjectCommit) (models.ObjectCommit, error) {
+	var inserted models.ObjectCommit
+	err := s.write(func(d *memoryData) (err error) {
+		inserted, err = d.InsertCommit(commit)
+		return err
+	})
+
+	return inserted, err
+}
+
+func (s *memoryStore) FindFullObject(commitID int64) (models.FullObject, error) {
+	var full models.FullObject
+	err := s.read(func(d *memoryData) (err error) {
+		full, err = d.FindFullObject(commitID)
+		return err
+	})
+
+	return full, err
+}
+
+func (s *memoryStore) InsertRoot(root models.EntityRoot) (models.EntityRoot, error) {
+	var inserted models.EntityRoot
+	err := s.write(func(d *memoryData) (err error) {
+		inserted, err = d.InsertRoot(root)
+		return err
+	})
+
+	return inserted, err
+}
+
+func (s *memoryStore) FindRoot(id int64) (models.EntityRoot, error) {
+	var root models.EntityRoot
+	err := s.read(func(d *memoryData) (err error) {
+		root, err = d.FindRoot(id)
+		return err
+	})
+
+	return root, err
+}
+
+func (s *memoryStore) InsertVersion(version models.EntityVersion) (models.EntityVersion, error) {
+	var inserted models.EntityVersion
+	err := s.write(func(d *memoryData) (err error) {
+		inserted, err = d.InsertVersion(version)
+		return err
+	})
+
+	return inserted, err
+}
+
+func (s *memoryStore) FindVersion(id int64) (models.EntityVersion, error) {
+	var version models.EntityVersion
+	err := s.read(func(d *memoryData) (err error) {
+		version, err = d.FindVersion(id)
+		return err
+	})
+
+	return version, err
+}
+
+func (s *memoryStore) InsertHead(head models.EntityHead) (models.EntityHead, error) {
+	var inserted models.EntityHead
+	err := s.write(func(d *memoryData) (err error) {
+		inserted, err = d.InsertHead(head)
+		return err
+	})
+
+	return inserted, err
+}
+
+func (s *memoryStore) FindHead(rootID int64, viewID int64) (models.EntityHead, error) {
+	var head models.EntityHead
+	err := s.read(func(d *memoryData) (err error) {
+		head, err = d.FindHead(rootID, viewID)
+		return err
+	})
+
+	return head, err
+}
+
+// FindHeadForUpdate doesn't need to lock anything outside of a transaction,
+// since the head can change as soon as it's returned either way.
+func (s *memoryStore) FindHeadForUpdate(rootID int64, viewID int64) (models.EntityHead, error) {
+	return s.FindHead(rootID, viewID)
+}
+
+func (s *memoryStore) FindHeadsByRelation(viewID int64, versionID int64) ([]models.EntityHead, error) {
+	var heads []models.EntityHead
+	err := s.read(func(d *memoryData) (err error) {
+		heads, err = d.FindHeadsByRelation(viewID, versionID)
+		return err
+	})
+
+	return heads, err
+}
+
+func (s *memoryStore) UpdateHead(head models.EntityHead) (models.EntityHead, error) {
+	var updated models.EntityHead
+	err := s.write(func(d *memoryData) (err error) {
+		updated, err = d.UpdateHead(head)
+		return err
+	})
+
+	return updated, err
+}
+
+func (s *memoryStore) ArchiveHead(head models.EntityHead) (models.EntityHead, error) {
+	var archived models.EntityHead
+	err := s.write(func(d *memoryData) (err error) {
+		archived, err = d.ArchiveHead(head)
+		return err
+	})
+
+	return archived, err
+}
+
+func (s *memoryStore) InsertView(view models.View) (models.View, error) {
+	var inserted models.View
+	err := s.write(func(d *memoryData) (err error) {
+		inserted, err = d.InsertView(view)
+		return err
+	})
+
+	return inserted, err
+}
+
+func (s *memoryStore) FindView(id int64) (models.View, error) {
+	var view models.View
+	err := s.read(func(d *memoryData) (err error) {
+		view, err = d.FindView(id)
+		return err
+	})
+
+	return view, err
+}
+
+func (s *memoryStore) InsertSchema(schema models.EntitySchema) (models.EntitySchema, error) {
+	var inserted models.EntitySchema
+	err := s.write(func(d *memoryData) (err error) {
+		inserted, err = d.InsertSchema(schema)
+		return err
+	})
+
+	return inserted, err
+}
+
+func (s *memoryStore) FindLatestSchema(kind string) (models.EntitySchema, error) {
+	var schema models.EntitySchema
+	err := s.read(func(d *memoryData) (err error) {
+		schema, err = d.FindLatestSchema(kind)
+		return err
+	})
+
+	return schema, err
+}
+
+// memoryTx works on a copy of the data of its Store, which replaces the data
+// of the Store when the transaction is committed. Since transactions are
+// serialized, no other changes can be lost that way.
+type memoryTx struct {
+	*memoryData
+	store *memoryStore
+}
+
+func (t *memoryTx) Commit() error {
+	if t.memoryData == nil {
+		return sql.ErrTxDone
+	}
+
+	t.store.mu.Lock()
+	t.store.data = t.memoryData
+	t.store.mu.Unlock()
+
+	return t.end()
+}
+
+func (t *memoryTx) Rollback() error {
+	if t.memoryData == nil {
+		return sql.ErrTxDone
+	}
+
+	return t.end()
+}
+
+func (t *memoryTx) end() error {
+	t.memoryData = nil
+	t.store.writer.Unlock()
+	return nil
+}
+
+// memoryData holds the records of a memoryStore. Records are copied on their
+// way in and out, so that callers never share maps with the Store. Copies are
+// made by encoding and decoding the same JSON that Postgres stores, so values
+// are read back with the same types as from Postgres.
+type memoryData struct {
+	sequences map[string]int64
+	forms     map[int64]models.ObjectForm
+	shadows   map[int64]models.ObjectShadow
+	commits   map[int64]models.ObjectCommit
+	roots     map[int64]models.EntityRoot
+	versions  map[int64]models.EntityVersion
+	heads     map[int64]models.EntityHead
+	views     map[int64]models.View
+	schemas   map[string][]models.EntitySchema
+}
+
+func newMemoryData() *memoryData {
+	return &memoryData{
+		sequences: map[string]int64{},
+		forms:     map[int64]models.ObjectForm{},
+		shadows:   map[int64]models.ObjectShadow{},
+		commits:   map[int64]models.ObjectCommit{},
+		roots:     map[int64]models.EntityRoot{},
+		versions:  map[int64]models.EntityVersion{},
+		heads:     map[int64]models.EntityHead{},
+		views:     map[int64]models.View{},
+		schemas:   map[string][]models.EntitySchema{},
+	}
+}
+
+// clone copies the maps of records. The records themselves are never
+// modified once they are stored, so they can be shared.
+func (d *memoryData) clone() *memoryData {
+	c := newMemoryData()
+	for name, value := range d.sequences {
+		c.sequences[name] = value
+	}
+	for id, form := range d.forms {
+		c.forms[id] = form
+	}
+	for id, shadow := range d.shadows {
+		c.shadows[id] = shadow
+	}
+	for id, commit := range d.commits {
+		c.commits[id] = commit
+	}
+	for id, root := range d.roots {
+		c.roots[id] = root
+	}
+	for id, version := range d.versions {
+		c.versions[id] = version
+	}
+	for id, head := range d.heads {
+		c.heads[id] = head
+	}
+	for id, view := range d.views {
+		c.views[id] = view
+	}
+	for kind, schemas := range d.schemas {
+		c.schemas[kind] = schemas
+	}
+
+	return c
+}
+
+// nextID advances the sequence of a table and returns its new value.
+func (d *memoryData) nextID(table string) int64 {
+	d.sequences[table]++
+	return d.sequences[table]
+}
+
+func (d *memoryData) InsertForm(form models.ObjectForm) (models.ObjectForm, error) {
+	if err := form.Validate(); err != nil {
+		return models.ObjectForm{}, err
+	} else if form.ID != 0 {
+		return models.ObjectForm{}, fmt.Errorf(errNoInsertHasPrimaryKey, "ObjectForm")
+	}
+
+	for ref, value := range form.Attributes {
+		expected, err := models.AttributeRef(value)
+		if err != nil {
+			return models.ObjectForm{}, err
+		} else if expected != ref {
+			return models.ObjectForm{}, fmt.Errorf("Value with ref %s must be stored under ref %s", ref, expected)
+		}
+	}
+
+	now := now()
+	stored := models.ObjectForm{
+		ID:        d.nextID("object_forms"),
+		Kind:      form.Kind,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if err := copyFormAttributes(form.Attributes, &stored.Attributes); err != nil {
+		return models.ObjectForm{}, err
+	}
+
+	d.forms[stored.ID] = stored
+	return d.findForm(stored.ID)
+}
+
+func (d *memoryData) findForm(id int64) (models.ObjectForm, error) {
+	form, ok := d.forms[id]
+	if !ok {
+		return models.ObjectForm{}, ErrNotFound
+	}
+
+	err := copyFormAttributes(form.Attributes, &form.Attributes)
+	return form, err
+}
+
+func (d *memoryData) InsertShadow(shadow models.ObjectShadow) (models.ObjectShadow, error) {
+	if err := shadow.Validate(); err != nil {
+		return models.ObjectShadow{}, err
+	} else if shadow.ID != 0 {
+		return models.ObjectShadow{}, fmt.Errorf(errNoInsertHasPrimaryKey, "ObjectShadow")
+	} else if _, ok := d.forms[shadow.FormID]; !ok {
+		return models.ObjectShadow{}, fmt.Errorf(errReferenceMustExist, "ObjectForm", shadow.FormID)
+	}
+
+	stored := shadow
+	stored.ID = d.nextID("object_shadows")
+	stored.CreatedAt = now()
+	if err := copyJSON(shadow.Attributes, &stored.Attributes); err != nil {
+		return models.ObjectShadow{}, err
+	}
+
+	d.shadows[stored.ID] = stored
+	return d.findShadow(stored.ID)
+}
+
+func (d *memoryData) findShadow(id int64) (models.ObjectShadow, error) {
+	shadow, ok := d.shadows[id]
+	if !ok {
+		return models.ObjectShadow{}, ErrNotFound
+	}
+
+	err := copyJSON(shadow.Attributes, &shadow.Attributes)
+	return shadow, err
+}
+
+func (d *memoryData) InsertCommit(commit models.ObjectCommit) (models.ObjectCommit, error) {
+	if err := commit.Validate(); err != nil {
+		return models.ObjectCommit{}, err
+	} else if commit.ID != 0 {
+		return models.ObjectCommit{}, fmt.Errorf(errNoInsertHasPrimaryKey, "ObjectCommit")
+	} else if _, ok := d.forms[commit.FormID]; !ok {
+		return models.ObjectCommit{}, fmt.Errorf(errReferenceMustExist, "ObjectForm", commit.FormID)
+	} else if _, ok := d.shadows[commit.ShadowID]; !ok {
+		return models.ObjectCommit{}, fmt.Errorf(errReferenceMustExist, "ObjectShadow", commit.ShadowID)
+	} else if _, ok := d.commits[commit.PreviousID.Int64]; commit.PreviousID.Valid && !ok {
+		return models.ObjectCommit{}, fmt.Errorf(errReferenceMustExist, "ObjectCommit", commit.PreviousID.Int64)
+	}
+
+	stored := commit
+	stored.ID = d.nextID("object_commits")
+	stored.CreatedAt = now()
+
+	d.commits[stored.ID] = stored
+	return stored, nil
+}
+
+func (d *memoryData) FindFullObject(commitID int64) (models.FullObject, error) {
+	if commitID == 0 {
+		return models.FullObject{}, fmt.Errorf(errFieldMustBeGreaterThanZero, "commitID")
+	}
+
+	commit, ok := d.commits[commitID]
+	if !ok {
+		return models.FullObject{}, ErrNotFound
+	}
+
+	form, err := d.findForm(commit.FormID)
+	if err != nil {
+		return models.FullObject{}, err
+	}
+
+	shadow, err := d.findShadow(commit.ShadowID)
+	if err != nil {
+		return models.FullObject{}, err
+	}
+
+	return models.FullObject{Form: form, Shadow: shadow, Commit: commit}, nil
+}
+
+func (d *memoryData) InsertRoot(root models.EntityRoot) (models.EntityRoot, error) {
+	if err := root.Validate(); err != nil {
+		return models.EntityRoot{}, err
+	} else if root.ID != 0 {
+		return models.EntityRoot{}, fmt.Errorf(errNoInsertHasPrimaryKey, "EntityRoot")
+	}
+
+	stored := models.EntityRoot{
+		ID:        d.nextID("entity_roots"),
+		Kind:      strings.ToLower(root.Kind),
+		CreatedAt: now(),
+	}
+
+	d.roots[stored.ID] = stored
+	return stored, nil
+}
+
+func (d *memoryData) FindRoot(id int64) (models.EntityRoot, error) {
+	if id == 0 {
+		return models.EntityRoot{}, fmt.Errorf(errFieldMustBeGreaterThanZero, "id")
+	}
+
+	root, ok := d.roots[id]
+	if !ok {
+		return models.EntityRoot{}, ErrNotFound
+	}
+
+	return root, nil
+}
+
+func (d *memoryData) InsertVersion(version models.EntityVersion) (models.EntityVersion, error) {
+	if err := version.Validate(); err != nil {
+		return models.EntityVersion{}, err
+	} else if version.ID != 0 {
+		return models.EntityVersion{}, fmt.Errorf(errNoInsertHasPrimaryKey, "EntityVersion")
+	} else if _, ok := d.versions[version.ParentID.Int64]; version.ParentID.Valid && !ok {
+		return models.EntityVersion{}, fmt.Errorf(errReferenceMustExist, "EntityVersion", version.ParentID.Int64)
+	} else if _, ok := d.roots[version.RootID]; version.RootID != 0 && !ok {
+		return models.EntityVersion{}, fmt.Errorf(errReferenceMustExist, "EntityRoot", version.RootID)
+	} else if _, ok := d.commits[version.ContentCommitID]; !ok {
+		return models.EntityVersion{}, fmt.Errorf(errReferenceMustExist, "ObjectCommit", version.ContentCommitID)
+	}
+
+	stored := models.EntityVersion{
+		ID:              d.nextID("entity_versions"),
+		ParentID:        version.ParentID,
+		RootID:          version.RootID,
+		Kind:            strings.ToLower(version.Kind),
+		ContentCommitID: version.ContentCommitID,
+		CreatedAt:       now(),
+	}
+
+	if err := copyJSON(&version.Relations, &stored.Relations); err != nil {
+		return models.EntityVersion{}, err
+	}
+
+	d.versions[stored.ID] = stored
+	return d.FindVersion(stored.ID)
+}
+
+func (d *memoryData) FindVersion(id int64) (models.EntityVersion, error) {
+	if id == 0 {
+		return models.EntityVersion{}, fmt.Errorf(errFieldMustBeGreaterThanZero, "id")
+	}
+
+	version, ok := d.versions[id]
+	if !ok {
+		return models.EntityVersion{}, ErrNotFound
+	}
+
+	err := copyJSON(&version.Relations, &version.Relations)
+	return version, err
+}
+
+func (d *memoryData) InsertHead(head models.EntityHead) (models.EntityHead, error) {
+	if err := head.Validate(); err != nil {
+		return models.EntityHead{}, err
+	} else if head.ID != 0 {
+		return models.EntityHead{}, fmt.Errorf(errNoInsertHasPrimaryKey, "EntityHead")
+	} else if _, ok := d.roots[head.RootID]; !ok {
+		return models.EntityHead{}, fmt.Errorf(errReferenceMustExist, "EntityRoot", head.RootID)
+	} else if _, ok := d.views[head.ViewID]; !ok {
+		return models.EntityHead{}, fmt.Errorf(errReferenceMustExist, "View", head.ViewID)
+	} else if _, ok := d.versions[head.VersionID]; !ok {
+		return models.EntityHead{}, fmt.Errorf(errReferenceMustExist, "EntityVersion", head.VersionID)
+	}
+
+	now := now()
+	stored := models.EntityHead{
+		ID:        d.nextID("entity_heads"),
+		RootID:    head.RootID,
+		ViewID:    head.ViewID,
+		VersionID: head.VersionID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	d.heads[stored.ID] = stored
+	return stored, nil
+}
+
+func (d *memoryData) FindHead(rootID int64, viewID int64) (models.EntityHead, error) {
+	if rootID == 0 {
+		return models.EntityHead{}, fmt.Errorf(errFieldMustBeGreaterThanZero, "rootID")
+	} else if viewID == 0 {
+		return models.EntityHead{}, fmt.Errorf(errFieldMustBeGreaterThanZero, "viewID")
+	}
+
+	for _, head := range d.sortedHeads() {
+		if head.RootID == rootID && head.ViewID == viewID && head.ArchivedAt == nil {
+			return head, nil
+		}
+	}
+
+	return models.EntityHead{}, ErrNotFound
+}
+
+// FindHeadForUpdate doesn't need to lock the head, since no other transaction
+// can run until this one ends.
+func (d *memoryData) FindHeadForUpdate(rootID int64, viewID int64) (models.EntityHead, error) {
+	return d.FindHead(rootID, viewID)
+}
+
+func (d *memoryData) FindHeadsByRelation(viewID int64, versionID int64) ([]models.EntityHead, error) {
+	if viewID == 0 {
+		return nil, fmt.Errorf(errFieldMustBeGreaterThanZero, "viewID")
+	} else if versionID == 0 {
+		return nil, fmt.Errorf(errFieldMustBeGreaterThanZero, "versionID")
+	}
+
+	heads := []models.EntityHead{}
+	for _, head := range d.sortedHeads() {
+		if head.ViewID != viewID || head.ArchivedAt != nil {
+			continue
+		}
+
+		if relatesTo(d.versions[head.VersionID].Relations, versionID) {
+			heads = append(heads, head)
+		}
+	}
+
+	return heads, nil
+}
+
+func (d *memoryData) UpdateHead(head models.EntityHead) (models.EntityHead, error) {
+	if err := head.Validate(); err != nil {
+		return models.EntityHead{}, err
+	} else if head.ID == 0 {
+		return models.EntityHead{}, fmt.Errorf(errFieldMustBeGreaterThanZero, "ID")
+	}
+
+	stored, ok := d.heads[head.ID]
+	if !ok || stored.ArchivedAt != nil {
+		return models.EntityHead{}, ErrNotFound
+	} else if _, ok := d.versions[head.VersionID]; !ok {
+		return models.EntityHead{}, fmt.Errorf(errReferenceMustExist, "EntityVersion", head.VersionID)
+	}
+
+	stored.VersionID = head.VersionID
+	stored.UpdatedAt = now()
+
+	d.heads[stored.ID] = stored
+	return stored, nil
+}
+
+func (d *memoryData) ArchiveHead(head models.EntityHead) (models.EntityHead, error) {
+	if head.ID == 0 {
+		return models.EntityHead{}, fmt.Errorf(errFieldMustBeGreaterThanZero, "ID")
+	}
+
+	stored, ok := d.heads[head.ID]
+	if !ok || stored.ArchivedAt != nil {
+		return models.EntityHead{}, ErrNotFound
+	}
+
+	archivedAt := now()
+	stored.ArchivedAt = &archivedAt
+
+	d.heads[stored.ID] = stored
+	return stored, nil
+}
+
+// sortedHeads lists every head ordered by ID.
+func (d *memoryData) sortedHeads() []models.EntityHead {
+	heads := make([]models.EntityHead, 0, len(d.heads))
+	for _, head := range d.heads {
+		heads = append(heads, head)
+	}
+
+	sort.Slice(heads, func(i, j int) bool {
+		return heads[i].ID < heads[j].ID
+	})
+
+	return heads
+}
+
+func (d *memoryData) InsertView(view models.View) (models.View, error) {
+	if err := view.Validate(); err != nil {
+		return models.View{}, err
+	} else if view.ID != 0 {
+		return models.View{}, fmt.Errorf(errNoInsertHasPrimaryKey, "View")
+	}
+
+	now := now()
+	stored := models.View{
+		ID:        d.nextID("views"),
+		Name:      view.Name,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if err := copyJSON(view.Attributes, &stored.Attributes); err != nil {
+		return models.View{}, err
+	}
+
+	d.views[stored.ID] = stored
+	return d.FindView(stored.ID)
+}
+
+func (d *memoryData) FindView(id int64) (models.View, error) {
+	if id == 0 {
+		return models.View{}, fmt.Errorf(errFieldMustBeGreaterThanZero, "id")
+	}
+
+	view, ok := d.views[id]
+	if !ok {
+		return models.View{}, ErrNotFound
+	}
+
+	err := copyJSON(view.Attributes, &view.Attributes)
+	return view, err
+}
+
+func (d *memoryData) InsertSchema(schema models.EntitySchema) (models.EntitySchema, error) {
+	if err := schema.Validate(); err != nil {
+		return models.EntitySchema{}, err
+	} else if schema.ID != 0 {
+		return models.EntitySchema{}, fmt.Errorf(errNoInsertHasPrimaryKey, "EntitySchema")
+	} else if !json.Valid(schema.Definition) {
+		return models.EntitySchema{}, errors.New("Definition must be valid JSON")
+	}
+
+	versions := d.schemas[schema.Kind]
+	stored := models.EntitySchema{
+		ID:         d.nextID("entity_schemas"),
+		Kind:       schema.Kind,
+		Version:    len(versions) + 1,
+		Definition: append(json.RawMessage{}, schema.Definition...),
+		CreatedAt:  now(),
+	}
+
+	// The slice is copied so that a clone that shares it doesn't see the new
+	// version.
+	d.schemas[schema.Kind] = append(append([]models.EntitySchema{}, versions...), stored)
+	return d.FindLatestSchema(schema.Kind)
+}
+
+func (d *memoryData) FindLatestSchema(kind string) (models.EntitySchema, error) {
+	if kind == "" {
+		return models.EntitySchema{}, fmt.Errorf(errFieldMustBeNonEmpty, "kind")
+	}
+
+	versions := d.schemas[kind]
+	if len(versions) == 0 {
+		return models.EntitySchema{}, ErrNotFound
+	}
+
+	schema := versions[len(versions)-1]
+	schema.Definition = append(json.RawMessage{}, schema.Definition...)
+	return schema, nil
+}
+
+// relatesTo determines whether any edge of the relations links to a version.
+func relatesTo(relations models.EntityRelations, versionID int64) bool {
+	for _, edges := range relations {
+		for _, edge := range edges {
+			if edge.ID == versionID {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// copyFormAttributes copies attributes like copyJSON. Forms always have
+// attributes, even if they were inserted without any.
+func copyFormAttributes(attributes models.ObjectFormAttributes, out *models.ObjectFormAttributes) error {
+	if attributes == nil {
+		attributes = models.ObjectFormAttributes{}
+	}
+
+	return copyJSON(attributes, out)
+}
+
+// copyJSON copies a value by encoding it to the JSON that is stored in the
+// database and scanning it back.
+func copyJSON(value driver.Valuer, out sql.Scanner) error {
+	encoded, err := value.Value()
+	if err != nil {
+		return err
+	}
+
+	return out.Scan(encoded)
+}
+
+// now is the time that records are created or updated at. Postgres stores
+// timestamps in UTC with microsecond precision.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
@@ -0,0 +1,151 @@
+package store
+
+import (
+	"database/sql"
+
+	"github.com/jmataya/gizmo/common"
+	"github.com/jmataya/gizmo/models"
+)
+
+// NewPostgresStore creates a Store that keeps Entities in a Postgres database
+// with the schema in the sql directory. The Store prepares each query once
+// and reuses the statement until the Store is closed, so create a single Store
+// for a database rather than one per request. The Store implements io.Closer.
+func NewPostgresStore(db *sql.DB) Store {
+	cache := common.NewStmtCache(db)
+	return &postgresStore{postgresQueries: postgresQueries{db: cache}, db: db, cache: cache}
+}
+
+type postgresStore struct {
+	postgresQueries
+	db    *sql.DB
+	cache *common.StmtCache
+}
+
+// Close closes the statements that the Store has prepared, but not the
+// database.
+func (s *postgresStore) Close() error {
+	return s.cache.Close()
+}
+
+func (s *postgresStore) Begin() (Tx, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	cache := s.cache.Tx(tx)
+	return &postgresTx{postgresQueries: postgresQueries{db: cache}, tx: tx, cache: cache}, nil
+}
+
+type postgresTx struct {
+	postgresQueries
+	tx    *sql.Tx
+	cache *common.TxStmtCache
+}
+
+func (t *postgresTx) Commit() error {
+	defer t.cache.Done()
+	return t.tx.Commit()
+}
+
+func (t *postgresTx) Rollback() error {
+	defer t.cache.Done()
+	return t.tx.Rollback()
+}
+
+// postgresQueries runs the queries of the models package against either the
+// database or a transaction.
+type postgresQueries struct {
+	db common.DB
+}
+
+func (q postgresQueries) InsertForm(form models.ObjectForm) (models.ObjectForm, error) {
+	return form.Insert(q.db)
+}
+
+func (q postgresQueries) InsertShadow(shadow models.ObjectShadow) (models.ObjectShadow, error) {
+	return shadow.Insert(q.db)
+}
+
+func (q postgresQueries) InsertCommit(commit models.ObjectCommit) (models.ObjectCommit, error) {
+	return commit.Insert(q.db)
+}
+
+func (q postgresQueries) FindFullObject(commitID int64) (models.FullObject, error) {
+	full, err := models.FullObject{}.Find(q.db, commitID)
+	return full, notFound(err)
+}
+
+func (q postgresQueries) InsertRoot(root models.EntityRoot) (models.EntityRoot, error) {
+	return root.Insert(q.db)
+}
+
+func (q postgresQueries) FindRoot(id int64) (models.EntityRoot, error) {
+	root, err := models.FindEntityRoot(q.db, id)
+	return root, notFound(err)
+}
+
+func (q postgresQueries) InsertVersion(version models.EntityVersion) (models.EntityVersion, error) {
+	return version.Insert(q.db)
+}
+
+func (q postgresQueries) FindVersion(id int64) (models.EntityVersion, error) {
+	version, err := models.FindEntityVersion(q.db, id)
+	return version, notFound(err)
+}
+
+func (q postgresQueries) InsertHead(head models.EntityHead) (models.EntityHead, error) {
+	return head.Insert(q.db)
+}
+
+func (q postgresQueries) FindHead(rootID int64, viewID int64) (models.EntityHead, error) {
+	head, err := models.FindEntityHead(q.db, rootID, viewID)
+	return head, notFound(err)
+}
+
+func (q postgresQueries) FindHeadForUpdate(rootID int64, viewID int64) (models.EntityHead, error) {
+	head, err := models.FindEntityHeadForUpdate(q.db, rootID, viewID)
+	return head, notFound(err)
+}
+
+func (q postgresQueries) FindHeadsByRelation(viewID int64, versionID int64) ([]models.EntityHead, error) {
+	return models.FindEntityHeadsByRelation(q.db, viewID, versionID)
+}
+
+func (q postgresQueries) UpdateHead(head models.EntityHead) (models.EntityHead, error) {
+	updated, err := head.Update(q.db)
+	return updated, notFound(err)
+}
+
+func (q postgresQueries) ArchiveHead(head models.EntityHead) (models.EntityHead, error) {
+	archived, err := head.Archive(q.db)
+	return archived, notFound(err)
+}
+
+func (q postgresQueries) InsertView(view models.View) (models.View, error) {
+	return view.Insert(q.db)
+}
+
+func (q postgresQueries) FindView(id int64) (models.View, error) {
+	view, err := models.FindView(q.db, id)
+	return view, notFound(err)
+}
+
+func (q postgresQueries) InsertSchema(schema models.EntitySchema) (models.EntitySchema, error) {
+	return schema.Insert(q.db)
+}
+
+func (q postgresQueries) FindLatestSchema(kind string) (models.EntitySchema, error) {
+	schema, err := models.FindLatestEntitySchema(q.db, kind)
+	return schema, notFound(err)
+}
+
+// notFound translates the error for a missing row into ErrNotFound.
+func notFound(err error) error {
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+
+	return err
+}
@@ -0,0 +1,113 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/jmataya/gizmo/models"
+	"github.com/jmataya/gizmo/testutils"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestPostgresStore(t *testing.T) {
+	assert := testutils.NewAssert(t)
+	db := testutils.InitDB(t)
+	defer db.Close()
+
+	view := models.CreateView(t, db)
+
+	s := NewPostgresStore(db)
+	tx, err := s.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	form := models.NewObjectForm("product")
+	ref, err := form.AddAttribute("Fox Socks")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shadow := models.NewObjectShadow()
+	if err := shadow.AddAttribute("title", "string", ref); err != nil {
+		t.Fatal(err)
+	}
+
+	full, err := InsertFullObject(log.StandardLogger(), tx, models.FullObject{Form: *form, Shadow: *shadow})
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(err)
+	}
+
+	root, err := tx.InsertRoot(models.EntityRoot{Kind: "product"})
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(err)
+	}
+
+	version, err := tx.InsertVersion(models.EntityVersion{
+		RootID:          root.ID,
+		ContentCommitID: full.Commit.ID,
+		Kind:            "product",
+		Relations:       models.EntityRelations{},
+	})
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(err)
+	}
+
+	head, err := tx.InsertHead(models.EntityHead{RootID: root.ID, ViewID: view.ID, VersionID: version.ID})
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := s.FindHead(root.ID, view.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(head.ID, found.ID)
+	assert.Equal(version.ID, found.VersionID)
+
+	foundFull, err := s.FindFullObject(version.ContentCommitID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(full.Form.ID, foundFull.Form.ID)
+
+	if _, err := s.ArchiveHead(found); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.FindHead(root.ID, view.ID); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound for an archived head, got %v", err)
+	}
+}
+
+func TestPostgresStore_Rollback(t *testing.T) {
+	db := testutils.InitDB(t)
+	defer db.Close()
+
+	s := NewPostgresStore(db)
+	tx, err := s.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := tx.InsertRoot(models.EntityRoot{Kind: "product"})
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(err)
+	}
+
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.FindRoot(root.ID); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound for a rolled back root, got %v", err)
+	}
+}
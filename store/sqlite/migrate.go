@@ -0,0 +1,126 @@
+package sqlite
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	sqlCreateSchemaVersion = `
+		CREATE TABLE IF NOT EXISTS schema_version (
+			version integer primary key,
+			name text not null,
+			applied_at timestamp not null default (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+		)
+	`
+
+	sqlSelectSchemaVersion = "SELECT COALESCE(MAX(version), 0) FROM schema_version"
+	sqlInsertSchemaVersion = "INSERT INTO schema_version (version, name) VALUES (?, ?)"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migration is a file in the migrations directory. Files are named
+// V<version>__<name>.sql, and are applied in the order of their versions.
+type migration struct {
+	version int
+	name    string
+	file    string
+}
+
+// Migrate creates or upgrades the schema of a SQLite database. The version of
+// the schema is recorded in the schema_version table, so only migrations that
+// haven't been applied yet are run. All of them are applied in a single
+// transaction, which keeps concurrent runners from applying them twice.
+func Migrate(db *sql.DB) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := migrate(tx, migrations); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func migrate(tx *sql.Tx, migrations []migration) error {
+	if _, err := tx.Exec(sqlCreateSchemaVersion); err != nil {
+		return err
+	}
+
+	var current int
+	if err := tx.QueryRow(sqlSelectSchemaVersion).Scan(&current); err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+
+		script, err := migrationFiles.ReadFile(m.file)
+		if err != nil {
+			return err
+		}
+
+		log.Debugf("Applying SQLite migration %d (%s)", m.version, m.name)
+		if _, err := tx.Exec(string(script)); err != nil {
+			return fmt.Errorf("Unable to apply migration %s: %s", m.file, err.Error())
+		}
+
+		if _, err := tx.Exec(sqlInsertSchemaVersion, m.version, m.name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func loadMigrations() ([]migration, error) {
+	files, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := []migration{}
+	for _, file := range files {
+		name := strings.TrimSuffix(file.Name(), ".sql")
+		parts := strings.SplitN(strings.TrimPrefix(name, "V"), "__", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Migration %s must be named V<version>__<name>.sql", file.Name())
+		}
+
+		version, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("Migration %s must be named V<version>__<name>.sql", file.Name())
+		}
+
+		migrations = append(migrations, migration{
+			version: version,
+			name:    parts[1],
+			file:    path.Join("migrations", file.Name()),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+
+	return migrations, nil
+}
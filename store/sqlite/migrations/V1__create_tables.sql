@@ -0,0 +1,101 @@
+-- The schema mirrors the Postgres schema in the sql directory. JSON is stored
+-- as text and queried with the JSON1 functions, and timestamps are stored in
+-- UTC with millisecond precision.
+
+create table views (
+  id integer primary key,
+  name text not null check (length(name) <= 255),
+  attributes text check (attributes is null or json_valid(attributes)),
+
+  created_at timestamp not null default (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  updated_at timestamp not null default (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
+
+create table object_values (
+  ref text primary key,
+  value text not null check (json_valid(value)),
+
+  created_at timestamp not null default (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
+
+create table object_forms (
+  id integer primary key,
+  kind text not null check (length(kind) <= 255),
+  refs text not null default '[]' check (json_valid(refs)),
+
+  created_at timestamp not null default (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  updated_at timestamp not null default (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
+
+create index object_forms_kind_idx on object_forms (kind);
+
+create table object_shadows (
+  id integer primary key,
+  form_id integer not null references object_forms(id) on update restrict on delete restrict,
+  attributes text check (attributes is null or json_valid(attributes)),
+  revision integer not null default 0,
+
+  created_at timestamp not null default (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
+
+create index object_shadows_object_form_idx on object_shadows (form_id);
+
+create table object_commits (
+  id integer primary key,
+  form_id integer not null references object_forms(id) on update restrict on delete restrict,
+  shadow_id integer not null references object_shadows(id) on update restrict on delete restrict,
+  previous_id integer null references object_commits(id) on update restrict on delete restrict,
+
+  created_at timestamp not null default (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
+
+create index object_commits_object_form_idx on object_commits (form_id);
+create index object_commits_object_shadow_idx on object_commits (shadow_id);
+
+create table entity_roots (
+  id integer primary key,
+  kind text not null check (length(kind) <= 255),
+
+  created_at timestamp not null default (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  archived_at timestamp null
+);
+
+create index entity_roots_kind_idx on entity_roots (kind);
+
+create table entity_versions (
+  id integer primary key,
+  parent_id integer null references entity_versions(id) on update restrict on delete restrict,
+  root_id integer null references entity_roots(id) on update restrict on delete restrict,
+  kind text not null check (length(kind) <= 255),
+  content_commit_id integer not null references object_commits(id) on update restrict on delete restrict,
+  relations text not null default '{}' check (json_valid(relations)),
+
+  created_at timestamp not null default (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
+
+create index entity_versions_root_idx on entity_versions (root_id);
+
+create table entity_heads (
+  id integer primary key,
+  root_id integer not null references entity_roots(id) on update restrict on delete restrict,
+  view_id integer not null references views(id) on update restrict on delete restrict,
+  version_id integer not null references entity_versions(id) on update restrict on delete restrict,
+
+  created_at timestamp not null default (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  updated_at timestamp not null default (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  archived_at timestamp null
+);
+
+create index entity_heads_view_idx on entity_heads (view_id);
+create index entity_heads_root_view_idx on entity_heads (root_id, view_id);
+
+create table entity_schemas (
+  id integer primary key,
+  kind text not null check (length(kind) <= 255),
+  version integer not null,
+  definition text not null check (json_valid(definition)),
+
+  created_at timestamp not null default (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+
+  unique (kind, version)
+);
@@ -0,0 +1,574 @@
+package sqlite
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jmataya/gizmo/common"
+	"github.com/jmataya/gizmo/dal"
+	"github.com/jmataya/gizmo/models"
+	"github.com/jmataya/gizmo/store"
+)
+
+const (
+	sqlNow = "strftime('%Y-%m-%d %H:%M:%f', 'now')"
+
+	sqlInsertObjectValue = "INSERT INTO object_values (ref, value) VALUES (?, ?) ON CONFLICT (ref) DO NOTHING"
+	sqlInsertObjectForm  = "INSERT INTO object_forms (kind, refs) VALUES (?, ?)"
+
+	// sqlSelectObjectForm reassembles the attributes of a form from the
+	// shared values that it refers to.
+	sqlSelectObjectForm = `
+		SELECT f.id, f.kind, (
+			SELECT json_group_object(v.ref, json(v.value))
+			FROM object_values AS v
+			WHERE v.ref IN (SELECT value FROM json_each(f.refs))
+		), f.created_at, f.updated_at
+		FROM object_forms AS f
+		WHERE f.id = ?
+	`
+
+	sqlInsertObjectShadow = "INSERT INTO object_shadows (form_id, attributes, revision) VALUES (?, ?, ?)"
+	sqlSelectObjectShadow = "SELECT id, form_id, attributes, revision, created_at FROM object_shadows WHERE id = ?"
+
+	sqlInsertObjectCommit = "INSERT INTO object_commits (form_id, shadow_id, previous_id) VALUES (?, ?, ?)"
+	sqlSelectObjectCommit = "SELECT id, form_id, shadow_id, previous_id, created_at FROM object_commits WHERE id = ?"
+
+	sqlInsertEntityRoot = "INSERT INTO entity_roots (kind) VALUES (?)"
+	sqlSelectEntityRoot = "SELECT id, kind, created_at, archived_at FROM entity_roots WHERE id = ?"
+
+	sqlInsertEntityVersion = `
+		INSERT INTO entity_versions (parent_id, root_id, kind, content_commit_id, relations)
+		VALUES (?, ?, ?, ?, ?)
+	`
+	sqlSelectEntityVersion = `
+		SELECT id, parent_id, COALESCE(root_id, 0), kind, content_commit_id, relations, created_at
+		FROM entity_versions
+		WHERE id = ?
+	`
+
+	sqlEntityHeadColumns = "h.id, h.root_id, h.view_id, h.version_id, h.created_at, h.updated_at, h.archived_at"
+
+	sqlInsertEntityHead = "INSERT INTO entity_heads (root_id, view_id, version_id) VALUES (?, ?, ?)"
+	sqlSelectEntityHead = "SELECT " + sqlEntityHeadColumns + " FROM entity_heads AS h WHERE h.id = ?"
+
+	sqlSelectLiveEntityHead = `
+		SELECT ` + sqlEntityHeadColumns + `
+		FROM entity_heads AS h
+		WHERE h.root_id = ? AND h.view_id = ? AND h.archived_at IS NULL
+		ORDER BY h.id
+		LIMIT 1
+	`
+
+	sqlSelectEntityHeadsByRelation = `
+		SELECT ` + sqlEntityHeadColumns + `
+		FROM entity_heads AS h
+		INNER JOIN entity_versions AS v ON h.version_id = v.id
+		WHERE h.view_id = ? AND h.archived_at IS NULL AND EXISTS (
+			SELECT 1 FROM json_each(v.relations) AS r, json_each(r.value) AS e
+			WHERE e.type = 'object' AND json_extract(e.value, '$.id') = ?
+		)
+		ORDER BY h.id
+	`
+
+	sqlUpdateEntityHead  = "UPDATE entity_heads SET version_id = ?, updated_at = " + sqlNow + " WHERE id = ? AND archived_at IS NULL"
+	sqlArchiveEntityHead = "UPDATE entity_heads SET archived_at = " + sqlNow + " WHERE id = ? AND archived_at IS NULL"
+
+	sqlInsertView = "INSERT INTO views (name, attributes) VALUES (?, ?)"
+	sqlSelectView = "SELECT id, name, attributes, created_at, updated_at FROM views WHERE id = ?"
+
+	sqlInsertEntitySchema = `
+		INSERT INTO entity_schemas (kind, version, definition)
+		SELECT ?1, COALESCE(MAX(version), 0) + 1, ?2
+		FROM entity_schemas
+		WHERE kind = ?1
+	`
+	sqlSelectEntitySchema = "SELECT id, kind, version, definition, created_at FROM entity_schemas WHERE id = ?"
+
+	sqlSelectLatestEntitySchema = `
+		SELECT id, kind, version, definition, created_at
+		FROM entity_schemas
+		WHERE kind = ?
+		ORDER BY version DESC
+		LIMIT 1
+	`
+)
+
+const (
+	// General error messages.
+	errNoInsertHasPrimaryKey = "%s has a primary key and cannot be inserted"
+
+	// Query error messages.
+	errFieldMustBeGreaterThanZero = "%s must be greater than zero"
+	errFieldMustBeNonEmpty        = "%s must be non-empty"
+)
+
+// queries runs the queries of a Store against either the database or a
+// transaction. Every statement is closed once it has been used.
+type queries struct {
+	db common.DB
+}
+
+func (q queries) InsertForm(form models.ObjectForm) (models.ObjectForm, error) {
+	if err := form.Validate(); err != nil {
+		return models.ObjectForm{}, err
+	} else if form.ID != 0 {
+		return models.ObjectForm{}, fmt.Errorf(errNoInsertHasPrimaryKey, "ObjectForm")
+	}
+
+	refs := make([]string, 0, len(form.Attributes))
+	for ref := range form.Attributes {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+
+	for _, ref := range refs {
+		value := form.Attributes[ref]
+
+		expected, err := models.AttributeRef(value)
+		if err != nil {
+			return models.ObjectForm{}, err
+		} else if expected != ref {
+			return models.ObjectForm{}, fmt.Errorf("Value with ref %s must be stored under ref %s", ref, expected)
+		}
+
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return models.ObjectForm{}, err
+		}
+
+		if _, err := q.exec(sqlInsertObjectValue, ref, string(encoded)); err != nil {
+			return models.ObjectForm{}, err
+		}
+	}
+
+	encodedRefs, err := json.Marshal(refs)
+	if err != nil {
+		return models.ObjectForm{}, err
+	}
+
+	id, err := q.insert(sqlInsertObjectForm, form.Kind, string(encodedRefs))
+	if err != nil {
+		return models.ObjectForm{}, err
+	}
+
+	return q.findForm(id)
+}
+
+func (q queries) findForm(id int64) (models.ObjectForm, error) {
+	var form models.ObjectForm
+	var attributes []byte
+
+	err := q.queryRow(sqlSelectObjectForm, []interface{}{id},
+		&form.ID, &form.Kind, &attributes, &form.CreatedAt, &form.UpdatedAt)
+	if err != nil {
+		return form, err
+	}
+
+	if attributes == nil {
+		attributes = []byte("{}")
+	}
+
+	err = form.Attributes.Scan(attributes)
+	return form, err
+}
+
+func (q queries) InsertShadow(shadow models.ObjectShadow) (models.ObjectShadow, error) {
+	if err := shadow.Validate(); err != nil {
+		return models.ObjectShadow{}, err
+	} else if shadow.ID != 0 {
+		return models.ObjectShadow{}, fmt.Errorf(errNoInsertHasPrimaryKey, "ObjectShadow")
+	}
+
+	attributes, err := jsonText(shadow.Attributes)
+	if err != nil {
+		return models.ObjectShadow{}, err
+	}
+
+	id, err := q.insert(sqlInsertObjectShadow, shadow.FormID, attributes, shadow.Revision)
+	if err != nil {
+		return models.ObjectShadow{}, err
+	}
+
+	return q.findShadow(id)
+}
+
+func (q queries) findShadow(id int64) (models.ObjectShadow, error) {
+	var shadow models.ObjectShadow
+	var attributes []byte
+
+	err := q.queryRow(sqlSelectObjectShadow, []interface{}{id},
+		&shadow.ID, &shadow.FormID, &attributes, &shadow.Revision, &shadow.CreatedAt)
+	if err != nil {
+		return shadow, err
+	}
+
+	err = shadow.Attributes.Scan(attributes)
+	return shadow, err
+}
+
+func (q queries) InsertCommit(commit models.ObjectCommit) (models.ObjectCommit, error) {
+	if err := commit.Validate(); err != nil {
+		return models.ObjectCommit{}, err
+	} else if commit.ID != 0 {
+		return models.ObjectCommit{}, fmt.Errorf(errNoInsertHasPrimaryKey, "ObjectCommit")
+	}
+
+	id, err := q.insert(sqlInsertObjectCommit, commit.FormID, commit.ShadowID, commit.PreviousID)
+	if err != nil {
+		return models.ObjectCommit{}, err
+	}
+
+	return q.findCommit(id)
+}
+
+func (q queries) findCommit(id int64) (models.ObjectCommit, error) {
+	var commit models.ObjectCommit
+	err := q.queryRow(sqlSelectObjectCommit, []interface{}{id},
+		&commit.ID, &commit.FormID, &commit.ShadowID, &commit.PreviousID, &commit.CreatedAt)
+
+	return commit, err
+}
+
+func (q queries) FindFullObject(commitID int64) (models.FullObject, error) {
+	if commitID == 0 {
+		return models.FullObject{}, fmt.Errorf(errFieldMustBeGreaterThanZero, "commitID")
+	}
+
+	commit, err := q.findCommit(commitID)
+	if err != nil {
+		return models.FullObject{}, err
+	}
+
+	form, err := q.findForm(commit.FormID)
+	if err != nil {
+		return models.FullObject{}, err
+	}
+
+	shadow, err := q.findShadow(commit.ShadowID)
+	if err != nil {
+		return models.FullObject{}, err
+	}
+
+	return models.FullObject{Form: form, Shadow: shadow, Commit: commit}, nil
+}
+
+func (q queries) InsertRoot(root models.EntityRoot) (models.EntityRoot, error) {
+	if err := root.Validate(); err != nil {
+		return models.EntityRoot{}, err
+	} else if root.ID != 0 {
+		return models.EntityRoot{}, fmt.Errorf(errNoInsertHasPrimaryKey, "EntityRoot")
+	}
+
+	id, err := q.insert(sqlInsertEntityRoot, strings.ToLower(root.Kind))
+	if err != nil {
+		return models.EntityRoot{}, err
+	}
+
+	return q.FindRoot(id)
+}
+
+func (q queries) FindRoot(id int64) (models.EntityRoot, error) {
+	var root models.EntityRoot
+	if id == 0 {
+		return root, fmt.Errorf(errFieldMustBeGreaterThanZero, "id")
+	}
+
+	err := q.queryRow(sqlSelectEntityRoot, []interface{}{id},
+		&root.ID, &root.Kind, &root.CreatedAt, &root.ArchivedAt)
+
+	return root, err
+}
+
+func (q queries) InsertVersion(version models.EntityVersion) (models.EntityVersion, error) {
+	if err := version.Validate(); err != nil {
+		return models.EntityVersion{}, err
+	} else if version.ID != 0 {
+		return models.EntityVersion{}, fmt.Errorf(errNoInsertHasPrimaryKey, "EntityVersion")
+	}
+
+	var rootID sql.NullInt64
+	if version.RootID != 0 {
+		rootID = sql.NullInt64{Int64: version.RootID, Valid: true}
+	}
+
+	relations, err := jsonText(&version.Relations)
+	if err != nil {
+		return models.EntityVersion{}, err
+	}
+
+	id, err := q.insert(sqlInsertEntityVersion,
+		version.ParentID,
+		rootID,
+		strings.ToLower(version.Kind),
+		version.ContentCommitID,
+		relations)
+	if err != nil {
+		return models.EntityVersion{}, err
+	}
+
+	return q.FindVersion(id)
+}
+
+func (q queries) FindVersion(id int64) (models.EntityVersion, error) {
+	var version models.EntityVersion
+	if id == 0 {
+		return version, fmt.Errorf(errFieldMustBeGreaterThanZero, "id")
+	}
+
+	var relations []byte
+	err := q.queryRow(sqlSelectEntityVersion, []interface{}{id},
+		&version.ID,
+		&version.ParentID,
+		&version.RootID,
+		&version.Kind,
+		&version.ContentCommitID,
+		&relations,
+		&version.CreatedAt)
+	if err != nil {
+		return version, err
+	}
+
+	err = version.Relations.Scan(relations)
+	return version, err
+}
+
+func (q queries) InsertHead(head models.EntityHead) (models.EntityHead, error) {
+	if err := head.Validate(); err != nil {
+		return models.EntityHead{}, err
+	} else if head.ID != 0 {
+		return models.EntityHead{}, fmt.Errorf(errNoInsertHasPrimaryKey, "EntityHead")
+	}
+
+	id, err := q.insert(sqlInsertEntityHead, head.RootID, head.ViewID, head.VersionID)
+	if err != nil {
+		return models.EntityHead{}, err
+	}
+
+	return q.findHead(sqlSelectEntityHead, id)
+}
+
+func (q queries) FindHead(rootID int64, viewID int64) (models.EntityHead, error) {
+	if rootID == 0 {
+		return models.EntityHead{}, fmt.Errorf(errFieldMustBeGreaterThanZero, "rootID")
+	} else if viewID == 0 {
+		return models.EntityHead{}, fmt.Errorf(errFieldMustBeGreaterThanZero, "viewID")
+	}
+
+	return q.findHead(sqlSelectLiveEntityHead, rootID, viewID)
+}
+
+// FindHeadForUpdate doesn't need to lock the head, since transactions of
+// databases opened with Open hold the write lock of the whole database.
+func (q queries) FindHeadForUpdate(rootID int64, viewID int64) (models.EntityHead, error) {
+	return q.FindHead(rootID, viewID)
+}
+
+func (q queries) FindHeadsByRelation(viewID int64, versionID int64) ([]models.EntityHead, error) {
+	if viewID == 0 {
+		return nil, fmt.Errorf(errFieldMustBeGreaterThanZero, "viewID")
+	} else if versionID == 0 {
+		return nil, fmt.Errorf(errFieldMustBeGreaterThanZero, "versionID")
+	}
+
+	heads := []models.EntityHead{}
+
+	d := dal.NewDataAccessLayer(q.db)
+	d.ScanRows(d.Query(sqlSelectEntityHeadsByRelation, viewID, versionID), func(row dal.Scanner) error {
+		var head models.EntityHead
+		if err := row.Scan(headColumns(&head)...); err != nil {
+			return err
+		}
+
+		heads = append(heads, head)
+		return nil
+	})
+
+	if err := d.Result(); err != nil {
+		return nil, err
+	}
+
+	return heads, nil
+}
+
+func (q queries) UpdateHead(head models.EntityHead) (models.EntityHead, error) {
+	if err := head.Validate(); err != nil {
+		return models.EntityHead{}, err
+	} else if head.ID == 0 {
+		return models.EntityHead{}, fmt.Errorf(errFieldMustBeGreaterThanZero, "ID")
+	}
+
+	if err := q.update(sqlUpdateEntityHead, head.VersionID, head.ID); err != nil {
+		return models.EntityHead{}, err
+	}
+
+	return q.findHead(sqlSelectEntityHead, head.ID)
+}
+
+func (q queries) ArchiveHead(head models.EntityHead) (models.EntityHead, error) {
+	if head.ID == 0 {
+		return models.EntityHead{}, fmt.Errorf(errFieldMustBeGreaterThanZero, "ID")
+	}
+
+	if err := q.update(sqlArchiveEntityHead, head.ID); err != nil {
+		return models.EntityHead{}, err
+	}
+
+	return q.findHead(sqlSelectEntityHead, head.ID)
+}
+
+func (q queries) findHead(query string, args ...interface{}) (models.EntityHead, error) {
+	var head models.EntityHead
+	err := q.queryRow(query, args, headColumns(&head)...)
+	return head, err
+}
+
+func headColumns(head *models.EntityHead) []interface{} {
+	return []interface{}{
+		&head.ID,
+		&head.RootID,
+		&head.ViewID,
+		&head.VersionID,
+		&head.CreatedAt,
+		&head.UpdatedAt,
+		&head.ArchivedAt,
+	}
+}
+
+func (q queries) InsertView(view models.View) (models.View, error) {
+	if err := view.Validate(); err != nil {
+		return models.View{}, err
+	} else if view.ID != 0 {
+		return models.View{}, fmt.Errorf(errNoInsertHasPrimaryKey, "View")
+	}
+
+	attributes, err := jsonText(view.Attributes)
+	if err != nil {
+		return models.View{}, err
+	}
+
+	id, err := q.insert(sqlInsertView, view.Name, attributes)
+	if err != nil {
+		return models.View{}, err
+	}
+
+	return q.FindView(id)
+}
+
+func (q queries) FindView(id int64) (models.View, error) {
+	var view models.View
+	if id == 0 {
+		return view, fmt.Errorf(errFieldMustBeGreaterThanZero, "id")
+	}
+
+	var attributes []byte
+	err := q.queryRow(sqlSelectView, []interface{}{id},
+		&view.ID, &view.Name, &attributes, &view.CreatedAt, &view.UpdatedAt)
+	if err != nil || attributes == nil {
+		return view, err
+	}
+
+	err = view.Attributes.Scan(attributes)
+	return view, err
+}
+
+func (q queries) InsertSchema(schema models.EntitySchema) (models.EntitySchema, error) {
+	if err := schema.Validate(); err != nil {
+		return models.EntitySchema{}, err
+	} else if schema.ID != 0 {
+		return models.EntitySchema{}, fmt.Errorf(errNoInsertHasPrimaryKey, "EntitySchema")
+	}
+
+	id, err := q.insert(sqlInsertEntitySchema, schema.Kind, string(schema.Definition))
+	if err != nil {
+		return models.EntitySchema{}, err
+	}
+
+	return q.findSchema(sqlSelectEntitySchema, id)
+}
+
+func (q queries) FindLatestSchema(kind string) (models.EntitySchema, error) {
+	if kind == "" {
+		return models.EntitySchema{}, fmt.Errorf(errFieldMustBeNonEmpty, "kind")
+	}
+
+	return q.findSchema(sqlSelectLatestEntitySchema, kind)
+}
+
+func (q queries) findSchema(query string, arg interface{}) (models.EntitySchema, error) {
+	var schema models.EntitySchema
+	var definition []byte
+
+	err := q.queryRow(query, []interface{}{arg},
+		&schema.ID, &schema.Kind, &schema.Version, &definition, &schema.CreatedAt)
+
+	schema.Definition = json.RawMessage(definition)
+	return schema, err
+}
+
+// insert runs an INSERT statement and returns the ID of the inserted row.
+func (q queries) insert(query string, args ...interface{}) (int64, error) {
+	result, err := q.exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+// update runs an UPDATE statement of a single row. If no row was updated,
+// store.ErrNotFound is returned.
+func (q queries) update(query string, args ...interface{}) error {
+	result, err := q.exec(query, args...)
+	if err != nil {
+		return err
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if updated == 0 {
+		return store.ErrNotFound
+	}
+
+	return nil
+}
+
+func (q queries) exec(query string, args ...interface{}) (sql.Result, error) {
+	d := dal.NewDataAccessLayer(q.db)
+	result := d.Exec(query, args...)
+	return result, d.Result()
+}
+
+// queryRow runs a query that returns a single row and scans it into dest. If
+// there is no row, store.ErrNotFound is returned.
+func (q queries) queryRow(query string, args []interface{}, dest ...interface{}) error {
+	d := dal.NewDataAccessLayer(q.db)
+	d.Scan(d.QueryRow(query, args...), dest...)
+
+	err := d.Result()
+	if err == sql.ErrNoRows {
+		return store.ErrNotFound
+	}
+
+	return err
+}
+
+// jsonText encodes a value as JSON text. SQLite's JSON functions don't accept
+// blobs, so the []byte that models encode JSON to can't be stored directly.
+func jsonText(value driver.Valuer) (interface{}, error) {
+	encoded, err := value.Value()
+	if err != nil || encoded == nil {
+		return nil, err
+	}
+
+	if bytes, ok := encoded.([]byte); ok {
+		return string(bytes), nil
+	}
+
+	return encoded, nil
+}
@@ -0,0 +1,103 @@
+// Package sqlite implements a store.Store that keeps Entities in an embedded
+// SQLite database, for applications such as point-of-sale apps and developer
+// tools that can't depend on a Postgres server:
+//
+//	db, err := sqlite.Open("catalog.db")
+//	if err != nil {
+//	  return err
+//	}
+//
+//	if err := sqlite.Migrate(db); err != nil {
+//	  return err
+//	}
+//
+//	mgr := gizmo.NewEntityManagerWithStore(sqlite.NewStore(db))
+//
+// The Store has the same behavior as the Postgres Store. JSON is stored as
+// text and queried with the JSON1 functions of SQLite.
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+
+	"github.com/jmataya/gizmo/common"
+	"github.com/jmataya/gizmo/store"
+	_ "github.com/mattn/go-sqlite3" // Needed to allow database/sql to use SQLite.
+)
+
+// busyTimeout is how long, in milliseconds, a connection waits for another
+// connection to release its lock on the database.
+const busyTimeout = 5000
+
+// Open opens the SQLite database file at path, creating it if it doesn't
+// exist. Every connection to the database enforces foreign keys, and starts
+// its transactions with a write lock, so that transactions that update the
+// same Entity are serialized like they are by Postgres.
+func Open(path string) (*sql.DB, error) {
+	params := url.Values{}
+	params.Set("_foreign_keys", "1")
+	params.Set("_journal_mode", "WAL")
+	params.Set("_busy_timeout", fmt.Sprintf("%d", busyTimeout))
+	params.Set("_txlock", "immediate")
+
+	db, err := sql.Open("sqlite3", "file:"+path+"?"+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// NewStore creates a Store that keeps Entities in a SQLite database. The
+// database must be opened with Open, and migrated with Migrate. The Store
+// prepares each query once and reuses the statement until the Store is
+// closed. The Store implements io.Closer.
+func NewStore(db *sql.DB) store.Store {
+	cache := common.NewStmtCache(db)
+	return &sqliteStore{queries: queries{db: cache}, db: db, cache: cache}
+}
+
+type sqliteStore struct {
+	queries
+	db    *sql.DB
+	cache *common.StmtCache
+}
+
+// Close closes the statements that the Store has prepared, but not the
+// database.
+func (s *sqliteStore) Close() error {
+	return s.cache.Close()
+}
+
+func (s *sqliteStore) Begin() (store.Tx, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	cache := s.cache.Tx(tx)
+	return &sqliteTx{queries: queries{db: cache}, tx: tx, cache: cache}, nil
+}
+
+type sqliteTx struct {
+	queries
+	tx    *sql.Tx
+	cache *common.TxStmtCache
+}
+
+func (t *sqliteTx) Commit() error {
+	defer t.cache.Done()
+	return t.tx.Commit()
+}
+
+func (t *sqliteTx) Rollback() error {
+	defer t.cache.Done()
+	return t.tx.Rollback()
+}
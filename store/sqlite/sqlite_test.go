@@ -0,0 +1,174 @@
+package sqlite
+
+import (
+	"database/sql"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmataya/gizmo"
+	"github.com/jmataya/gizmo/models"
+	"github.com/jmataya/gizmo/store"
+	"github.com/jmataya/gizmo/store/storetest"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	db, err := Open(filepath.Join(t.TempDir(), "gizmo.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestStore_Conformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		return NewStore(openTestDB(t))
+	})
+}
+
+func TestMigrate(t *testing.T) {
+	db := openTestDB(t)
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Migrating an up to date database doesn't apply anything again.
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	var version, applied int
+	if err := db.QueryRow("SELECT MAX(version), COUNT(*) FROM schema_version").Scan(&version, &applied); err != nil {
+		t.Fatal(err)
+	}
+
+	if latest := migrations[len(migrations)-1].version; version != latest {
+		t.Errorf("Expected schema version %d, got %d", latest, version)
+	}
+	if applied != len(migrations) {
+		t.Errorf("Expected %d applied migrations, got %d", len(migrations), applied)
+	}
+}
+
+func TestOpen_ForeignKeys(t *testing.T) {
+	db := openTestDB(t)
+
+	if _, err := db.Exec("INSERT INTO object_shadows (form_id, attributes) VALUES (1, '{}')"); err == nil {
+		t.Error("Expected foreign keys to be enforced")
+	}
+}
+
+type sku struct {
+	gizmo.EntityObject
+	Price float64
+}
+
+type variant struct {
+	gizmo.EntityObject
+	Title string
+	SKUs  []sku
+}
+
+func TestStore_EntityManager(t *testing.T) {
+	s := NewStore(openTestDB(t))
+	view, err := s.InsertView(models.View{Name: "Point of Sale"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mgr := gizmo.NewEntityManagerWithStore(s, gizmo.WithPropagation())
+
+	newSKU, err := mgr.Create(&sku{Price: 999.0}, view.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newVariant, err := mgr.Create(&variant{Title: "Fox Socks", SKUs: []sku{*newSKU.(*sku)}}, view.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	toUpdate := newSKU.(*sku)
+	toUpdate.Price = 1299.0
+	if _, err := mgr.Update(toUpdate); err != nil {
+		t.Fatal(err)
+	}
+
+	var found variant
+	if err := mgr.Find(newVariant.Identifier(), view.ID, &found); err != nil {
+		t.Fatal(err)
+	}
+
+	if found.Title != "Fox Socks" {
+		t.Errorf("Expected title Fox Socks, got %s", found.Title)
+	}
+	if len(found.SKUs) != 1 || found.SKUs[0].Price != 1299.0 {
+		t.Errorf("Expected the updated SKU to be propagated, got %+v", found.SKUs)
+	}
+
+	if err := mgr.Delete(newVariant.Identifier(), view.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mgr.Find(newVariant.Identifier(), view.ID, &variant{}); err != gizmo.ErrEntityNotFound {
+		t.Errorf("Find after Delete = %v, want %v", err, gizmo.ErrEntityNotFound)
+	}
+}
+
+func TestStore_SingleConnection(t *testing.T) {
+	db := openTestDB(t)
+	db.SetMaxOpenConns(1)
+
+	s := NewStore(db)
+	defer s.(io.Closer).Close()
+
+	view, err := s.InsertView(models.View{Name: "Point of Sale"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mgr := gizmo.NewEntityManagerWithStore(s)
+
+	// The second round reuses the statements that the first one cached.
+	for round := 0; round < 2; round++ {
+		created, err := mgr.Create(&sku{Price: 999.0}, view.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		toUpdate := created.(*sku)
+		toUpdate.Price = 1299.0
+		if _, err := mgr.Update(toUpdate); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestStore_Close(t *testing.T) {
+	s := NewStore(openTestDB(t))
+	if _, err := s.InsertView(models.View{Name: "Point of Sale"}); err != nil {
+		t.Fatal(err)
+	}
+
+	cache := s.(*sqliteStore).cache
+	stmt, err := cache.Prepare(sqlInsertView)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.(io.Closer).Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := stmt.Exec("Kiosk", "{}"); err == nil {
+		t.Error("Expected closing the Store to close its statements")
+	}
+}
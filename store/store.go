@@ -0,0 +1,156 @@
+// Package store defines the storage that gizmo keeps Entities in. A Store
+// persists the content of Entities as forms, shadows and commits, their
+// history as roots and versions, and where they are current as heads in
+// Views. The EntityManager only depends on the Store interface, so it can be
+// backed by any implementation of it.
+package store
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jmataya/gizmo/models"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// General error messages.
+	errNoInsertHasPrimaryKey = "%s has a primary key and cannot be inserted"
+	errReferenceMustExist    = "%s with ID=%d does not exist"
+
+	// Query error messages.
+	errFieldMustBeGreaterThanZero = "%s must be greater than zero"
+	errFieldMustBeZero            = "%s must be zero"
+	errFieldMustBeNonEmpty        = "%s must be non-empty"
+)
+
+// ErrNotFound is returned when a record that is looked up doesn't exist.
+var ErrNotFound = errors.New("Record not found")
+
+// Store is the storage of Entities. Each operation on a Store is applied on
+// its own; operations that must be applied together are made in a Tx.
+type Store interface {
+	Queries
+
+	// Begin starts a transaction.
+	Begin() (Tx, error)
+}
+
+// Tx is a transaction in a Store. Its changes are only visible outside of the
+// transaction once it is committed, and are discarded if it's rolled back.
+type Tx interface {
+	Queries
+
+	// Commit applies the changes made in the transaction.
+	Commit() error
+
+	// Rollback discards the changes made in the transaction.
+	Rollback() error
+}
+
+// Queries are the operations that are supported by both a Store and a Tx.
+// Records are immutable unless an operation says otherwise, and inserting a
+// record returns a copy of it with its ID and timestamps set. Finding a record
+// that doesn't exist returns ErrNotFound.
+type Queries interface {
+	// InsertForm inserts an ObjectForm.
+	InsertForm(form models.ObjectForm) (models.ObjectForm, error)
+
+	// InsertShadow inserts an ObjectShadow of a previously inserted form.
+	InsertShadow(shadow models.ObjectShadow) (models.ObjectShadow, error)
+
+	// InsertCommit inserts an ObjectCommit of a form and shadow.
+	InsertCommit(commit models.ObjectCommit) (models.ObjectCommit, error)
+
+	// FindFullObject retrieves the form, shadow, and commit of the
+	// ObjectCommit with an ID.
+	FindFullObject(commitID int64) (models.FullObject, error)
+
+	// InsertRoot inserts an EntityRoot.
+	InsertRoot(root models.EntityRoot) (models.EntityRoot, error)
+
+	// FindRoot retrieves the EntityRoot with an ID.
+	FindRoot(id int64) (models.EntityRoot, error)
+
+	// InsertVersion inserts an EntityVersion.
+	InsertVersion(version models.EntityVersion) (models.EntityVersion, error)
+
+	// FindVersion retrieves the EntityVersion with an ID.
+	FindVersion(id int64) (models.EntityVersion, error)
+
+	// InsertHead inserts an EntityHead.
+	InsertHead(head models.EntityHead) (models.EntityHead, error)
+
+	// FindHead retrieves the live EntityHead of an EntityRoot in a View.
+	FindHead(rootID int64, viewID int64) (models.EntityHead, error)
+
+	// FindHeadForUpdate retrieves the live EntityHead of an EntityRoot in a
+	// View, and keeps other transactions from changing it until the current
+	// transaction ends.
+	FindHeadForUpdate(rootID int64, viewID int64) (models.EntityHead, error)
+
+	// FindHeadsByRelation retrieves the live EntityHeads in a View whose
+	// current EntityVersion relates to the EntityVersion versionID, ordered
+	// by ID, and keeps other transactions from changing them until the
+	// current transaction ends.
+	FindHeadsByRelation(viewID int64, versionID int64) ([]models.EntityHead, error)
+
+	// UpdateHead moves a live EntityHead to its VersionID.
+	UpdateHead(head models.EntityHead) (models.EntityHead, error)
+
+	// ArchiveHead marks a live EntityHead as archived, which removes its
+	// Entity from the View.
+	ArchiveHead(head models.EntityHead) (models.EntityHead, error)
+
+	// InsertView inserts a View.
+	InsertView(view models.View) (models.View, error)
+
+	// FindView retrieves the View with an ID.
+	FindView(id int64) (models.View, error)
+
+	// InsertSchema inserts the next version of the EntitySchema of a kind.
+	InsertSchema(schema models.EntitySchema) (models.EntitySchema, error)
+
+	// FindLatestSchema retrieves the most recent version of the EntitySchema
+	// of a kind.
+	FindLatestSchema(kind string) (models.EntitySchema, error)
+}
+
+// InsertFullObject inserts the form, shadow, and commit of a FullObject, in
+// that order, and returns a copy of it with the values that were inserted.
+// Progress is logged to logger.
+func InsertFullObject(logger log.FieldLogger, q Queries, full models.FullObject) (models.FullObject, error) {
+	if full.Form.ID != 0 {
+		return full, fmt.Errorf(errFieldMustBeZero, "Form.ID")
+	} else if full.Shadow.ID != 0 {
+		return full, fmt.Errorf(errFieldMustBeZero, "Shadow.ID")
+	} else if full.Commit.ID != 0 {
+		return full, fmt.Errorf(errFieldMustBeZero, "Commit.ID")
+	}
+
+	logger.Debugln("Inserting Form")
+	newForm, err := q.InsertForm(full.Form)
+	if err != nil {
+		return full, err
+	}
+	logger.Debugf("Inserted Form with ID=%d", newForm.ID)
+
+	logger.Debugln("Inserting Shadow")
+	full.Shadow.FormID = newForm.ID
+	newShadow, err := q.InsertShadow(full.Shadow)
+	if err != nil {
+		return full, err
+	}
+	logger.Debugf("Inserted Shadow with ID=%d", newShadow.ID)
+
+	logger.Debugln("Inserting Commit")
+	full.Commit.FormID = newForm.ID
+	full.Commit.ShadowID = newShadow.ID
+	newCommit, err := q.InsertCommit(full.Commit)
+	if err != nil {
+		return full, err
+	}
+	logger.Debugf("Inserted Commit with ID=%d", newCommit.ID)
+
+	return models.FullObject{Form: newForm, Shadow: newShadow, Commit: newCommit}, nil
+}
@@ -0,0 +1,566 @@
+// Package storetest is a conformance suite for implementations of
+// store.Store. Every implementation is expected to pass it:
+//
+//	func TestMyStore(t *testing.T) {
+//	  storetest.Run(t, func(t *testing.T) store.Store {
+//	    return NewMyStore()
+//	  })
+//	}
+//
+// The suite only relies on records that it creates itself, so it can be run
+// against a database that is shared with other tests.
+package storetest
+
+import (
+	"database/sql"
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/jmataya/gizmo/models"
+	"github.com/jmataya/gizmo/store"
+	log "github.com/sirupsen/logrus"
+)
+
+// missingID is an ID that no record is expected to have.
+const missingID = math.MaxInt32
+
+// Run runs the conformance suite. newStore is called by every test to get
+// the Store that it runs against.
+func Run(t *testing.T, newStore func(t *testing.T) store.Store) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s store.Store)
+	}{
+		{"Content", testContent},
+		{"FormRefs", testFormRefs},
+		{"PrimaryKeys", testPrimaryKeys},
+		{"References", testReferences},
+		{"NotFound", testNotFound},
+		{"Versions", testVersions},
+		{"Heads", testHeads},
+		{"HeadsByRelation", testHeadsByRelation},
+		{"Views", testViews},
+		{"Schemas", testSchemas},
+		{"Commit", testCommit},
+		{"Rollback", testRollback},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			test.test(t, newStore(t))
+		})
+	}
+}
+
+func testContent(t *testing.T, s store.Store) {
+	full := insertFullObject(t, s, "Fox Socks", 12)
+
+	found, err := s.FindFullObject(full.Commit.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	titleRef := attributeRef(t, "Fox Socks")
+	priceRef := attributeRef(t, 12)
+
+	wantAttributes := models.ObjectFormAttributes{titleRef: "Fox Socks", priceRef: json.Number("12")}
+	if !reflect.DeepEqual(wantAttributes, found.Form.Attributes) {
+		t.Errorf("Expected form attributes %v, got %v", wantAttributes, found.Form.Attributes)
+	}
+
+	if found.Form.ID != full.Form.ID || found.Form.Kind != "product" {
+		t.Errorf("Expected form %d of kind product, got %d of kind %s", full.Form.ID, found.Form.ID, found.Form.Kind)
+	}
+
+	if found.Shadow.ID != full.Shadow.ID || found.Shadow.FormID != full.Form.ID || found.Shadow.Revision != 2 {
+		t.Errorf("Unexpected shadow %+v", found.Shadow)
+	} else if found.Shadow.Attributes["title"] != full.Shadow.Attributes["title"] {
+		t.Errorf("Expected title attribute %v, got %v", full.Shadow.Attributes["title"], found.Shadow.Attributes["title"])
+	}
+
+	if found.Commit.ID != full.Commit.ID || found.Commit.ShadowID != full.Shadow.ID || found.Commit.PreviousID.Valid {
+		t.Errorf("Expected commit %+v, got %+v", full.Commit, found.Commit)
+	}
+
+	next := models.FullObject{Form: *models.NewObjectForm("product"), Shadow: *models.NewObjectShadow()}
+	next.Commit.PreviousID = sql.NullInt64{Int64: full.Commit.ID, Valid: true}
+
+	inserted, err := store.InsertFullObject(log.StandardLogger(), s, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if inserted.Commit.PreviousID != next.Commit.PreviousID {
+		t.Errorf("Expected previous commit %v, got %v", next.Commit.PreviousID, inserted.Commit.PreviousID)
+	} else if inserted.Form.Attributes == nil {
+		t.Error("Expected a form without values to have empty attributes")
+	}
+}
+
+func testFormRefs(t *testing.T, s store.Store) {
+	form := models.NewObjectForm("product")
+	form.Attributes["title"] = "Fox Socks"
+
+	if _, err := s.InsertForm(*form); err == nil {
+		t.Error("Expected an error for a value that isn't stored under its ref")
+	}
+}
+
+func testPrimaryKeys(t *testing.T, s store.Store) {
+	full := insertFullObject(t, s, "Fox Socks", 12)
+
+	if _, err := s.InsertForm(full.Form); err == nil {
+		t.Error("Expected an error for a form with an ID")
+	}
+	if _, err := s.InsertShadow(full.Shadow); err == nil {
+		t.Error("Expected an error for a shadow with an ID")
+	}
+	if _, err := s.InsertCommit(full.Commit); err == nil {
+		t.Error("Expected an error for a commit with an ID")
+	}
+	if _, err := store.InsertFullObject(log.StandardLogger(), s, full); err == nil {
+		t.Error("Expected an error for a full object with IDs")
+	}
+}
+
+func testReferences(t *testing.T, s store.Store) {
+	full := insertFullObject(t, s, "Fox Socks", 12)
+	root := insertRoot(t, s)
+	view := insertView(t, s)
+	version := insertVersion(t, s, root, full, models.EntityRelations{})
+
+	if _, err := s.InsertShadow(models.ObjectShadow{FormID: missingID}); err == nil {
+		t.Error("Expected an error for a shadow of a missing form")
+	}
+	if _, err := s.InsertCommit(models.ObjectCommit{FormID: full.Form.ID, ShadowID: missingID}); err == nil {
+		t.Error("Expected an error for a commit of a missing shadow")
+	}
+	if _, err := s.InsertVersion(models.EntityVersion{Kind: "product", ContentCommitID: missingID}); err == nil {
+		t.Error("Expected an error for a version of a missing commit")
+	}
+
+	head := models.EntityHead{RootID: root.ID, ViewID: view.ID, VersionID: missingID}
+	if _, err := s.InsertHead(head); err == nil {
+		t.Error("Expected an error for a head of a missing version")
+	}
+
+	head = models.EntityHead{RootID: root.ID, ViewID: missingID, VersionID: version.ID}
+	if _, err := s.InsertHead(head); err == nil {
+		t.Error("Expected an error for a head in a missing view")
+	}
+}
+
+func testNotFound(t *testing.T, s store.Store) {
+	if _, err := s.FindFullObject(missingID); err != store.ErrNotFound {
+		t.Errorf("FindFullObject: expected ErrNotFound, got %v", err)
+	}
+	if _, err := s.FindRoot(missingID); err != store.ErrNotFound {
+		t.Errorf("FindRoot: expected ErrNotFound, got %v", err)
+	}
+	if _, err := s.FindVersion(missingID); err != store.ErrNotFound {
+		t.Errorf("FindVersion: expected ErrNotFound, got %v", err)
+	}
+	if _, err := s.FindHead(missingID, missingID); err != store.ErrNotFound {
+		t.Errorf("FindHead: expected ErrNotFound, got %v", err)
+	}
+	if _, err := s.FindView(missingID); err != store.ErrNotFound {
+		t.Errorf("FindView: expected ErrNotFound, got %v", err)
+	}
+	if _, err := s.FindLatestSchema("storetest_missing"); err != store.ErrNotFound {
+		t.Errorf("FindLatestSchema: expected ErrNotFound, got %v", err)
+	}
+
+	if _, err := s.FindRoot(0); err == nil || err == store.ErrNotFound {
+		t.Errorf("FindRoot: expected a validation error for ID 0, got %v", err)
+	}
+	if heads, err := s.FindHeadsByRelation(insertView(t, s).ID, missingID); err != nil || len(heads) != 0 {
+		t.Errorf("FindHeadsByRelation: expected no heads, got %v and %v", heads, err)
+	}
+}
+
+func testVersions(t *testing.T, s store.Store) {
+	full := insertFullObject(t, s, "Fox Socks", 12)
+
+	root, err := s.InsertRoot(models.EntityRoot{Kind: "Product"})
+	if err != nil {
+		t.Fatal(err)
+	} else if root.Kind != "product" || root.CreatedAt.IsZero() || root.ArchivedAt != nil {
+		t.Errorf("Unexpected root %+v", root)
+	}
+
+	foundRoot, err := s.FindRoot(root.ID)
+	if err != nil {
+		t.Fatal(err)
+	} else if foundRoot.ID != root.ID || foundRoot.Kind != root.Kind {
+		t.Errorf("Expected root %+v, got %+v", root, foundRoot)
+	}
+
+	parent := insertVersion(t, s, root, full, models.EntityRelations{})
+	if parent.Kind != "product" || parent.RootID != root.ID || parent.ParentID.Valid {
+		t.Errorf("Unexpected version %+v", parent)
+	}
+
+	relations := models.EntityRelations{
+		"sku": {{ID: parent.ID, Kind: "sku", Position: 0, Metadata: map[string]interface{}{"quantity": 2.0}}},
+	}
+
+	child, err := s.InsertVersion(models.EntityVersion{
+		ParentID:        sql.NullInt64{Int64: parent.ID, Valid: true},
+		Kind:            "product",
+		ContentCommitID: full.Commit.ID,
+		Relations:       relations,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := s.FindVersion(child.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if found.ParentID != child.ParentID || found.RootID != 0 || found.ContentCommitID != full.Commit.ID {
+		t.Errorf("Expected version %+v, got %+v", child, found)
+	} else if !reflect.DeepEqual(relations, found.Relations) {
+		t.Errorf("Expected relations %v, got %v", relations, found.Relations)
+	}
+}
+
+func testHeads(t *testing.T, s store.Store) {
+	full := insertFullObject(t, s, "Fox Socks", 12)
+	root := insertRoot(t, s)
+	view := insertView(t, s)
+	first := insertVersion(t, s, root, full, models.EntityRelations{})
+	second := insertVersion(t, s, root, full, models.EntityRelations{})
+
+	head := insertHead(t, s, root, view, first)
+	if head.ArchivedAt != nil || head.CreatedAt.IsZero() {
+		t.Errorf("Unexpected head %+v", head)
+	}
+
+	found, err := s.FindHead(root.ID, view.ID)
+	if err != nil {
+		t.Fatal(err)
+	} else if found.ID != head.ID || found.VersionID != first.ID {
+		t.Errorf("Expected head %+v, got %+v", head, found)
+	}
+
+	if _, err := s.FindHead(root.ID, insertView(t, s).ID); err != store.ErrNotFound {
+		t.Errorf("Expected ErrNotFound in another view, got %v", err)
+	}
+
+	tx, err := s.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	locked, err := tx.FindHeadForUpdate(root.ID, view.ID)
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(err)
+	}
+
+	locked.VersionID = second.ID
+	updated, err := tx.UpdateHead(locked)
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(err)
+	} else if updated.ID != head.ID || updated.VersionID != second.ID {
+		t.Errorf("Unexpected updated head %+v", updated)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	archived, err := s.ArchiveHead(updated)
+	if err != nil {
+		t.Fatal(err)
+	} else if archived.ArchivedAt == nil {
+		t.Error("Expected ArchivedAt to be set")
+	}
+
+	if _, err := s.FindHead(root.ID, view.ID); err != store.ErrNotFound {
+		t.Errorf("FindHead: expected ErrNotFound for an archived head, got %v", err)
+	}
+	if _, err := s.UpdateHead(updated); err != store.ErrNotFound {
+		t.Errorf("UpdateHead: expected ErrNotFound for an archived head, got %v", err)
+	}
+	if _, err := s.ArchiveHead(updated); err != store.ErrNotFound {
+		t.Errorf("ArchiveHead: expected ErrNotFound for an archived head, got %v", err)
+	}
+
+	// A new head can be inserted once the old one is archived.
+	insertHead(t, s, root, view, second)
+	if found, err := s.FindHead(root.ID, view.ID); err != nil || found.VersionID != second.ID {
+		t.Errorf("Expected the new head, got %+v and %v", found, err)
+	}
+}
+
+func testHeadsByRelation(t *testing.T, s store.Store) {
+	full := insertFullObject(t, s, "Fox Socks", 12)
+	view := insertView(t, s)
+	otherView := insertView(t, s)
+
+	childRoot := insertRoot(t, s)
+	child := insertVersion(t, s, childRoot, full, models.EntityRelations{})
+	insertHead(t, s, childRoot, view, child)
+
+	relations := models.NewEntityRelations(map[string][]int64{"sku": {child.ID}})
+
+	parents := []models.EntityHead{}
+	for i := 0; i < 2; i++ {
+		root := insertRoot(t, s)
+		version := insertVersion(t, s, root, full, relations)
+		parents = append(parents, insertHead(t, s, root, view, version))
+	}
+
+	// Neither a parent in another view nor an archived parent is returned.
+	otherRoot := insertRoot(t, s)
+	insertHead(t, s, otherRoot, otherView, insertVersion(t, s, otherRoot, full, relations))
+
+	archivedRoot := insertRoot(t, s)
+	archived := insertHead(t, s, archivedRoot, view, insertVersion(t, s, archivedRoot, full, relations))
+	if _, err := s.ArchiveHead(archived); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := s.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	heads, err := tx.FindHeadsByRelation(view.ID, child.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(heads) != len(parents) {
+		t.Fatalf("Expected %d heads, got %d", len(parents), len(heads))
+	}
+
+	for index, head := range heads {
+		if head.ID != parents[index].ID {
+			t.Errorf("Expected head %d at %d, got %d", parents[index].ID, index, head.ID)
+		}
+	}
+}
+
+func testViews(t *testing.T, s store.Store) {
+	view, err := s.InsertView(models.View{Name: "Storefront", Attributes: models.ViewAttributes{"locale": "en"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := s.FindView(view.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if found.ID != view.ID || found.Name != "Storefront" || found.Attributes["locale"] != "en" {
+		t.Errorf("Expected view %+v, got %+v", view, found)
+	}
+
+	if _, err := s.InsertView(models.View{}); err == nil {
+		t.Error("Expected an error for a view without a name")
+	}
+}
+
+func testSchemas(t *testing.T, s store.Store) {
+	const kind = "storetest_product"
+
+	first, err := s.InsertSchema(models.EntitySchema{Kind: kind, Definition: json.RawMessage(`{"kind": "a"}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := s.InsertSchema(models.EntitySchema{Kind: kind, Definition: json.RawMessage(`{"kind": "b"}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if second.Version != first.Version+1 {
+		t.Errorf("Expected version %d, got %d", first.Version+1, second.Version)
+	}
+
+	latest, err := s.FindLatestSchema(kind)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var definition map[string]string
+	if err := json.Unmarshal(latest.Definition, &definition); err != nil {
+		t.Fatal(err)
+	}
+
+	if latest.ID != second.ID || latest.Version != second.Version || definition["kind"] != "b" {
+		t.Errorf("Expected schema %+v, got %+v", second, latest)
+	}
+
+	if _, err := s.InsertSchema(models.EntitySchema{Kind: kind, Definition: json.RawMessage("{")}); err == nil {
+		t.Error("Expected an error for a definition that isn't JSON")
+	}
+}
+
+func testCommit(t *testing.T, s store.Store) {
+	tx, err := s.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	full, err := store.InsertFullObject(log.StandardLogger(), tx, newFullObject(t, "Fox Socks", 12))
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(err)
+	}
+
+	root, err := tx.InsertRoot(models.EntityRoot{Kind: "product"})
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(err)
+	}
+
+	// Changes are visible in the transaction, but not outside of it.
+	if _, err := tx.FindFullObject(full.Commit.ID); err != nil {
+		t.Errorf("Expected the commit to be visible in the transaction, got %v", err)
+	}
+	if _, err := s.FindRoot(root.ID); err != store.ErrNotFound {
+		t.Errorf("Expected ErrNotFound outside of the transaction, got %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.FindFullObject(full.Commit.ID); err != nil {
+		t.Errorf("Expected the commit to be visible after committing, got %v", err)
+	}
+	if _, err := s.FindRoot(root.ID); err != nil {
+		t.Errorf("Expected the root to be visible after committing, got %v", err)
+	}
+
+	if err := tx.Commit(); err == nil {
+		t.Error("Expected an error for committing twice")
+	}
+}
+
+func testRollback(t *testing.T, s store.Store) {
+	tx, err := s.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	full, err := store.InsertFullObject(log.StandardLogger(), tx, newFullObject(t, "Fox Socks", 12))
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(err)
+	}
+
+	root, err := tx.InsertRoot(models.EntityRoot{Kind: "product"})
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(err)
+	}
+
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.FindFullObject(full.Commit.ID); err != store.ErrNotFound {
+		t.Errorf("Expected ErrNotFound for a rolled back commit, got %v", err)
+	}
+	if _, err := s.FindRoot(root.ID); err != store.ErrNotFound {
+		t.Errorf("Expected ErrNotFound for a rolled back root, got %v", err)
+	}
+
+	// The Store can still be written to after a rollback.
+	insertRoot(t, s)
+}
+
+func attributeRef(t *testing.T, value interface{}) string {
+	ref, err := models.AttributeRef(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ref
+}
+
+func newFullObject(t *testing.T, title string, price int) models.FullObject {
+	form := models.NewObjectForm("product")
+	shadow := models.NewObjectShadow()
+	shadow.Revision = 2
+
+	titleRef, err := form.AddAttribute(title)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	priceRef, err := form.AddAttribute(price)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := shadow.AddAttribute("title", "string", titleRef); err != nil {
+		t.Fatal(err)
+	}
+	if err := shadow.AddAttribute("price", "int", priceRef); err != nil {
+		t.Fatal(err)
+	}
+
+	return models.FullObject{Form: *form, Shadow: *shadow}
+}
+
+func insertFullObject(t *testing.T, s store.Store, title string, price int) models.FullObject {
+	full, err := store.InsertFullObject(log.StandardLogger(), s, newFullObject(t, title, price))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return full
+}
+
+func insertRoot(t *testing.T, s store.Store) models.EntityRoot {
+	root, err := s.InsertRoot(models.EntityRoot{Kind: "product"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return root
+}
+
+func insertView(t *testing.T, s store.Store) models.View {
+	view, err := s.InsertView(models.View{Name: "Default"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return view
+}
+
+func insertVersion(t *testing.T, s store.Store, root models.EntityRoot, full models.FullObject, relations models.EntityRelations) models.EntityVersion {
+	version, err := s.InsertVersion(models.EntityVersion{
+		RootID:          root.ID,
+		Kind:            root.Kind,
+		ContentCommitID: full.Commit.ID,
+		Relations:       relations,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return version
+}
+
+func insertHead(t *testing.T, s store.Store, root models.EntityRoot, view models.View, version models.EntityVersion) models.EntityHead {
+	head, err := s.InsertHead(models.EntityHead{RootID: root.ID, ViewID: view.ID, VersionID: version.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return head
+}
@@ -0,0 +1,109 @@
+package gizmo
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/gedex/inflector"
+)
+
+const (
+	gizmoTag = "gizmo"
+	jsonTag  = "json"
+
+	tagOmitEmpty = "omitempty"
+	tagRelation  = "relation"
+	tagRequired  = "required"
+	tagReadOnly  = "readonly"
+)
+
+// fieldTag describes how a field is stored, as declared by its struct tag. The
+// gizmo tag takes precedence over the json tag, and has the form:
+//
+//	Field string `gizmo:"name,omitempty,required,readonly"`
+//	SKUs  []SKU  `gizmo:"sku,relation"`
+//
+// The name defaults to the field name with its first letter lowercased, and a
+// name of "-" skips the field entirely. Of the options, the json tag only
+// supports omitempty; its other options are ignored.
+type fieldTag struct {
+	name      string
+	named     bool
+	skip      bool
+	relation  bool
+	omitEmpty bool
+	required  bool
+	readOnly  bool
+}
+
+// parseFieldTag parses the tag of a field.
+func parseFieldTag(field reflect.StructField) (fieldTag, error) {
+	tag := fieldTag{name: lowercaseFirst(field.Name)}
+
+	key := gizmoTag
+	value, ok := field.Tag.Lookup(gizmoTag)
+	if !ok {
+		key = jsonTag
+		if value, ok = field.Tag.Lookup(jsonTag); !ok {
+			return tag, nil
+		}
+	}
+
+	if value == "-" {
+		tag.skip = true
+		return tag, nil
+	}
+
+	parts := strings.Split(value, ",")
+	if parts[0] != "" {
+		tag.name = parts[0]
+		tag.named = key == gizmoTag
+	}
+
+	for _, option := range parts[1:] {
+		switch {
+		case option == "":
+			continue
+		case option == tagOmitEmpty:
+			tag.omitEmpty = true
+		case key == jsonTag:
+			continue
+		case option == tagRequired:
+			tag.required = true
+		case option == tagReadOnly:
+			tag.readOnly = true
+		case option == tagRelation:
+			tag.relation = true
+		default:
+			return tag, fmt.Errorf("Unknown option %s in tag of field %s", option, field.Name)
+		}
+	}
+
+	return tag, nil
+}
+
+// relationKey gets the key that a relation field is stored under. Only a name
+// from the gizmo tag is used, since json names describe a different encoding.
+// Without one, the key is derived from the singular form of the field name.
+func relationKey(field reflect.StructField, tag fieldTag) string {
+	if tag.named {
+		return tag.name
+	}
+
+	return strings.ToLower(inflector.Singularize(field.Name))
+}
+
+// isEmptyValue determines whether a value is empty, which is how omitempty and
+// required are evaluated. Empty strings, slices and maps, nil pointers, and
+// zero values are all empty.
+func isEmptyValue(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return value.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return value.IsNil()
+	default:
+		return value.IsZero()
+	}
+}
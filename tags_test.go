@@ -0,0 +1,126 @@
+package gizmo
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jmataya/gizmo/models"
+	"github.com/jmataya/gizmo/testutils"
+	log "github.com/sirupsen/logrus"
+)
+
+type taggedFields struct {
+	Plain     string
+	Named     string   `gizmo:"title"`
+	JSONNamed string   `json:"json_named,omitempty,string"`
+	Both      string   `gizmo:"gizmo_name" json:"json_name"`
+	Skipped   string   `gizmo:"-"`
+	JSONSkip  string   `json:"-"`
+	Dash      string   `gizmo:"-,"`
+	Options   string   `gizmo:",omitempty,required,readonly"`
+	Unknown   string   `gizmo:"unknown,sometimes"`
+	Related   []Banner `gizmo:"banner,relation"`
+}
+
+func TestParseFieldTag(t *testing.T) {
+	var tests = []struct {
+		field   string
+		want    fieldTag
+		wantErr string
+	}{
+		{"Plain", fieldTag{name: "plain"}, ""},
+		{"Named", fieldTag{name: "title", named: true}, ""},
+		{"JSONNamed", fieldTag{name: "json_named", omitEmpty: true}, ""},
+		{"Both", fieldTag{name: "gizmo_name", named: true}, ""},
+		{"Skipped", fieldTag{name: "skipped", skip: true}, ""},
+		{"JSONSkip", fieldTag{name: "jSONSkip", skip: true}, ""},
+		{"Dash", fieldTag{name: "-", named: true}, ""},
+		{"Options", fieldTag{name: "options", omitEmpty: true, required: true, readOnly: true}, ""},
+		{"Unknown", fieldTag{}, "Unknown option sometimes in tag of field Unknown"},
+		{"Related", fieldTag{name: "banner", named: true, relation: true}, ""},
+	}
+
+	for _, test := range tests {
+		field, _ := reflect.TypeOf(taggedFields{}).FieldByName(test.field)
+		got, err := parseFieldTag(field)
+		if errorMsg(err) != test.wantErr {
+			t.Errorf("parseFieldTag(%s) = %s, want %s", test.field, errorMsg(err), test.wantErr)
+		} else if test.wantErr == "" && got != test.want {
+			t.Errorf("parseFieldTag(%s) = %+v, want %+v", test.field, got, test.want)
+		}
+	}
+}
+
+type Gadget struct {
+	EntityObject
+	Title    string `gizmo:"name,required"`
+	Subtitle string `json:"subtitle,omitempty"`
+	Serial   string `gizmo:",readonly"`
+	Notes    string `gizmo:"-"`
+}
+
+func TestEntityToFull_Tags(t *testing.T) {
+	assert := testutils.NewAssert(t)
+
+	gadget := Gadget{Title: "Widget", Serial: "W-1", Notes: "private"}
+	full, err := entityToFull(log.StandardLogger(), &gadget, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertValues(t, map[string]interface{}{"name": "Widget", "serial": "W-1"}, full)
+
+	_, err = entityToFull(log.StandardLogger(), &Gadget{}, nil)
+	assert.Equal("Field name is required", errorMsg(err))
+
+	gadget.Serial = "W-2"
+	gadget.Subtitle = "Blue"
+	updated, err := entityToFull(log.StandardLogger(), &gadget, full)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertValues(t, map[string]interface{}{"name": "Widget", "subtitle": "Blue", "serial": "W-1"}, updated)
+
+	withoutSerial, err := entityToFull(log.StandardLogger(), &gadget, &models.FullObject{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertValues(t, map[string]interface{}{"name": "Widget", "subtitle": "Blue"}, withoutSerial)
+}
+
+func assertValues(t *testing.T, want map[string]interface{}, full *models.FullObject) {
+	values := map[string]interface{}{}
+	for name, attribute := range full.Shadow.Attributes {
+		values[name] = full.Form.Attributes[attribute.Ref]
+	}
+
+	if !reflect.DeepEqual(want, values) {
+		t.Errorf("Expected attributes %v, got %v", want, values)
+	}
+}
+
+type Showcase struct {
+	EntityObject
+	Featured []Banner `gizmo:"banner,relation"`
+	Hero     *Video   `json:"hero_video"`
+}
+
+func TestRelationsFromEntity_Tags(t *testing.T) {
+	banner := Banner{}
+	banner.SetCommitID(11)
+	video := Video{}
+	video.SetCommitID(12)
+
+	showcase := Showcase{Featured: []Banner{banner}, Hero: &video}
+	relations, err := relationsFromEntity(log.StandardLogger(), &showcase)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]int64{"banner": {11}, "hero": {12}}
+	if !reflect.DeepEqual(want, relations.IDs()) {
+		t.Errorf("relationsFromEntity(Showcase) = %v, want %v", relations.IDs(), want)
+	}
+}
@@ -15,7 +15,7 @@ const (
 )
 
 // InitDB initializes a new connection to the default testing database.
-func InitDB(t *testing.T) *sql.DB {
+func InitDB(t testing.TB) *sql.DB {
 	dbName := os.Getenv("DB_NAME")
 	if dbName == "" {
 		dbName = defaultDB
@@ -0,0 +1,104 @@
+package gizmo
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/jmataya/gizmo/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// IlluminatedAttribute is an attribute of an Entity as it is stored: the type
+// recorded in the shadow and the encoded value from the form.
+type IlluminatedAttribute struct {
+	Type  string
+	Value interface{}
+}
+
+// Upcaster transforms the attributes of an Entity from one revision of its
+// kind to the next, such as by renaming an attribute or changing its type.
+// Values are in their encoded form, as they are stored in the ObjectForm, with
+// numbers decoded as json.Number. The returned attributes replace the ones
+// that were passed in.
+type Upcaster func(attributes map[string]IlluminatedAttribute) (map[string]IlluminatedAttribute, error)
+
+// upcasters maps each kind to its upcasters, ordered by the revision they
+// transform from.
+var upcasters = &upcasterRegistry{byKind: map[string][]Upcaster{}}
+
+type upcasterRegistry struct {
+	sync.RWMutex
+	byKind map[string][]Upcaster
+}
+
+// RegisterUpcaster registers the upcaster that transforms the attributes of a
+// kind from a revision to the next one. Upcasters of a kind must be registered
+// in order, starting from revision 0. The number of upcasters registered for a
+// kind is its current revision, which is recorded on every version that is
+// saved. When older versions are loaded, the upcasters for their revision and
+// every later one are applied before the attributes are decoded.
+func RegisterUpcaster(kind string, revision int, upcaster Upcaster) error {
+	if kind == "" {
+		return errors.New("Kind must be non-empty")
+	} else if upcaster == nil {
+		return errors.New("Upcaster must be non-nil")
+	}
+
+	upcasters.Lock()
+	defer upcasters.Unlock()
+
+	if current := len(upcasters.byKind[kind]); revision != current {
+		return fmt.Errorf("Expected an upcaster of %s from revision %d, not %d", kind, current, revision)
+	}
+
+	upcasters.byKind[kind] = append(upcasters.byKind[kind], upcaster)
+	return nil
+}
+
+// currentRevision gets the revision that attributes of a kind are saved in.
+func currentRevision(kind string) int {
+	upcasters.RLock()
+	defer upcasters.RUnlock()
+
+	return len(upcasters.byKind[kind])
+}
+
+// illuminatedAttributes gets the attributes of a FullObject, upcast to the
+// current revision of its kind. Upcasting is logged to logger.
+func illuminatedAttributes(logger log.FieldLogger, full models.FullObject) (map[string]IlluminatedAttribute, error) {
+	attributes := map[string]IlluminatedAttribute{}
+	for name, attribute := range full.Shadow.Attributes {
+		value, ok := full.Form.Attributes[attribute.Ref]
+		if !ok {
+			return nil, fmt.Errorf("Unable to find Form attribute for %s", name)
+		}
+
+		attributes[name] = IlluminatedAttribute{Type: attribute.Type, Value: value}
+	}
+
+	kind := full.Form.Kind
+	revision := full.Shadow.Revision
+
+	upcasters.RLock()
+	pending := upcasters.byKind[kind]
+	upcasters.RUnlock()
+
+	if revision > len(pending) {
+		logger.Warnf("Revision %d of %s is newer than the current revision %d, decoding it as is", revision, kind, len(pending))
+		return attributes, nil
+	}
+
+	for ; revision < len(pending); revision++ {
+		logger.Debugf("Upcasting %s from revision %d", kind, revision)
+
+		upcast, err := pending[revision](attributes)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to upcast %s from revision %d: %s", kind, revision, err.Error())
+		}
+
+		attributes = upcast
+	}
+
+	return attributes, nil
+}
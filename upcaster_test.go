@@ -0,0 +1,163 @@
+package gizmo
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jmataya/gizmo/models"
+	"github.com/jmataya/gizmo/testutils"
+	log "github.com/sirupsen/logrus"
+)
+
+type Listing struct {
+	EntityObject
+	Name  string
+	Price Money
+}
+
+func init() {
+	renameTitle := func(attributes map[string]IlluminatedAttribute) (map[string]IlluminatedAttribute, error) {
+		if title, ok := attributes["title"]; ok {
+			attributes["name"] = title
+			delete(attributes, "title")
+		}
+
+		return attributes, nil
+	}
+
+	priceToMoney := func(attributes map[string]IlluminatedAttribute) (map[string]IlluminatedAttribute, error) {
+		price, ok := attributes["price"]
+		if !ok || price.Type != "string" {
+			return attributes, nil
+		}
+
+		parts := strings.Split(price.Value.(string), ".")
+		if len(parts) != 2 {
+			return nil, errors.New("price must have dollars and cents")
+		}
+
+		attributes["price"] = IlluminatedAttribute{
+			Type: "money",
+			Value: map[string]interface{}{
+				"currency": "USD",
+				"amount":   json.Number(parts[0] + parts[1]),
+			},
+		}
+
+		return attributes, nil
+	}
+
+	if err := RegisterUpcaster("listing", 0, renameTitle); err != nil {
+		panic(err)
+	}
+	if err := RegisterUpcaster("listing", 1, priceToMoney); err != nil {
+		panic(err)
+	}
+}
+
+func TestRegisterUpcaster(t *testing.T) {
+	noop := func(attributes map[string]IlluminatedAttribute) (map[string]IlluminatedAttribute, error) {
+		return attributes, nil
+	}
+
+	var tests = []struct {
+		kind     string
+		revision int
+		upcaster Upcaster
+		wantErr  string
+	}{
+		{"listing", 0, noop, "Expected an upcaster of listing from revision 2, not 0"},
+		{"listing", 3, noop, "Expected an upcaster of listing from revision 2, not 3"},
+		{"", 0, noop, "Kind must be non-empty"},
+		{"listing", 2, nil, "Upcaster must be non-nil"},
+	}
+
+	for _, test := range tests {
+		err := RegisterUpcaster(test.kind, test.revision, test.upcaster)
+		if errorMsg(err) != test.wantErr {
+			t.Errorf("RegisterUpcaster(%s, %d) = %s, want %s", test.kind, test.revision, errorMsg(err), test.wantErr)
+		}
+	}
+
+	testutils.NewAssert(t).Equal(2, currentRevision("listing"))
+}
+
+func TestFullToEntity_Upcasts(t *testing.T) {
+	var tests = []struct {
+		revision   int
+		attributes map[string]IlluminatedAttribute
+		want       Listing
+		wantErr    string
+	}{
+		{
+			0,
+			map[string]IlluminatedAttribute{
+				"title": {"string", "Wool Socks"},
+				"price": {"string", "12.99"},
+			},
+			Listing{Name: "Wool Socks", Price: Money{Currency: "USD", Amount: 1299}},
+			"",
+		},
+		{
+			1,
+			map[string]IlluminatedAttribute{
+				"name":  {"string", "Wool Socks"},
+				"price": {"string", "12.99"},
+			},
+			Listing{Name: "Wool Socks", Price: Money{Currency: "USD", Amount: 1299}},
+			"",
+		},
+		{
+			2,
+			map[string]IlluminatedAttribute{
+				"name":  {"string", "Wool Socks"},
+				"price": {"money", map[string]interface{}{"currency": "EUR", "amount": json.Number("999")}},
+			},
+			Listing{Name: "Wool Socks", Price: Money{Currency: "EUR", Amount: 999}},
+			"",
+		},
+		{
+			0,
+			map[string]IlluminatedAttribute{
+				"price": {"string", "12"},
+			},
+			Listing{},
+			"Unable to upcast listing from revision 1: price must have dollars and cents",
+		},
+	}
+
+	for _, test := range tests {
+		full := models.FullObject{
+			Form:   *models.NewObjectForm("listing"),
+			Shadow: *models.NewObjectShadow(),
+		}
+		full.Shadow.Revision = test.revision
+		for name, attribute := range test.attributes {
+			ref, err := full.Form.AddAttribute(attribute.Value)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			full.Shadow.AddAttribute(name, attribute.Type, ref)
+		}
+
+		var listing Listing
+		err := fullToEntity(log.StandardLogger(), full, &listing)
+		if errorMsg(err) != test.wantErr {
+			t.Errorf("fullToEntity(revision %d) = %s, want %s", test.revision, errorMsg(err), test.wantErr)
+		} else if test.wantErr == "" && (listing.Name != test.want.Name || listing.Price != test.want.Price) {
+			t.Errorf("fullToEntity(revision %d) = %+v, want %+v", test.revision, listing, test.want)
+		}
+	}
+}
+
+func TestEntityToFull_StampsRevision(t *testing.T) {
+	full, err := entityToFull(log.StandardLogger(), &Listing{Name: "Wool Socks"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testutils.NewAssert(t).Equal(2, full.Shadow.Revision)
+}